@@ -0,0 +1,85 @@
+package main
+
+import (
+	"time"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// StoryBackend is a project of stories that issues are synced with.
+//
+// Stories are described with go-tracker's types, or local wrappers of them,
+// whichever backend holds them, so other backends map their own states and
+// types onto Tracker's. Stories are linked to issues by a label named after
+// the issue, as given by Syncer.trackerLabelForIssue.
+type StoryBackend interface {
+	// Project identifies the project, e.g. in sync state and metrics.
+	Project() string
+
+	// ProjectURL links to the project.
+	ProjectURL() string
+
+	// Tool names what the project is kept in for people reading comments,
+	// e.g. "Pivotal Tracker".
+	Tool() string
+
+	AllStories() (StorySet, error)
+	StoriesWithLabel(label string) (StorySet, error)
+	StoriesByID(ids []int) (StorySet, error)
+
+	// LatestVersion and ChangedSince support incremental syncs. Versions are
+	// opaque; ChangedSince returns the IDs of stories changed since the
+	// given version, along with the version as of the change.
+	LatestVersion() (int, error)
+	ChangedSince(version int) ([]int, int, error)
+
+	CreateStory(story Story) (Story, error)
+	DeleteStory(id int) error
+	SetStoryType(id int, storyType tracker.StoryType) (Story, error)
+	SetStoryName(id int, name string) (Story, error)
+	UnscheduleStory(id int) (Story, error)
+	DeliverStoryWithComment(id int, comment string) (Story, error)
+
+	// SetStoryState moves the story to the given state, or the closest the
+	// backend has to it.
+	SetStoryState(id int, state tracker.StoryState) (Story, error)
+
+	AddStoryLabel(id int, label string) error
+	RemoveStoryLabel(id int, label tracker.Label) error
+
+	StoryComments(id int) ([]StoryComment, error)
+	CreateStoryComment(id int, text string) (StoryComment, error)
+
+	// Members returns the people who may own or comment on stories, for
+	// naming them on issues.
+	Members() ([]tracker.Person, error)
+}
+
+// Story is a story in any backend, with the fields go-tracker's Story leaves
+// out.
+type Story struct {
+	tracker.Story
+
+	// Estimate is nil for stories that have not been estimated.
+	Estimate *float64 `json:"estimate,omitempty"`
+
+	OwnerIDs []int `json:"owner_ids,omitempty"`
+}
+
+// StoryComment is a comment on a story. go-tracker's Comment only has the
+// text.
+type StoryComment struct {
+	ID       int    `json:"id,omitempty"`
+	StoryID  int    `json:"story_id,omitempty"`
+	PersonID int    `json:"person_id,omitempty"`
+	Text     string `json:"text,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// ProjectLabels is implemented by backends whose labels outlive the stories
+// they are on, so that unused labels can be garbage collected.
+type ProjectLabels interface {
+	Labels() ([]tracker.Label, error)
+	DeleteLabel(label tracker.Label) error
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// ClosePolicy determines when an issue whose stories have all been accepted
+// is closed.
+type ClosePolicy string
+
+const (
+	// ClosePolicyAccepted closes issues once all of their stories have been
+	// accepted.
+	ClosePolicyAccepted ClosePolicy = "accepted"
+
+	// ClosePolicyPullRequestMerged additionally waits for a linked pull
+	// request to be merged.
+	ClosePolicyPullRequestMerged ClosePolicy = "pull-request-merged"
+
+	// ClosePolicyNever leaves issues open.
+	ClosePolicyNever ClosePolicy = "never"
+)
+
+// closedCommentMarker is hidden in the comment left when closing an issue, so
+// that the issue is recognized as reopened rather than closed again.
+const closedCommentMarker = "<!-- tracksuit:closed -->"
+
+// closingCommentMarker is hidden in the closed comment until the issue has
+// actually been closed, so that an issue that failed to close is closed by
+// the next sync rather than taken for reopened.
+const closingCommentMarker = "<!-- tracksuit:closing -->"
+
+func ValidateClosePolicy(policy ClosePolicy, linkPullRequests bool) error {
+	switch policy {
+	case "", ClosePolicyAccepted, ClosePolicyNever:
+		return nil
+	case ClosePolicyPullRequestMerged:
+		if !linkPullRequests {
+			return fmt.Errorf("close policy '%s' requires linking pull requests", policy)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown close policy '%s'", policy)
+	}
+}
+
+// closeDecision is whether an issue would be closed, and if not, what is
+// keeping it open.
+type closeDecision int
+
+const (
+	// closeNotReady means closing is disabled or not all of the issue's
+	// stories have been accepted.
+	closeNotReady closeDecision = iota
+	closeKeptOpen
+	closeAwaitingMerge
+	closeReopened
+	closeAwaitingGracePeriod
+	closeNow
+)
+
+// maybeCloseIssue closes the issue if all of its stories have been accepted
+// and the close policy allows it.
+func (syncer *Syncer) maybeCloseIssue(
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+	comments []*github.IssueComment,
+) error {
+	logger := syncer.issueLogger(repo, issue)
+
+	syncer.setPendingClose(repo, issue, false)
+
+	decision, err := syncer.decideClose(repo, issue, stories, comments)
+	if err != nil {
+		return err
+	}
+
+	switch decision {
+	case closeKeptOpen:
+		logger.Debug("all stories are accepted, but issue is labelled to keep open", "label", syncer.KeepOpenLabel)
+
+	case closeAwaitingMerge:
+		logger.Debug("all stories are accepted; waiting for a linked pull request to merge")
+
+	case closeReopened:
+		logger.Info("issue was reopened after being closed; leaving it open")
+
+	case closeAwaitingGracePeriod:
+		wait := syncer.CloseGracePeriod - time.Since(stories.LastAccepted())
+		logger.Info("all stories are accepted; waiting to close issue", "wait", wait.Round(time.Second))
+
+		// incremental syncs won't otherwise revisit the issue once the grace
+		// period is up
+		syncer.setPendingClose(repo, issue, true)
+
+	case closeNow:
+		logger.Info("all stories are accepted; closing issue")
+
+		return syncer.closeIssue(repo, issue, stories, comments)
+	}
+
+	return nil
+}
+
+// decideClose determines whether the issue should be closed now, without
+// changing anything.
+func (syncer *Syncer) decideClose(
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+	comments []*github.IssueComment,
+) (closeDecision, error) {
+	if !syncer.CloseIssues || syncer.ClosePolicy == ClosePolicyNever {
+		return closeNotReady, nil
+	}
+
+	if len(stories) == 0 || !stories.AllAccepted() {
+		return closeNotReady, nil
+	}
+
+	if syncer.KeepOpenLabel != "" && issueHasLabel(issue, syncer.KeepOpenLabel) {
+		return closeKeptOpen, nil
+	}
+
+	if syncer.ClosePolicy == ClosePolicyPullRequestMerged && !syncer.linkedPullRequests(repo, issue, stories).AnyMerged() {
+		return closeAwaitingMerge, nil
+	}
+
+	closedComment, err := syncer.closingComment(repo, issue, stories, comments)
+	if err != nil {
+		return closeNotReady, err
+	}
+
+	if closedComment != nil {
+		if isClosingComment(*closedComment.Body) {
+			// an earlier sync commented, but failed to close the issue
+			return closeNow, nil
+		}
+
+		return closeReopened, nil
+	}
+
+	if time.Since(stories.LastAccepted()) < syncer.CloseGracePeriod {
+		return closeAwaitingGracePeriod, nil
+	}
+
+	return closeNow, nil
+}
+
+// closingComment returns the comment left when closing the issue since its
+// stories were last accepted, if any. The comment is left before the issue is
+// closed, so it may still be marked as closing.
+func (syncer *Syncer) closingComment(
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+	comments []*github.IssueComment,
+) (*github.IssueComment, error) {
+	currentUser, err := syncer.currentUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current user: %s", err)
+	}
+
+	// comments left before the marker was introduced can only be recognized
+	// by their content
+	legacyMessage, err := syncer.renderComment(syncer.closedCommentTemplate(), repo, issue, stories)
+	if err != nil {
+		return nil, fmt.Errorf("error building comment body: %s", err)
+	}
+
+	lastAccepted := stories.LastAccepted()
+
+	for _, comment := range comments {
+		if *comment.User.ID != *currentUser.ID {
+			continue
+		}
+
+		if comment.CreatedAt == nil || comment.CreatedAt.Before(lastAccepted) {
+			continue
+		}
+
+		if isClosedComment(*comment.Body) || isClosingComment(*comment.Body) || *comment.Body == legacyMessage {
+			return comment, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// wasReopened returns whether the issue was reopened after being closed for
+// its stories being accepted.
+func (syncer *Syncer) wasReopened(
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+	comments []*github.IssueComment,
+) (bool, error) {
+	if len(stories) == 0 || !stories.AllAccepted() {
+		return false, nil
+	}
+
+	closedComment, err := syncer.closingComment(repo, issue, stories, comments)
+	if err != nil {
+		return false, err
+	}
+
+	return closedComment != nil && !isClosingComment(*closedComment.Body), nil
+}
+
+func isClosedComment(body string) bool {
+	return strings.Contains(body, closedCommentMarker)
+}
+
+func isClosingComment(body string) bool {
+	return strings.Contains(body, closingCommentMarker)
+}
+
+func (syncer *Syncer) setPendingClose(repo *Repository, issue *github.Issue, pending bool) {
+	if syncer.State == nil || syncer.Plan != nil {
+		return
+	}
+
+	syncer.State.SetPendingClose(syncer.stateKey(), syncer.trackerLabelForIssue(repo, issue), pending)
+}
+
+// closeIssue leaves the closed comment and then closes the issue, so that the
+// issue is never left closed without saying why. The comment is marked as
+// closing until the issue is closed, so that a failure to close is retried
+// without leaving the comment twice.
+func (syncer *Syncer) closeIssue(
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+	comments []*github.IssueComment,
+) error {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionCloseIssue, syncer.trackerLabelForIssue(repo, issue), fmt.Sprintf("%d accepted stories", len(stories)))
+		return nil
+	}
+
+	comment, err := syncer.closingComment(repo, issue, stories, comments)
+	if err != nil {
+		return err
+	}
+
+	if comment == nil || !isClosingComment(*comment.Body) {
+		closedMessage, err := syncer.renderComment(syncer.closedCommentTemplate(), repo, issue, stories)
+		if err != nil {
+			return fmt.Errorf("error building comment body: %s", err)
+		}
+
+		comment, err = syncer.Source.CreateComment(repo, *issue.Number, closedMessage+"\n\n"+closingCommentMarker)
+		if err != nil {
+			return fmt.Errorf("failed to leave closed message: %s", err)
+		}
+
+		syncer.count(MetricCommentsCreated)
+	}
+
+	err = syncer.Source.CloseIssue(repo, *issue.Number)
+	if err != nil {
+		return fmt.Errorf("failed to close issue: %s", err)
+	}
+
+	syncer.count(MetricIssuesClosed)
+
+	closedBody := strings.Replace(*comment.Body, closingCommentMarker, closedCommentMarker, 1)
+
+	_, err = syncer.Source.EditComment(repo, *issue.Number, *comment.ID, closedBody)
+	if err != nil {
+		return fmt.Errorf("failed to mark closed message: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+// countingTransport counts the requests made with each method and path.
+type countingTransport struct {
+	Base http.RoundTripper
+
+	Requests map[string]int
+}
+
+func (transport *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.Requests[req.Method+" "+req.URL.Path]++
+	return transport.Base.RoundTrip(req)
+}
+
+func (fixture *syncFixture) useGitHubTransport(transport http.RoundTripper) {
+	client := github.NewClient(&http.Client{Transport: transport})
+	client.BaseURL, _ = url.Parse(fixture.GitHub.URL + "/")
+
+	fixture.Syncer.Source = &GitHubSource{Client: client}
+}
+
+func TestSyncRetriesClosingWithoutCommentingTwice(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+
+	fixture.useGitHubTransport(failingTransport{
+		Method: "PATCH",
+		Path:   "/repos/" + testOrganization + "/" + testRepo + "/issues/1",
+	})
+
+	if err := fixture.Syncer.SyncIssuesAndStories(); err == nil {
+		t.Fatal("expected closing the issue to fail")
+	}
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected the issue to still be open, got %s", state)
+	}
+
+	comments := fixture.botComments(1)
+	if len(comments) != 2 || !isClosingComment(*comments[1].Body) {
+		t.Fatalf("expected the closed comment to be left first, got %d comments", len(comments))
+	}
+
+	fixture.useGitHubTransport(http.DefaultTransport)
+
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "closed" {
+		t.Fatalf("expected the issue to be closed, got %s", state)
+	}
+
+	// no chore for a reopened issue
+	fixture.stories(t, 1, 1)
+
+	comments = fixture.botComments(1)
+	if len(comments) != 2 {
+		t.Fatalf("expected the closed comment to be reused, got %d comments", len(comments))
+	}
+
+	if !isClosedComment(*comments[1].Body) || isClosingComment(*comments[1].Body) {
+		t.Fatalf("expected the comment to be marked closed:\n%s", *comments[1].Body)
+	}
+}
+
+func TestSyncFetchesIssueCommentsOnce(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.MirrorComments = true
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+
+	transport := &countingTransport{Base: http.DefaultTransport, Requests: map[string]int{}}
+	fixture.useGitHubTransport(transport)
+
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "closed" {
+		t.Fatalf("expected the issue to be closed, got %s", state)
+	}
+
+	if fetches := transport.Requests["GET /repos/"+testOrganization+"/"+testRepo+"/issues/1/comments"]; fetches != 1 {
+		t.Fatalf("expected comments to be fetched once, got %d", fetches)
+	}
+}
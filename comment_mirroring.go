@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// publicCommentTag marks Tracker comments that should be mirrored onto the
+// GitHub issue.
+const publicCommentTag = "#public"
+
+// mirrored comments carry a hidden marker naming the comment they came from,
+// so that they are only ever mirrored once and never mirrored back
+var mirroredCommentPattern = regexp.MustCompile(`<!-- tracksuit:(github|tracker)-comment:(\d+) -->`)
+
+func mirroredCommentMarker(source string, id int) string {
+	return fmt.Sprintf("<!-- tracksuit:%s-comment:%d -->", source, id)
+}
+
+// mirroredCommentSource returns where a comment was mirrored from, if it was
+// mirrored at all.
+func mirroredCommentSource(text string) (string, int, bool) {
+	match := mirroredCommentPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", 0, false
+	}
+
+	id, err := strconv.Atoi(match[2])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return match[1], id, true
+}
+
+func isPublicComment(text string) bool {
+	for _, word := range strings.Fields(text) {
+		if strings.EqualFold(strings.TrimRight(word, ".,:;!?"), publicCommentTag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mirroredStory is what was last seen of a story's comments, so that they
+// needn't be fetched again until the story or its issue changes.
+type mirroredStory struct {
+	// UpdatedAt is when the story had last been updated as of then.
+	UpdatedAt time.Time
+
+	// IssueComments are the IDs of the issue comments mirrored onto it.
+	IssueComments map[int]bool
+}
+
+// mirrorComments copies new comments on the issue onto each of its stories,
+// and public comments on the stories back onto the issue.
+//
+// Only issue comments made since a story was created are copied onto it, so
+// that a story created later, e.g. for a reopened issue, doesn't receive the
+// issue's whole history. Stories whose comments were already mirrored are
+// skipped until either side has something new.
+func (syncer *Syncer) mirrorComments(
+	repo *Repository,
+	issue *github.Issue,
+	issueStories StorySet,
+	issueComments []*github.IssueComment,
+) error {
+	currentUser, err := syncer.currentUser()
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %s", err)
+	}
+
+	mirroredToIssue := map[int]bool{}
+	for _, comment := range issueComments {
+		source, id, mirrored := mirroredCommentSource(*comment.Body)
+		if mirrored && source == "tracker" {
+			mirroredToIssue[id] = true
+		}
+	}
+
+	for _, story := range issueStories {
+		// stories that would have been created by a dry run have no comments
+		if story.ID == 0 {
+			continue
+		}
+
+		var toMirror []*github.IssueComment
+		for _, comment := range issueComments {
+			if *comment.User.ID == *currentUser.ID {
+				continue
+			}
+
+			if story.CreatedAt != nil && comment.CreatedAt != nil && comment.CreatedAt.Before(*story.CreatedAt) {
+				continue
+			}
+
+			toMirror = append(toMirror, comment)
+		}
+
+		if syncer.alreadyMirrored(story, toMirror) {
+			continue
+		}
+
+		storyComments, err := syncer.Backend.StoryComments(story.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch comments for #%d: %s", story.ID, err)
+		}
+
+		mirroredToStory := map[int]bool{}
+		for _, comment := range storyComments {
+			source, id, mirrored := mirroredCommentSource(comment.Text)
+			if mirrored && source == "github" {
+				mirroredToStory[id] = true
+			}
+		}
+
+		for _, comment := range toMirror {
+			if mirroredToStory[*comment.ID] {
+				continue
+			}
+
+			if err := syncer.mirrorIssueComment(story, comment); err != nil {
+				return fmt.Errorf("failed to mirror comment %s: %s", *comment.HTMLURL, err)
+			}
+
+			mirroredToStory[*comment.ID] = true
+		}
+
+		for _, comment := range storyComments {
+			if _, _, mirrored := mirroredCommentSource(comment.Text); mirrored {
+				continue
+			}
+
+			if mirroredToIssue[comment.ID] || !isPublicComment(comment.Text) {
+				continue
+			}
+
+			if err := syncer.mirrorStoryComment(repo, issue, story, comment); err != nil {
+				return fmt.Errorf("failed to mirror comment on #%d: %s", story.ID, err)
+			}
+
+			mirroredToIssue[comment.ID] = true
+		}
+
+		syncer.rememberMirrored(story, mirroredToStory)
+	}
+
+	return nil
+}
+
+// alreadyMirrored returns whether the story hasn't changed since its
+// comments were last mirrored, and the issue comments have all been mirrored
+// onto it.
+func (syncer *Syncer) alreadyMirrored(story Story, issueComments []*github.IssueComment) bool {
+	if story.UpdatedAt == nil {
+		return false
+	}
+
+	syncer.mirroredStoriesLock.Lock()
+	defer syncer.mirroredStoriesLock.Unlock()
+
+	mirrored, found := syncer.mirroredStories[story.ID]
+	if !found || !mirrored.UpdatedAt.Equal(*story.UpdatedAt) {
+		return false
+	}
+
+	for _, comment := range issueComments {
+		if !mirrored.IssueComments[*comment.ID] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (syncer *Syncer) rememberMirrored(story Story, issueComments map[int]bool) {
+	// nothing was actually mirrored by a dry run
+	if story.UpdatedAt == nil || syncer.Plan != nil {
+		return
+	}
+
+	syncer.mirroredStoriesLock.Lock()
+	defer syncer.mirroredStoriesLock.Unlock()
+
+	if syncer.mirroredStories == nil {
+		syncer.mirroredStories = map[int]mirroredStory{}
+	}
+
+	syncer.mirroredStories[story.ID] = mirroredStory{
+		UpdatedAt:     *story.UpdatedAt,
+		IssueComments: issueComments,
+	}
+}
+
+func (syncer *Syncer) mirrorIssueComment(story Story, comment *github.IssueComment) error {
+	text := fmt.Sprintf(
+		"[%s commented on GitHub](%s):\n\n%s\n\n%s",
+		*comment.User.Login,
+		*comment.HTMLURL,
+		*comment.Body,
+		mirroredCommentMarker("github", *comment.ID),
+	)
+
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionCreateStoryComment, fmt.Sprintf("#%d", story.ID), *comment.HTMLURL)
+		return nil
+	}
+
+	_, err := syncer.Backend.CreateStoryComment(story.ID, text)
+	if err != nil {
+		return err
+	}
+
+	syncer.logger().Info("mirrored issue comment", "story", story.ID, "url", *comment.HTMLURL)
+
+	return nil
+}
+
+func (syncer *Syncer) mirrorStoryComment(
+	repo *Repository,
+	issue *github.Issue,
+	story Story,
+	comment StoryComment,
+) error {
+	author := "Someone"
+	if comment.PersonID != 0 {
+		names, err := syncer.memberNames([]int{comment.PersonID})
+		if err != nil {
+			return fmt.Errorf("failed to fetch comment author: %s", err)
+		}
+
+		if len(names) > 0 {
+			author = names[0]
+		}
+	}
+
+	body := fmt.Sprintf(
+		"%s commented on [#%d](%s):\n\n%s\n\n%s",
+		author,
+		story.ID,
+		story.URL,
+		comment.Text,
+		mirroredCommentMarker("tracker", comment.ID),
+	)
+
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionCreateComment, syncer.trackerLabelForIssue(repo, issue), fmt.Sprintf("comment %d on #%d", comment.ID, story.ID))
+		return nil
+	}
+
+	createdComment, err := syncer.Source.CreateComment(repo, *issue.Number, body)
+	if err != nil {
+		return err
+	}
+
+	syncer.count(MetricCommentsCreated)
+
+	syncer.issueLogger(repo, issue).Info("mirrored story comment", "story", story.ID, "url", *createdComment.HTMLURL)
+
+	return nil
+}
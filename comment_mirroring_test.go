@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// storyCommentListings returns how many times the story's comments were
+// listed through the transport.
+func storyCommentListings(transport *countingTransport, storyID int) int {
+	listings := 0
+	for request, count := range transport.Requests {
+		if strings.HasPrefix(request, "GET ") && strings.HasSuffix(request, "/stories/"+strconv.Itoa(storyID)+"/comments") {
+			listings += count
+		}
+	}
+
+	return listings
+}
+
+// mirroredOnto returns how many of the story's comments mirror the given
+// issue comment.
+func (fixture *syncFixture) mirroredOnto(storyID int, body string) int {
+	mirrored := 0
+	for _, comment := range fixture.Tracker.Comments(storyID) {
+		if strings.Contains(comment.Text, body) {
+			mirrored++
+		}
+	}
+
+	return mirrored
+}
+
+func TestMirrorCommentsOnlyCopiesCommentsMadeSinceTheStory(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.MirrorComments = true
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddComment(testOrganization, testRepo, 1, "before the story")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	fixture.GitHub.AddComment(testOrganization, testRepo, 1, "after the story")
+
+	fixture.sync(t)
+	fixture.sync(t)
+
+	if mirrored := fixture.mirroredOnto(story.ID, "before the story"); mirrored != 0 {
+		t.Errorf("expected the comment made before the story not to be mirrored, got %d copies", mirrored)
+	}
+
+	if mirrored := fixture.mirroredOnto(story.ID, "after the story"); mirrored != 1 {
+		t.Errorf("expected the comment made after the story to be mirrored once, got %d copies", mirrored)
+	}
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+	fixture.sync(t)
+
+	fixture.GitHub.SetIssueState(testOrganization, testRepo, 1, "open")
+	fixture.sync(t)
+
+	chore := fixture.stories(t, 1, 2)[1]
+
+	if comments := fixture.Tracker.Comments(chore.ID); len(comments) != 0 {
+		t.Errorf("expected the reopened issue's history not to be copied onto its new chore, got %+v", comments)
+	}
+}
+
+func TestMirrorCommentsSkipsStoriesWithNothingNew(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.MirrorComments = true
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	transport := &countingTransport{Base: http.DefaultTransport, Requests: map[string]int{}}
+	fixture.Syncer.Backend = NewTrackerBackend(fixture.Tracker.URL, testProjectID, "some-token", &http.Client{Transport: transport})
+
+	fixture.sync(t)
+
+	if listings := storyCommentListings(transport, story.ID); listings != 0 {
+		t.Fatalf("expected the comments of an unchanged story not to be listed, got %d listings", listings)
+	}
+
+	fixture.GitHub.AddComment(testOrganization, testRepo, 1, "me too")
+
+	fixture.sync(t)
+
+	if listings := storyCommentListings(transport, story.ID); listings != 1 {
+		t.Fatalf("expected the story's comments to be listed for the new issue comment, got %d listings", listings)
+	}
+
+	if mirrored := fixture.mirroredOnto(story.ID, "me too"); mirrored != 1 {
+		t.Fatalf("expected the new issue comment to be mirrored once, got %d copies", mirrored)
+	}
+
+	if _, err := fixture.Syncer.Backend.CreateStoryComment(story.ID, "fixed in the next release #public"); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.sync(t)
+
+	var mirroredBack int
+	for _, comment := range fixture.GitHub.Comments(testOrganization, testRepo, 1) {
+		if strings.Contains(*comment.Body, "fixed in the next release") {
+			mirroredBack++
+		}
+	}
+
+	if mirroredBack != 1 {
+		t.Fatalf("expected the public story comment to be mirrored onto the issue once, got %d copies", mirroredBack)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+// CommentData is what the status and closed comment templates are rendered
+// with.
+type CommentData struct {
+	Issue CommentIssue
+	Repo  CommentRepo
+
+	// Stories are all stories labelled for the issue.
+	Stories []CommentStory
+
+	// PullRequests reference the issue or its stories. Only populated when
+	// linking pull requests.
+	PullRequests []CommentPullRequest
+
+	// Tool names what the stories are kept in, e.g. "Pivotal Tracker", "Jira",
+	// or "Linear".
+	Tool string
+
+	// ProjectURL links to the project the stories belong to.
+	ProjectURL string
+}
+
+type CommentIssue struct {
+	Number int
+	Title  string
+	URL    string
+
+	// Author is the login of the user that opened the issue.
+	Author string
+}
+
+type CommentRepo struct {
+	Owner string
+	Name  string
+	URL   string
+}
+
+type CommentPullRequest struct {
+	Number int
+	Title  string
+	URL    string
+	Merged bool
+}
+
+type CommentStory struct {
+	ID    int
+	Name  string
+	URL   string
+	State string
+	Type  string
+
+	// Estimate is nil for stories that have not been estimated.
+	Estimate *float64
+
+	// Owners are the names of the story's owners.
+	Owners []string
+
+	AcceptedAt *time.Time
+}
+
+// LoadCommentTemplate parses the template at path and makes sure it can be
+// rendered, so that mistakes are caught before syncing anything.
+func LoadCommentTemplate(path string) (*template.Template, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tmpl.Execute(ioutil.Discard, sampleCommentData); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %s", path, err)
+	}
+
+	return tmpl, nil
+}
+
+var sampleEstimate = 2.0
+
+var sampleCommentData = CommentData{
+	Issue: CommentIssue{
+		Number: 123,
+		Title:  "something is broken",
+		URL:    "https://github.com/example/repo/issues/123",
+		Author: "someone",
+	},
+	Repo: CommentRepo{
+		Owner: "example",
+		Name:  "repo",
+		URL:   "https://github.com/example/repo",
+	},
+	Stories: []CommentStory{
+		{
+			ID:       1234,
+			Name:     "something is broken",
+			URL:      "https://www.pivotaltracker.com/story/show/1234",
+			State:    tracker.StoryStateStarted,
+			Type:     tracker.StoryTypeBug,
+			Estimate: &sampleEstimate,
+			Owners:   []string{"Some One"},
+		},
+	},
+	PullRequests: []CommentPullRequest{
+		{
+			Number: 124,
+			Title:  "fix something being broken",
+			URL:    "https://github.com/example/repo/pull/124",
+			Merged: true,
+		},
+	},
+	Tool:       "Pivotal Tracker",
+	ProjectURL: "https://www.pivotaltracker.com/n/projects/1",
+}
+
+func (syncer *Syncer) statusCommentTemplate() *template.Template {
+	if syncer.StatusCommentTemplate != nil {
+		return syncer.StatusCommentTemplate
+	}
+
+	return storyStateCommentTemplate
+}
+
+func (syncer *Syncer) closedCommentTemplate() *template.Template {
+	if syncer.ClosedCommentTemplate != nil {
+		return syncer.ClosedCommentTemplate
+	}
+
+	return issueClosedCommentTemplate
+}
+
+func (syncer *Syncer) renderComment(
+	tmpl *template.Template,
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+) (string, error) {
+	data, err := syncer.commentData(repo, issue, stories)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func (syncer *Syncer) commentData(
+	repo *Repository,
+	issue *github.Issue,
+	stories StorySet,
+) (CommentData, error) {
+	data := CommentData{
+		Issue: CommentIssue{
+			Number: *issue.Number,
+			Title:  *issue.Title,
+			URL:    *issue.HTMLURL,
+			Author: *issue.User.Login,
+		},
+		Repo: CommentRepo{
+			Owner: *repo.Owner.Login,
+			Name:  *repo.Name,
+		},
+		Tool:       syncer.Backend.Tool(),
+		ProjectURL: syncer.Backend.ProjectURL(),
+	}
+
+	// repositories built from story labels only have an owner and name
+	if repo.HTMLURL != nil {
+		data.Repo.URL = *repo.HTMLURL
+	}
+
+	for _, story := range stories {
+		owners, err := syncer.memberNames(story.OwnerIDs)
+		if err != nil {
+			return CommentData{}, fmt.Errorf("failed to fetch story owners: %s", err)
+		}
+
+		data.Stories = append(data.Stories, CommentStory{
+			ID:         story.ID,
+			Name:       story.Name,
+			URL:        story.URL,
+			State:      string(story.State),
+			Type:       string(story.Type),
+			Estimate:   story.Estimate,
+			Owners:     owners,
+			AcceptedAt: story.AcceptedAt,
+		})
+	}
+
+	for _, pr := range syncer.linkedPullRequests(repo, issue, stories) {
+		data.PullRequests = append(data.PullRequests, CommentPullRequest{
+			Number: pr.Number,
+			Title:  pr.Title,
+			URL:    pr.URL,
+			Merged: pr.Merged,
+		})
+	}
+
+	return data, nil
+}
+
+// memberNames looks up the names of project members, refreshing the cached
+// members if someone new shows up. People who still aren't members after a
+// refresh, e.g. because they've left the project, are remembered so that they
+// don't cause a refresh every time.
+func (syncer *Syncer) memberNames(ids []int) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if syncer.unknownMembers(ids) {
+		// fetched without holding the lock, so that other issues needn't wait
+		members, err := syncer.Backend.Members()
+		if err != nil {
+			return nil, err
+		}
+
+		syncer.cacheMembers(members, ids)
+	}
+
+	syncer.cachedMembersLock.Lock()
+	defer syncer.cachedMembersLock.Unlock()
+
+	var names []string
+	for _, id := range ids {
+		if person, found := syncer.cachedMembers[id]; found {
+			names = append(names, person.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// unknownMembers returns whether any of the people are neither cached
+// members nor known not to be members.
+func (syncer *Syncer) unknownMembers(ids []int) bool {
+	syncer.cachedMembersLock.Lock()
+	defer syncer.cachedMembersLock.Unlock()
+
+	for _, id := range ids {
+		if _, found := syncer.cachedMembers[id]; !found && !syncer.nonMembers[id] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheMembers replaces the cached members, noting which of the people
+// looked up aren't among them.
+func (syncer *Syncer) cacheMembers(members []tracker.Person, ids []int) {
+	syncer.cachedMembersLock.Lock()
+	defer syncer.cachedMembersLock.Unlock()
+
+	syncer.cachedMembers = map[int]tracker.Person{}
+	for _, person := range members {
+		syncer.cachedMembers[person.ID] = person
+	}
+
+	syncer.nonMembers = map[int]bool{}
+	for _, id := range ids {
+		if _, found := syncer.cachedMembers[id]; !found {
+			syncer.nonMembers[id] = true
+		}
+	}
+}
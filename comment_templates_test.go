@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/xoebus/go-tracker"
+)
+
+func TestDefaultCommentsNameTheBackendsTool(t *testing.T) {
+	data := sampleCommentData
+	data.Tool = "Jira"
+
+	buf := new(bytes.Buffer)
+	if err := storyStateCommentTemplate.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "We use Jira") || strings.Contains(buf.String(), "Tracker") {
+		t.Fatalf("expected the status comment to name Jira alone:\n%s", buf.String())
+	}
+}
+
+func TestStatusCommentsNameOwnersWithoutRefetchingNonMembers(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.StatusCommentTemplate = template.Must(template.New("status").Parse(
+		"{{range .Stories}}owned by {{range .Owners}}{{.}};{{end}}{{end}}",
+	))
+
+	fixture.Tracker.AddMember(tracker.Person{ID: 1, Name: "Some One"})
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	fixture.sync(t)
+
+	// person 2 has left the project
+	for number := 1; number <= 2; number++ {
+		story := fixture.stories(t, number, 1)[0]
+		fixture.Tracker.SetStoryOwners(story.ID, 1, 2)
+	}
+
+	transport := &countingTransport{Base: http.DefaultTransport, Requests: map[string]int{}}
+	fixture.Syncer.Backend = NewTrackerBackend(fixture.Tracker.URL, testProjectID, "some-token", &http.Client{Transport: transport})
+
+	fixture.sync(t)
+	fixture.sync(t)
+
+	for number := 1; number <= 2; number++ {
+		comments := fixture.botComments(number)
+		if len(comments) != 1 || *comments[0].Body != "owned by Some One;" {
+			t.Fatalf("expected the status comment on #%d to name the member, got %+v", number, comments)
+		}
+	}
+
+	listings := 0
+	for request, count := range transport.Requests {
+		if strings.HasSuffix(request, "/memberships") {
+			listings += count
+		}
+	}
+
+	if listings != 1 {
+		t.Fatalf("expected the members to be listed once, got %d listings", listings)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/xoebus/go-tracker"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config routes any number of GitHub organizations, GitLab groups, or Gitea
+// organizations to Tracker, Jira, or Linear projects.
+type Config struct {
+	Mappings []Mapping `yaml:"mappings"`
+}
+
+// Mapping syncs the issues of a GitHub organization, GitLab group, or Gitea
+// organization with a Tracker, Jira, or Linear project.
+type Mapping struct {
+	// GitHubOrganization, GitLabGroup, or GiteaOrganization is where the
+	// issues are. GitLab and Gitea connection settings are given with the
+	// --gitlab-* and --gitea-* flags.
+	GitHubOrganization string `yaml:"github_organization"`
+	GitLabGroup        string `yaml:"gitlab_group"`
+	GiteaOrganization  string `yaml:"gitea_organization"`
+
+	// GitHubRepositories and GitHubExcludeRepositories are names, glob
+	// patterns, or "topic:NAME" filters, whichever forge the issues are on.
+	GitHubRepositories        []string `yaml:"github_repositories"`
+	GitHubExcludeRepositories []string `yaml:"github_exclude_repositories"`
+
+	// IncludePrivate, SkipArchived, and SkipForks override --include-private,
+	// --skip-archived, and --skip-forks for this mapping.
+	IncludePrivate *bool `yaml:"include_private"`
+	SkipArchived   *bool `yaml:"skip_archived"`
+	SkipForks      *bool `yaml:"skip_forks"`
+
+	// TrackerProjectID, JiraProject, or LinearTeam is the project to sync
+	// with. Jira and Linear connection settings are given with the --jira-*
+	// and --linear-* flags.
+	TrackerProjectID int    `yaml:"tracker_project_id"`
+	JiraProject      string `yaml:"jira_project"`
+	LinearTeam       string `yaml:"linear_team"`
+
+	AdditionalLabels map[string]string `yaml:"labels"`
+
+	// StoryTypeLabels override --story-type-label for this mapping.
+	StoryTypeLabels StoryTypeLabels `yaml:"story_type_labels"`
+
+	// StateLabels and StateLabelAggregation override --state-label and
+	// --state-label-aggregation for this mapping.
+	StateLabels           map[tracker.StoryState]string `yaml:"state_labels"`
+	StateLabelAggregation StateAggregation              `yaml:"state_label_aggregation"`
+
+	// GCLabels, LinkPullRequests, and MirrorComments override --gc-labels,
+	// --link-pull-requests, and --mirror-comments for this mapping.
+	GCLabels         *bool `yaml:"gc_labels"`
+	LinkPullRequests *bool `yaml:"link_pull_requests"`
+	MirrorComments   *bool `yaml:"mirror_comments"`
+
+	// PullRequestLookback overrides --pull-request-lookback for this mapping.
+	PullRequestLookback *time.Duration `yaml:"pull_request_lookback"`
+
+	// DedupePolicy and MaxDupeDeletions override --dedupe-policy and
+	// --max-dupe-deletions for this mapping.
+	DedupePolicy     DedupePolicy `yaml:"dedupe_policy"`
+	MaxDupeDeletions *int         `yaml:"max_dupe_deletions"`
+
+	// OrphanPolicy, OrphanState, and OrphanLabel override --orphan-policy,
+	// --orphan-state, and --orphan-label for this mapping.
+	OrphanPolicy OrphanPolicy       `yaml:"orphan_policy"`
+	OrphanState  tracker.StoryState `yaml:"orphan_state"`
+	OrphanLabel  string             `yaml:"orphan_label"`
+
+	// CloseIssues defaults to true when omitted.
+	CloseIssues *bool `yaml:"close_issues"`
+
+	// ClosePolicy, CloseGracePeriod, and KeepOpenLabel override
+	// --close-policy, --close-grace-period, and --keep-open-label for this
+	// mapping.
+	ClosePolicy      ClosePolicy    `yaml:"close_policy"`
+	CloseGracePeriod *time.Duration `yaml:"close_grace_period"`
+	KeepOpenLabel    string         `yaml:"keep_open_label"`
+
+	// StatusCommentTemplate and ClosedCommentTemplate are paths to template
+	// files, relative to the config file.
+	StatusCommentTemplate string `yaml:"status_comment_template"`
+	ClosedCommentTemplate string `yaml:"closed_comment_template"`
+}
+
+func LoadConfig(path string) (Config, error) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(payload, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %s", path, err)
+	}
+
+	for i, mapping := range config.Mappings {
+		mapping.StatusCommentTemplate = relativeTo(path, mapping.StatusCommentTemplate)
+		mapping.ClosedCommentTemplate = relativeTo(path, mapping.ClosedCommentTemplate)
+		config.Mappings[i] = mapping
+	}
+
+	return config, nil
+}
+
+func (config Config) Validate() error {
+	if len(config.Mappings) == 0 {
+		return errors.New("no mappings configured")
+	}
+
+	for i, mapping := range config.Mappings {
+		organizations := 0
+		for _, given := range []bool{mapping.GitHubOrganization != "", mapping.GitLabGroup != "", mapping.GiteaOrganization != ""} {
+			if given {
+				organizations++
+			}
+		}
+
+		if organizations == 0 {
+			return fmt.Errorf("mapping %d: missing github_organization, gitlab_group, or gitea_organization", i)
+		}
+
+		if organizations > 1 {
+			return fmt.Errorf("mapping %d: only one of github_organization, gitlab_group, and gitea_organization may be given", i)
+		}
+
+		projects := 0
+		for _, given := range []bool{mapping.TrackerProjectID != 0, mapping.JiraProject != "", mapping.LinearTeam != ""} {
+			if given {
+				projects++
+			}
+		}
+
+		if projects == 0 {
+			return fmt.Errorf("mapping %d: missing tracker_project_id, jira_project, or linear_team", i)
+		}
+
+		if projects > 1 {
+			return fmt.Errorf("mapping %d: only one of tracker_project_id, jira_project, and linear_team may be given", i)
+		}
+
+		if mapping.TrackerProjectID == 0 && isTrue(mapping.GCLabels) {
+			return fmt.Errorf("mapping %d: gc_labels is only supported with tracker_project_id", i)
+		}
+
+		if err := ValidateRepoPatterns(mapping.GitHubRepositories); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err)
+		}
+
+		if err := ValidateRepoPatterns(mapping.GitHubExcludeRepositories); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err)
+		}
+
+		if err := ValidateStateLabels(mapping.StateLabels, mapping.StateLabelAggregation); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err)
+		}
+
+		// whether pull requests are linked may be left to --link-pull-requests,
+		// which is checked once the flags are applied
+		if err := ValidateClosePolicy(mapping.ClosePolicy, mapping.LinkPullRequests == nil || *mapping.LinkPullRequests); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err)
+		}
+
+		if err := ValidateDedupePolicy(mapping.DedupePolicy); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err)
+		}
+
+		if err := ValidateOrphanPolicy(mapping.OrphanPolicy, mapping.OrphanState); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err)
+		}
+
+		for _, typeLabel := range mapping.StoryTypeLabels {
+			if err := typeLabel.Validate(); err != nil {
+				return fmt.Errorf("mapping %d: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (mapping Mapping) ShouldCloseIssues() bool {
+	return mapping.CloseIssues == nil || *mapping.CloseIssues
+}
+
+func relativeTo(configPath string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(configPath), path)
+}
+
+// Organization returns the GitHub organization, GitLab group, or Gitea
+// organization whose issues are synced.
+func (mapping Mapping) Organization() string {
+	switch {
+	case mapping.GitLabGroup != "":
+		return mapping.GitLabGroup
+	case mapping.GiteaOrganization != "":
+		return mapping.GiteaOrganization
+	default:
+		return mapping.GitHubOrganization
+	}
+}
+
+func (mapping Mapping) String() string {
+	organization := mapping.Organization()
+	if mapping.GitLabGroup != "" {
+		organization = "gitlab group " + organization
+	} else if mapping.GiteaOrganization != "" {
+		organization = "gitea organization " + organization
+	}
+
+	if mapping.JiraProject != "" {
+		return fmt.Sprintf("%s -> jira project %s", organization, mapping.JiraProject)
+	}
+
+	if mapping.LinearTeam != "" {
+		return fmt.Sprintf("%s -> linear team %s", organization, mapping.LinearTeam)
+	}
+
+	return fmt.Sprintf("%s -> tracker project %d", organization, mapping.TrackerProjectID)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestConfigRejectsMappingFlags(t *testing.T) {
+	cmd := &TracksuitCommand{
+		ConfigFile: writeConfig(t, `
+mappings:
+- github_organization: some-org
+  tracker_project_id: 1234
+`),
+	}
+
+	if _, err := cmd.config(); err != nil {
+		t.Fatalf("expected config to load, got %s", err)
+	}
+
+	cmd.GitHub.Repositories = []string{"some-repo"}
+
+	_, err := cmd.config()
+	if err == nil || !strings.Contains(err.Error(), "--github-repository") {
+		t.Fatalf("expected --github-repository to be rejected, got %v", err)
+	}
+}
+
+func TestConfigMappingsOverrideFlags(t *testing.T) {
+	cmd := &TracksuitCommand{
+		ConfigFile: writeConfig(t, `
+mappings:
+- github_organization: some-org
+  tracker_project_id: 1234
+
+- github_organization: some-other-org
+  tracker_project_id: 5678
+  skip_forks: false
+  mirror_comments: true
+`),
+
+		SkipForks: true,
+	}
+
+	config, err := cmd.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaulted := cmd.withFlags(config.Mappings[0])
+	if !isTrue(defaulted.SkipForks) || isTrue(defaulted.MirrorComments) {
+		t.Fatalf("expected the flags to apply, got skip_forks %v and mirror_comments %v", *defaulted.SkipForks, *defaulted.MirrorComments)
+	}
+
+	overridden := cmd.withFlags(config.Mappings[1])
+	if isTrue(overridden.SkipForks) || !isTrue(overridden.MirrorComments) {
+		t.Fatalf("expected the mapping to win, got skip_forks %v and mirror_comments %v", *overridden.SkipForks, *overridden.MirrorComments)
+	}
+}
+
+func TestConfigMappingsOverrideSyncSettings(t *testing.T) {
+	cmd := &TracksuitCommand{}
+
+	_, err := newParser(cmd).ParseArgs([]string{
+		"--github-token", "some-token",
+		"--tracker-token", "some-token",
+		"--close-grace-period", "1h",
+		"--keep-open-label", "flag-keep-open",
+		"--max-dupe-deletions", "10",
+		"--orphan-label", "flag-orphan",
+		"--pull-request-lookback", "24h",
+		"--config", writeConfig(t, `
+mappings:
+- github_organization: some-org
+  tracker_project_id: 1234
+
+- github_organization: some-other-org
+  tracker_project_id: 5678
+  close_grace_period: 30m
+  keep_open_label: mapping-keep-open
+  max_dupe_deletions: 0
+  orphan_label: mapping-orphan
+  pull_request_lookback: 2h
+`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncers, err := cmd.newSyncers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaulted := syncers[0].Syncer
+	if defaulted.CloseGracePeriod != time.Hour ||
+		defaulted.KeepOpenLabel != "flag-keep-open" ||
+		defaulted.MaxDupeDeletions != 10 ||
+		defaulted.OrphanLabel != "flag-orphan" ||
+		defaulted.PullRequestLookback != 24*time.Hour {
+		t.Errorf("expected the flags to apply, got %+v", defaulted)
+	}
+
+	overridden := syncers[1].Syncer
+	if overridden.CloseGracePeriod != 30*time.Minute ||
+		overridden.KeepOpenLabel != "mapping-keep-open" ||
+		overridden.MaxDupeDeletions != 0 ||
+		overridden.OrphanLabel != "mapping-orphan" ||
+		overridden.PullRequestLookback != 2*time.Hour {
+		t.Errorf("expected the mapping to win, got %+v", overridden)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DedupePolicy determines what happens to stories that duplicate another
+// story for the same issue.
+type DedupePolicy string
+
+const (
+	// DedupePolicyDelete deletes duplicates outright.
+	DedupePolicyDelete DedupePolicy = "delete"
+
+	// DedupePolicyLabel labels duplicates with duplicateStoryLabel and
+	// leaves them for someone to clean up.
+	DedupePolicyLabel DedupePolicy = "label"
+
+	// DedupePolicyMerge moves the comments of duplicates onto the story they
+	// duplicate before deleting them.
+	DedupePolicyMerge DedupePolicy = "merge"
+)
+
+// duplicateStoryLabel marks stories flagged as duplicates. Flagged stories are
+// no longer considered part of their issue.
+const duplicateStoryLabel = "tracksuit-duplicate"
+
+func ValidateDedupePolicy(policy DedupePolicy) error {
+	switch policy {
+	case "", DedupePolicyDelete, DedupePolicyLabel, DedupePolicyMerge:
+		return nil
+	default:
+		return fmt.Errorf("unknown dedupe policy '%s'", policy)
+	}
+}
+
+func (syncer *Syncer) dedupePolicy() DedupePolicy {
+	if syncer.DedupePolicy == "" {
+		return DedupePolicyDelete
+	}
+
+	return syncer.DedupePolicy
+}
+
+// removeDupes deals with each of the issue's duplicate stories according to
+// the dedupe policy. Failures are logged rather than returned so that the
+// issue itself still gets synced.
+func (syncer *Syncer) removeDupes(logger *Logger, label string, issueStories StorySet, dupes StorySet) {
+	for _, dupe := range dupes {
+		dupeLogger := logger.With("story", dupe.ID)
+
+		switch syncer.dedupePolicy() {
+		case DedupePolicyLabel:
+			dupeLogger.Info("flagging dupe")
+
+			if err := syncer.addStoryLabel(dupe, duplicateStoryLabel); err != nil {
+				dupeLogger.Error("failed to flag dupe", err)
+				continue
+			}
+
+			syncer.count(MetricDupesFlagged)
+
+		case DedupePolicyMerge:
+			original, found := issueStories.OriginalOf(dupe)
+			if !found {
+				dupeLogger.Warn("original of dupe not found; leaving it")
+				continue
+			}
+
+			if !syncer.reserveDupeDeletion(dupeLogger) {
+				continue
+			}
+
+			dupeLogger.Info("merging dupe", "original", original.ID)
+
+			if err := syncer.mergeStory(original, dupe); err != nil {
+				dupeLogger.Error("failed to merge dupe", err, "original", original.ID)
+				continue
+			}
+
+			syncer.deleteDupe(dupeLogger, label, dupe)
+
+		default:
+			if !syncer.reserveDupeDeletion(dupeLogger) {
+				continue
+			}
+
+			dupeLogger.Info("removing dupe")
+
+			syncer.deleteDupe(dupeLogger, label, dupe)
+		}
+	}
+}
+
+func (syncer *Syncer) deleteDupe(logger *Logger, label string, dupe Story) {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionDeleteStory, fmt.Sprintf("#%d", dupe.ID), "duplicate of "+label)
+		return
+	}
+
+	if err := syncer.Backend.DeleteStory(dupe.ID); err != nil {
+		logger.Error("failed to remove dupe", err)
+		return
+	}
+
+	syncer.count(MetricDupesDeleted)
+}
+
+// reserveDupeDeletion counts a deletion against MaxDupeDeletions, returning
+// false once the cap for this sync has been reached. Each full sync, and each
+// issue or pull request synced from a webhook, has a cap of its own.
+func (syncer *Syncer) reserveDupeDeletion(logger *Logger) bool {
+	syncer.dupeDeletionsLock.Lock()
+	defer syncer.dupeDeletionsLock.Unlock()
+
+	if syncer.MaxDupeDeletions > 0 && syncer.dupeDeletions >= syncer.MaxDupeDeletions {
+		logger.Warn("dupe deletion cap reached; leaving dupe", "max", syncer.MaxDupeDeletions)
+		return false
+	}
+
+	syncer.dupeDeletions++
+
+	return true
+}
+
+func (syncer *Syncer) resetDupeDeletions() {
+	syncer.dupeDeletionsLock.Lock()
+	syncer.dupeDeletions = 0
+	syncer.dupeDeletionsLock.Unlock()
+}
+
+// movedCommentMarker marks comments moved from a dupe onto its original, so
+// that a merge that fails partway doesn't move them again when retried.
+func movedCommentMarker(id int) string {
+	return fmt.Sprintf("<!-- tracksuit:dupe-comment:%d -->", id)
+}
+
+// mergeStory copies the comments of the dupe onto the original so that
+// nothing is lost when the dupe is deleted. The dupe's labels are the same as
+// the original's, as that's what makes it a dupe.
+func (syncer *Syncer) mergeStory(original Story, dupe Story) error {
+	comments, err := syncer.Backend.StoryComments(dupe.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch comments: %s", err)
+	}
+
+	originalComments, err := syncer.Backend.StoryComments(original.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch comments of original: %s", err)
+	}
+
+	for _, comment := range comments {
+		if comment.Text == "" {
+			continue
+		}
+
+		marker := movedCommentMarker(comment.ID)
+
+		moved := false
+		for _, originalComment := range originalComments {
+			if strings.Contains(originalComment.Text, marker) {
+				moved = true
+				break
+			}
+		}
+
+		if moved {
+			continue
+		}
+
+		text := fmt.Sprintf("(moved from duplicate #%d)\n\n%s\n\n%s", dupe.ID, comment.Text, marker)
+
+		if syncer.Plan != nil {
+			syncer.Plan.Record(ActionCreateStoryComment, fmt.Sprintf("#%d", original.ID), fmt.Sprintf("comment %d from #%d", comment.ID, dupe.ID))
+			continue
+		}
+
+		if _, err := syncer.Backend.CreateStoryComment(original.ID, text); err != nil {
+			return fmt.Errorf("failed to move comment %d: %s", comment.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,638 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultGiteaMaxResponseItems = 50
+
+// Gitea is a fake of Gitea's REST API holding repositories, issues, labels,
+// comments, and pull requests in memory.
+//
+// Like older versions of Gitea, labels can only be added to issues by their
+// IDs.
+type Gitea struct {
+	*httptest.Server
+
+	// MaxResponseItems is the most results returned in a page, like Gitea's
+	// setting of the same name.
+	MaxResponseItems int
+
+	lock sync.Mutex
+
+	user GiteaUser
+
+	repos    []*GiteaRepo
+	issues   map[string][]*GiteaIssue
+	labels   map[string][]*GiteaLabel
+	comments map[string][]*GiteaComment
+	pulls    map[string][]*GiteaPull
+
+	nextID int
+}
+
+type GiteaRepo struct {
+	ID       int       `json:"id"`
+	Owner    GiteaUser `json:"owner"`
+	Name     string    `json:"name"`
+	FullName string    `json:"full_name"`
+	HTMLURL  string    `json:"html_url"`
+	Private  bool      `json:"private"`
+	Fork     bool      `json:"fork"`
+	Archived bool      `json:"archived"`
+	Topics   []string  `json:"topics"`
+}
+
+type GiteaUser struct {
+	ID    int    `json:"id"`
+	Login string `json:"login"`
+}
+
+type GiteaIssue struct {
+	ID          int           `json:"id"`
+	Number      int           `json:"number"`
+	Title       string        `json:"title"`
+	Body        string        `json:"body"`
+	State       string        `json:"state"`
+	User        GiteaUser     `json:"user"`
+	Labels      []*GiteaLabel `json:"labels"`
+	HTMLURL     string        `json:"html_url"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	PullRequest *struct{}     `json:"pull_request"`
+}
+
+type GiteaLabel struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type GiteaComment struct {
+	ID        int       `json:"id"`
+	Body      string    `json:"body"`
+	User      GiteaUser `json:"user"`
+	HTMLURL   string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type GiteaPull struct {
+	Number         int        `json:"number"`
+	Title          string     `json:"title"`
+	Body           string     `json:"body"`
+	State          string     `json:"state"`
+	HTMLURL        string     `json:"html_url"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+	Merged         bool       `json:"merged"`
+	MergeCommitSHA *string    `json:"merge_commit_sha"`
+
+	Commits []GiteaCommit `json:"-"`
+}
+
+type GiteaCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+	} `json:"commit"`
+}
+
+// NewGitea starts a fake Gitea API, authenticated as the given user.
+func NewGitea(login string) *Gitea {
+	gitea := &Gitea{
+		MaxResponseItems: defaultGiteaMaxResponseItems,
+
+		issues:   map[string][]*GiteaIssue{},
+		labels:   map[string][]*GiteaLabel{},
+		comments: map[string][]*GiteaComment{},
+		pulls:    map[string][]*GiteaPull{},
+	}
+
+	gitea.user = gitea.newUser(login)
+
+	gitea.Server = httptest.NewServer(gitea)
+
+	return gitea
+}
+
+// AddRepo adds a public repository.
+func (gitea *Gitea) AddRepo(owner string, name string) *GiteaRepo {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	repo := &GiteaRepo{
+		ID:       gitea.id(),
+		Owner:    gitea.newUser(owner),
+		Name:     name,
+		FullName: owner + "/" + name,
+		HTMLURL:  fmt.Sprintf("https://gitea.example.com/%s/%s", owner, name),
+	}
+
+	gitea.repos = append(gitea.repos, repo)
+
+	return repo
+}
+
+// AddIssue opens an issue with the given labels, as someone other than the
+// authenticated user.
+func (gitea *Gitea) AddIssue(owner string, repo string, title string, labels ...string) *GiteaIssue {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	key := repoKey(owner, repo)
+	now := time.Now()
+
+	number := len(gitea.issues[key]) + len(gitea.pulls[key]) + 1
+
+	issue := &GiteaIssue{
+		ID:        gitea.id(),
+		Number:    number,
+		Title:     title,
+		State:     "open",
+		User:      gitea.newUser("someone"),
+		HTMLURL:   fmt.Sprintf("https://gitea.example.com/%s/issues/%d", key, number),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, name := range labels {
+		issue.Labels = append(issue.Labels, gitea.ensureLabel(key, name))
+	}
+
+	gitea.issues[key] = append(gitea.issues[key], issue)
+
+	return issue
+}
+
+// AddComment comments on an issue as someone other than the authenticated
+// user.
+func (gitea *Gitea) AddComment(owner string, repo string, number int, body string) *GiteaComment {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	return gitea.addComment(repoKey(owner, repo), number, gitea.newUser("someone"), body)
+}
+
+// AddPull opens a pull request with commits with the given messages.
+func (gitea *Gitea) AddPull(owner string, repo string, title string, body string, commitMessages ...string) *GiteaPull {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	key := repoKey(owner, repo)
+
+	number := len(gitea.issues[key]) + len(gitea.pulls[key]) + 1
+
+	pull := &GiteaPull{
+		Number:    number,
+		Title:     title,
+		Body:      body,
+		State:     "open",
+		HTMLURL:   fmt.Sprintf("https://gitea.example.com/%s/pulls/%d", key, number),
+		UpdatedAt: time.Now(),
+	}
+
+	for i, message := range commitMessages {
+		commit := GiteaCommit{SHA: fmt.Sprintf("%040d", gitea.id()*100+i)}
+		commit.Commit.Message = message
+		pull.Commits = append(pull.Commits, commit)
+	}
+
+	gitea.pulls[key] = append(gitea.pulls[key], pull)
+
+	return pull
+}
+
+// MergePull merges a pull request as the given commit.
+func (gitea *Gitea) MergePull(owner string, repo string, number int, sha string) {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	now := time.Now()
+
+	pull := gitea.pull(repoKey(owner, repo), number)
+	pull.State = "closed"
+	pull.Merged = true
+	pull.MergedAt = &now
+	pull.MergeCommitSHA = &sha
+	pull.UpdatedAt = now
+}
+
+// Issue returns a copy of an issue.
+func (gitea *Gitea) Issue(owner string, repo string, number int) GiteaIssue {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	return *gitea.issue(repoKey(owner, repo), number)
+}
+
+// IssueLabels returns the names of an issue's labels, in the order they were
+// added.
+func (gitea *Gitea) IssueLabels(owner string, repo string, number int) []string {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	var names []string
+	for _, label := range gitea.issue(repoKey(owner, repo), number).Labels {
+		names = append(names, label.Name)
+	}
+
+	return names
+}
+
+// Comments returns copies of the comments on an issue.
+func (gitea *Gitea) Comments(owner string, repo string, number int) []GiteaComment {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	var comments []GiteaComment
+	for _, comment := range gitea.comments[issueKey(repoKey(owner, repo), number)] {
+		comments = append(comments, *comment)
+	}
+
+	return comments
+}
+
+func (gitea *Gitea) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gitea.lock.Lock()
+	defer gitea.lock.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "token ") {
+		writeJSON(w, http.StatusUnauthorized, errorBody("token is required"))
+		return
+	}
+
+	path := splitPath(r.URL)
+	if len(path) < 2 || path[0] != "api" || path[1] != "v1" {
+		notFound(w)
+		return
+	}
+
+	path = path[2:]
+
+	switch {
+	case match(r, "GET", path, "user"):
+		writeJSON(w, http.StatusOK, gitea.user)
+
+	case match(r, "GET", path, "orgs", "*", "repos"):
+		var repos []*GiteaRepo
+		for _, repo := range gitea.repos {
+			if strings.EqualFold(repo.Owner.Login, path[1]) {
+				repos = append(repos, repo)
+			}
+		}
+
+		gitea.writePage(w, r, len(repos), func(i int) interface{} { return repos[i] })
+
+	case match(r, "GET", path, "repos", "*", "*"):
+		repo := gitea.repo(path[1], path[2])
+		if repo == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, repo)
+
+	case match(r, "GET", path, "repos", "*", "*", "issues"):
+		var since time.Time
+		if param := r.URL.Query().Get("since"); param != "" {
+			since, _ = time.Parse(time.RFC3339, param)
+		}
+
+		var issues []*GiteaIssue
+		for _, issue := range gitea.issues[repoKey(path[1], path[2])] {
+			if state := r.URL.Query().Get("state"); state != "" && state != "all" && issue.State != state {
+				continue
+			}
+
+			if issue.UpdatedAt.Before(since) {
+				continue
+			}
+
+			issues = append(issues, issue)
+		}
+
+		gitea.writePage(w, r, len(issues), func(i int) interface{} { return issues[i] })
+
+	case match(r, "GET", path, "repos", "*", "*", "issues", "#"):
+		issue := gitea.issue(repoKey(path[1], path[2]), atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, issue)
+
+	case match(r, "PATCH", path, "repos", "*", "*", "issues", "#"):
+		issue := gitea.issue(repoKey(path[1], path[2]), atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		var update struct {
+			State *string `json:"state"`
+		}
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		if update.State != nil {
+			issue.State = *update.State
+		}
+
+		issue.UpdatedAt = time.Now()
+
+		writeJSON(w, http.StatusCreated, issue)
+
+	case match(r, "POST", path, "repos", "*", "*", "issues", "#", "labels"):
+		key := repoKey(path[1], path[2])
+
+		issue := gitea.issue(key, atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		var add struct {
+			Labels []json.RawMessage `json:"labels"`
+		}
+		if !readJSON(w, r, &add) {
+			return
+		}
+
+		for _, raw := range add.Labels {
+			var id int
+			if err := json.Unmarshal(raw, &id); err != nil {
+				writeJSON(w, http.StatusUnprocessableEntity, errorBody(fmt.Sprintf("label %s is not an ID", raw)))
+				return
+			}
+
+			label := gitea.labelByID(key, id)
+			if label == nil {
+				writeJSON(w, http.StatusUnprocessableEntity, errorBody(fmt.Sprintf("label %d does not exist", id)))
+				return
+			}
+
+			if gitea.issueLabel(issue, id) == nil {
+				issue.Labels = append(issue.Labels, label)
+			}
+		}
+
+		issue.UpdatedAt = time.Now()
+
+		writeJSON(w, http.StatusOK, issue.Labels)
+
+	case match(r, "DELETE", path, "repos", "*", "*", "issues", "#", "labels", "#"):
+		issue := gitea.issue(repoKey(path[1], path[2]), atoi(path[4]))
+		if issue == nil || gitea.issueLabel(issue, atoi(path[6])) == nil {
+			notFound(w)
+			return
+		}
+
+		var labels []*GiteaLabel
+		for _, label := range issue.Labels {
+			if label.ID != atoi(path[6]) {
+				labels = append(labels, label)
+			}
+		}
+
+		issue.Labels = labels
+		issue.UpdatedAt = time.Now()
+
+		w.WriteHeader(http.StatusNoContent)
+
+	case match(r, "GET", path, "repos", "*", "*", "labels"):
+		labels := gitea.labels[repoKey(path[1], path[2])]
+		gitea.writePage(w, r, len(labels), func(i int) interface{} { return labels[i] })
+
+	case match(r, "POST", path, "repos", "*", "*", "labels"):
+		var label GiteaLabel
+		if !readJSON(w, r, &label) {
+			return
+		}
+
+		key := repoKey(path[1], path[2])
+		for _, existing := range gitea.labels[key] {
+			if existing.Name == label.Name {
+				writeJSON(w, http.StatusConflict, errorBody("label already exists"))
+				return
+			}
+		}
+
+		created := gitea.ensureLabel(key, label.Name)
+		created.Color = label.Color
+
+		writeJSON(w, http.StatusCreated, created)
+
+	case match(r, "PATCH", path, "repos", "*", "*", "labels", "#"):
+		var update GiteaLabel
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		label := gitea.labelByID(repoKey(path[1], path[2]), atoi(path[4]))
+		if label == nil {
+			notFound(w)
+			return
+		}
+
+		if update.Color != "" {
+			label.Color = update.Color
+		}
+
+		writeJSON(w, http.StatusOK, label)
+
+	case match(r, "GET", path, "repos", "*", "*", "issues", "#", "comments"):
+		comments := gitea.comments[issueKey(repoKey(path[1], path[2]), atoi(path[4]))]
+		gitea.writePage(w, r, len(comments), func(i int) interface{} { return comments[i] })
+
+	case match(r, "POST", path, "repos", "*", "*", "issues", "#", "comments"):
+		var create struct {
+			Body string `json:"body"`
+		}
+		if !readJSON(w, r, &create) {
+			return
+		}
+
+		key := repoKey(path[1], path[2])
+		if gitea.issue(key, atoi(path[4])) == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, gitea.addComment(key, atoi(path[4]), gitea.user, create.Body))
+
+	case match(r, "PATCH", path, "repos", "*", "*", "issues", "comments", "#"):
+		var update struct {
+			Body string `json:"body"`
+		}
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		prefix := repoKey(path[1], path[2]) + "#"
+		for key, comments := range gitea.comments {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+
+			for _, comment := range comments {
+				if comment.ID == atoi(path[5]) {
+					comment.Body = update.Body
+					comment.UpdatedAt = time.Now()
+					writeJSON(w, http.StatusOK, comment)
+					return
+				}
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "repos", "*", "*", "pulls"):
+		// only sort=recentupdate is supported
+		pulls := append([]*GiteaPull{}, gitea.pulls[repoKey(path[1], path[2])]...)
+		for i, j := 0, len(pulls)-1; i < j; i, j = i+1, j-1 {
+			pulls[i], pulls[j] = pulls[j], pulls[i]
+		}
+
+		var filtered []*GiteaPull
+		for _, pull := range pulls {
+			if state := r.URL.Query().Get("state"); state != "" && state != "all" && pull.State != state {
+				continue
+			}
+
+			filtered = append(filtered, pull)
+		}
+
+		gitea.writePage(w, r, len(filtered), func(i int) interface{} { return filtered[i] })
+
+	case match(r, "GET", path, "repos", "*", "*", "pulls", "#", "commits"):
+		pull := gitea.pull(repoKey(path[1], path[2]), atoi(path[4]))
+		if pull == nil {
+			notFound(w)
+			return
+		}
+
+		gitea.writePage(w, r, len(pull.Commits), func(i int) interface{} { return pull.Commits[i] })
+
+	default:
+		notFound(w)
+	}
+}
+
+func (gitea *Gitea) id() int {
+	gitea.nextID++
+	return gitea.nextID
+}
+
+func (gitea *Gitea) newUser(login string) GiteaUser {
+	return GiteaUser{ID: gitea.id(), Login: login}
+}
+
+func (gitea *Gitea) repo(owner string, name string) *GiteaRepo {
+	for _, repo := range gitea.repos {
+		if strings.EqualFold(repo.Owner.Login, owner) && repo.Name == name {
+			return repo
+		}
+	}
+
+	return nil
+}
+
+func (gitea *Gitea) issue(key string, number int) *GiteaIssue {
+	for _, issue := range gitea.issues[key] {
+		if issue.Number == number {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+func (gitea *Gitea) pull(key string, number int) *GiteaPull {
+	for _, pull := range gitea.pulls[key] {
+		if pull.Number == number {
+			return pull
+		}
+	}
+
+	return nil
+}
+
+func (gitea *Gitea) issueLabel(issue *GiteaIssue, id int) *GiteaLabel {
+	for _, label := range issue.Labels {
+		if label.ID == id {
+			return label
+		}
+	}
+
+	return nil
+}
+
+func (gitea *Gitea) labelByID(key string, id int) *GiteaLabel {
+	for _, label := range gitea.labels[key] {
+		if label.ID == id {
+			return label
+		}
+	}
+
+	return nil
+}
+
+func (gitea *Gitea) ensureLabel(key string, name string) *GiteaLabel {
+	for _, label := range gitea.labels[key] {
+		if label.Name == name {
+			return label
+		}
+	}
+
+	label := &GiteaLabel{ID: gitea.id(), Name: name, Color: "#ededed"}
+	gitea.labels[key] = append(gitea.labels[key], label)
+
+	return label
+}
+
+func (gitea *Gitea) addComment(key string, number int, user GiteaUser, body string) *GiteaComment {
+	now := time.Now()
+	id := gitea.id()
+
+	comment := &GiteaComment{
+		ID:        id,
+		Body:      body,
+		User:      user,
+		HTMLURL:   fmt.Sprintf("https://gitea.example.com/%s/issues/%d#issuecomment-%d", key, number, id),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	gitea.comments[issueKey(key, number)] = append(gitea.comments[issueKey(key, number)], comment)
+
+	if issue := gitea.issue(key, number); issue != nil {
+		issue.UpdatedAt = now
+	}
+
+	return comment
+}
+
+// writePage writes the requested page of count items. Like Gitea, no more
+// than MaxResponseItems are returned however many are asked for.
+func (gitea *Gitea) writePage(w http.ResponseWriter, r *http.Request, count int, item func(int) interface{}) {
+	page := atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit := atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > gitea.MaxResponseItems {
+		limit = gitea.MaxResponseItems
+	}
+
+	writeJSON(w, http.StatusOK, pageItems(page, limit, count, item))
+}
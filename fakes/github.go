@@ -0,0 +1,832 @@
+// Package fakes provides in-process fakes of the forge and tracker APIs that
+// tracksuit syncs, serving just enough of each for it to sync against them.
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const defaultGitHubPerPage = 30
+
+// GitHub is a fake GitHub API holding repositories, issues, labels, comments,
+// and pull requests in memory.
+type GitHub struct {
+	*httptest.Server
+
+	// PerPage is the most results returned in a page, unless the request
+	// asks for fewer. Set it low to exercise pagination.
+	PerPage int
+
+	lock sync.Mutex
+
+	user github.User
+
+	repos    []*GitHubRepository
+	labels   map[string][]*github.Label
+	issues   map[string][]*github.Issue
+	comments map[string][]*github.IssueComment
+	pulls    map[string][]*GitHubPullRequest
+
+	commitListings map[string]int
+
+	nextID int
+}
+
+// GitHubRepository is a repository, with the fields go-github's Repository
+// leaves out.
+type GitHubRepository struct {
+	github.Repository
+
+	Archived *bool    `json:"archived,omitempty"`
+	Topics   []string `json:"topics,omitempty"`
+}
+
+// GitHubPullRequest is a pull request, with the fields go-github's
+// PullRequest leaves out.
+type GitHubPullRequest struct {
+	github.PullRequest
+
+	MergeCommitSHA *string `json:"merge_commit_sha,omitempty"`
+
+	commits []*github.RepositoryCommit
+}
+
+// NewGitHub starts a fake GitHub API, authenticated as the given user.
+func NewGitHub(login string) *GitHub {
+	gh := &GitHub{
+		PerPage: defaultGitHubPerPage,
+
+		labels:   map[string][]*github.Label{},
+		issues:   map[string][]*github.Issue{},
+		comments: map[string][]*github.IssueComment{},
+		pulls:    map[string][]*GitHubPullRequest{},
+
+		commitListings: map[string]int{},
+
+		nextID: 1,
+	}
+
+	gh.user = gh.newUser(login)
+
+	gh.Server = httptest.NewServer(gh)
+
+	return gh
+}
+
+// Client returns a client for the fake, as if configured with
+// --github-api-url.
+func (gh *GitHub) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(gh.URL + "/")
+	return client
+}
+
+// AddRepo adds a public repository.
+func (gh *GitHub) AddRepo(owner string, name string) GitHubRepository {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	id := gh.id()
+	private := false
+	fork := false
+	archived := false
+	htmlURL := fmt.Sprintf("https://github.com/%s/%s", owner, name)
+
+	user := gh.newUser(owner)
+
+	repo := &GitHubRepository{
+		Repository: github.Repository{
+			ID:      &id,
+			Owner:   &user,
+			Name:    &name,
+			HTMLURL: &htmlURL,
+			Private: &private,
+			Fork:    &fork,
+		},
+		Archived: &archived,
+	}
+
+	gh.repos = append(gh.repos, repo)
+
+	return *repo
+}
+
+// UpdateRepo changes a repository, e.g. to archive it or tag it with topics.
+func (gh *GitHub) UpdateRepo(owner string, name string, update func(*GitHubRepository)) {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	update(gh.repo(owner, name))
+}
+
+// AddIssue opens an issue with the given labels, as someone other than the
+// authenticated user.
+func (gh *GitHub) AddIssue(owner string, repo string, title string, labels ...string) *github.Issue {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	key := repoKey(owner, repo)
+
+	id := gh.id()
+	number := gh.nextNumber(key)
+
+	state := "open"
+	body := ""
+	htmlURL := fmt.Sprintf("https://github.com/%s/issues/%d", key, number)
+	now := time.Now()
+	author := gh.newUser("someone")
+
+	issue := &github.Issue{
+		ID:        &id,
+		Number:    &number,
+		State:     &state,
+		Title:     &title,
+		Body:      &body,
+		User:      &author,
+		HTMLURL:   &htmlURL,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+
+	for _, name := range labels {
+		issue.Labels = append(issue.Labels, *gh.ensureLabel(key, name))
+	}
+
+	gh.issues[key] = append(gh.issues[key], issue)
+
+	return issue
+}
+
+// AddPullRequest opens a pull request with commits with the given messages,
+// as someone other than the authenticated user. Pull requests are numbered
+// along with issues.
+func (gh *GitHub) AddPullRequest(owner string, repo string, title string, body string, commitMessages ...string) GitHubPullRequest {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	key := repoKey(owner, repo)
+
+	id := gh.id()
+	number := gh.nextNumber(key)
+	state := "open"
+	htmlURL := fmt.Sprintf("https://github.com/%s/pull/%d", key, number)
+	now := time.Now()
+	author := gh.newUser("someone")
+
+	pr := &GitHubPullRequest{
+		PullRequest: github.PullRequest{
+			ID:        &id,
+			Number:    &number,
+			State:     &state,
+			Title:     &title,
+			Body:      &body,
+			User:      &author,
+			HTMLURL:   &htmlURL,
+			CreatedAt: &now,
+			UpdatedAt: &now,
+		},
+	}
+
+	gh.addCommits(pr, commitMessages)
+
+	gh.pulls[key] = append(gh.pulls[key], pr)
+
+	return *pr
+}
+
+// MergePullRequest merges a pull request as the given commit.
+func (gh *GitHub) MergePullRequest(owner string, repo string, number int, sha string) {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	pr := gh.pull(repoKey(owner, repo), number)
+
+	now := time.Now()
+	state := "closed"
+	merged := true
+
+	pr.State = &state
+	pr.Merged = &merged
+	pr.MergedAt = &now
+	pr.ClosedAt = &now
+	pr.UpdatedAt = &now
+	pr.MergeCommitSHA = &sha
+}
+
+// PushCommits adds commits with the given messages to a pull request.
+func (gh *GitHub) PushCommits(owner string, repo string, number int, commitMessages ...string) {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	pr := gh.pull(repoKey(owner, repo), number)
+
+	now := time.Now()
+	pr.UpdatedAt = &now
+
+	gh.addCommits(pr, commitMessages)
+}
+
+// CommitListings returns how many times a pull request's commits have been
+// listed.
+func (gh *GitHub) CommitListings(owner string, repo string, number int) int {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	return gh.commitListings[issueKey(repoKey(owner, repo), number)]
+}
+
+// AddComment comments on an issue as someone other than the authenticated
+// user.
+func (gh *GitHub) AddComment(owner string, repo string, number int, body string) *github.IssueComment {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	return gh.addComment(repoKey(owner, repo), number, gh.newUser("someone"), body)
+}
+
+// SetIssueState opens or closes an issue.
+func (gh *GitHub) SetIssueState(owner string, repo string, number int, state string) {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	issue := gh.issue(repoKey(owner, repo), number)
+	issue.State = &state
+	gh.touch(issue)
+}
+
+// DeleteIssue deletes an issue, leaving a gap in the numbering.
+func (gh *GitHub) DeleteIssue(owner string, repo string, number int) {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	key := repoKey(owner, repo)
+	for i, issue := range gh.issues[key] {
+		if *issue.Number == number {
+			gh.issues[key] = append(gh.issues[key][:i], gh.issues[key][i+1:]...)
+			return
+		}
+	}
+}
+
+// Issue returns a copy of an issue.
+func (gh *GitHub) Issue(owner string, repo string, number int) github.Issue {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	return *gh.issue(repoKey(owner, repo), number)
+}
+
+// IssueLabels returns the names of an issue's labels, sorted.
+func (gh *GitHub) IssueLabels(owner string, repo string, number int) []string {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	var names []string
+	for _, label := range gh.issue(repoKey(owner, repo), number).Labels {
+		names = append(names, *label.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Comments returns copies of the comments on an issue.
+func (gh *GitHub) Comments(owner string, repo string, number int) []github.IssueComment {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	var comments []github.IssueComment
+	for _, comment := range gh.comments[issueKey(repoKey(owner, repo), number)] {
+		comments = append(comments, *comment)
+	}
+
+	return comments
+}
+
+// Labels returns copies of a repository's labels.
+func (gh *GitHub) Labels(owner string, repo string) []github.Label {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	var labels []github.Label
+	for _, label := range gh.labels[repoKey(owner, repo)] {
+		labels = append(labels, *label)
+	}
+
+	return labels
+}
+
+func (gh *GitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gh.lock.Lock()
+	defer gh.lock.Unlock()
+
+	path := splitPath(r.URL)
+
+	switch {
+	case match(r, "GET", path, "user"):
+		writeJSON(w, http.StatusOK, gh.user)
+
+	case match(r, "GET", path, "users", "*"):
+		if path[1] != *gh.user.Login {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, gh.user)
+
+	case match(r, "GET", path, "orgs", "*", "repos"):
+		var repos []*GitHubRepository
+		for _, repo := range gh.repos {
+			if !strings.EqualFold(*repo.Owner.Login, path[1]) {
+				continue
+			}
+
+			if *repo.Private && r.URL.Query().Get("type") == "public" {
+				continue
+			}
+
+			repos = append(repos, repo)
+		}
+
+		gh.writePage(w, r, len(repos), func(i int) interface{} { return repos[i] })
+
+	case match(r, "GET", path, "repos", "*", "*"):
+		repo := gh.repo(path[1], path[2])
+		if repo == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, repo)
+
+	case match(r, "GET", path, "repos", "*", "*", "labels"):
+		labels := gh.labels[repoKey(path[1], path[2])]
+		gh.writePage(w, r, len(labels), func(i int) interface{} { return labels[i] })
+
+	case match(r, "POST", path, "repos", "*", "*", "labels"):
+		var label github.Label
+		if !readJSON(w, r, &label) {
+			return
+		}
+
+		key := repoKey(path[1], path[2])
+		for _, existing := range gh.labels[key] {
+			if *existing.Name == *label.Name {
+				writeJSON(w, http.StatusUnprocessableEntity, errorBody("label already exists"))
+				return
+			}
+		}
+
+		created := gh.ensureLabel(key, *label.Name)
+		created.Color = label.Color
+
+		writeJSON(w, http.StatusCreated, created)
+
+	case match(r, "PATCH", path, "repos", "*", "*", "labels", "*"):
+		var update github.Label
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		for _, label := range gh.labels[repoKey(path[1], path[2])] {
+			if *label.Name == path[4] {
+				if update.Color != nil {
+					label.Color = update.Color
+				}
+
+				writeJSON(w, http.StatusOK, label)
+				return
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "repos", "*", "*", "issues"):
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = "open"
+		}
+
+		var since time.Time
+		if param := r.URL.Query().Get("since"); param != "" {
+			since, _ = time.Parse(time.RFC3339, param)
+		}
+
+		var issues []*github.Issue
+		for _, issue := range gh.issues[repoKey(path[1], path[2])] {
+			if state != "all" && *issue.State != state {
+				continue
+			}
+
+			if issue.UpdatedAt.Before(since) {
+				continue
+			}
+
+			issues = append(issues, issue)
+		}
+
+		gh.writePage(w, r, len(issues), func(i int) interface{} { return issues[i] })
+
+	case match(r, "GET", path, "repos", "*", "*", "issues", "#"):
+		issue := gh.issue(repoKey(path[1], path[2]), atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, issue)
+
+	case match(r, "PATCH", path, "repos", "*", "*", "issues", "#"):
+		issue := gh.issue(repoKey(path[1], path[2]), atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		var update github.IssueRequest
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		if update.State != nil {
+			issue.State = update.State
+		}
+
+		if update.Title != nil {
+			issue.Title = update.Title
+		}
+
+		if update.Body != nil {
+			issue.Body = update.Body
+		}
+
+		gh.touch(issue)
+
+		writeJSON(w, http.StatusOK, issue)
+
+	case match(r, "GET", path, "repos", "*", "*", "issues", "#", "comments"):
+		comments := gh.comments[issueKey(repoKey(path[1], path[2]), atoi(path[4]))]
+		gh.writePage(w, r, len(comments), func(i int) interface{} { return comments[i] })
+
+	case match(r, "POST", path, "repos", "*", "*", "issues", "#", "comments"):
+		key := repoKey(path[1], path[2])
+		number := atoi(path[4])
+
+		if gh.issue(key, number) == nil {
+			notFound(w)
+			return
+		}
+
+		var comment github.IssueComment
+		if !readJSON(w, r, &comment) {
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, gh.addComment(key, number, gh.user, *comment.Body))
+
+	case match(r, "PATCH", path, "repos", "*", "*", "issues", "comments", "#"):
+		var update github.IssueComment
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		for key, comments := range gh.comments {
+			if !strings.HasPrefix(key, repoKey(path[1], path[2])+"#") {
+				continue
+			}
+
+			for _, comment := range comments {
+				if *comment.ID == atoi(path[5]) {
+					comment.Body = update.Body
+					writeJSON(w, http.StatusOK, comment)
+					return
+				}
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "POST", path, "repos", "*", "*", "issues", "#", "labels"):
+		key := repoKey(path[1], path[2])
+
+		issue := gh.issue(key, atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		var names []string
+		if !readJSON(w, r, &names) {
+			return
+		}
+
+	nextName:
+		for _, name := range names {
+			for _, label := range issue.Labels {
+				if *label.Name == name {
+					continue nextName
+				}
+			}
+
+			issue.Labels = append(issue.Labels, *gh.ensureLabel(key, name))
+		}
+
+		gh.touch(issue)
+
+		writeJSON(w, http.StatusOK, issue.Labels)
+
+	case match(r, "DELETE", path, "repos", "*", "*", "issues", "#", "labels", "*"):
+		issue := gh.issue(repoKey(path[1], path[2]), atoi(path[4]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		for i, label := range issue.Labels {
+			if *label.Name == path[6] {
+				issue.Labels = append(issue.Labels[:i], issue.Labels[i+1:]...)
+				gh.touch(issue)
+				writeJSON(w, http.StatusOK, issue.Labels)
+				return
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "repos", "*", "*", "pulls"):
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = "open"
+		}
+
+		var pulls []*GitHubPullRequest
+		for _, pr := range gh.pulls[repoKey(path[1], path[2])] {
+			if state == "all" || *pr.State == state {
+				pulls = append(pulls, pr)
+			}
+		}
+
+		// newest first, or most recently updated first
+		sort.SliceStable(pulls, func(i, j int) bool {
+			if r.URL.Query().Get("sort") == "updated" {
+				return pulls[i].UpdatedAt.After(*pulls[j].UpdatedAt)
+			}
+
+			return *pulls[i].Number > *pulls[j].Number
+		})
+
+		gh.writePage(w, r, len(pulls), func(i int) interface{} { return pulls[i] })
+
+	case match(r, "GET", path, "repos", "*", "*", "pulls", "#", "commits"):
+		key := repoKey(path[1], path[2])
+
+		pr := gh.pull(key, atoi(path[4]))
+		if pr == nil {
+			notFound(w)
+			return
+		}
+
+		gh.commitListings[issueKey(key, *pr.Number)]++
+
+		gh.writePage(w, r, len(pr.commits), func(i int) interface{} { return pr.commits[i] })
+
+	default:
+		notFound(w)
+	}
+}
+
+func (gh *GitHub) id() int {
+	id := gh.nextID
+	gh.nextID++
+	return id
+}
+
+func (gh *GitHub) newUser(login string) github.User {
+	id := gh.id()
+	htmlURL := "https://github.com/" + login
+	return github.User{ID: &id, Login: &login, HTMLURL: &htmlURL}
+}
+
+func (gh *GitHub) repo(owner string, name string) *GitHubRepository {
+	for _, repo := range gh.repos {
+		if strings.EqualFold(*repo.Owner.Login, owner) && *repo.Name == name {
+			return repo
+		}
+	}
+
+	return nil
+}
+
+func (gh *GitHub) issue(key string, number int) *github.Issue {
+	for _, issue := range gh.issues[key] {
+		if *issue.Number == number {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+func (gh *GitHub) pull(key string, number int) *GitHubPullRequest {
+	for _, pr := range gh.pulls[key] {
+		if *pr.Number == number {
+			return pr
+		}
+	}
+
+	return nil
+}
+
+func (gh *GitHub) addCommits(pr *GitHubPullRequest, messages []string) {
+	for _, message := range messages {
+		sha := fmt.Sprintf("%040d", gh.id())
+		message := message
+		pr.commits = append(pr.commits, &github.RepositoryCommit{
+			SHA:    &sha,
+			Commit: &github.Commit{SHA: &sha, Message: &message},
+		})
+	}
+}
+
+// nextNumber returns the number of the next issue or pull request, which
+// share a sequence.
+func (gh *GitHub) nextNumber(key string) int {
+	number := 1
+
+	if issues := gh.issues[key]; len(issues) > 0 && *issues[len(issues)-1].Number >= number {
+		number = *issues[len(issues)-1].Number + 1
+	}
+
+	if pulls := gh.pulls[key]; len(pulls) > 0 && *pulls[len(pulls)-1].Number >= number {
+		number = *pulls[len(pulls)-1].Number + 1
+	}
+
+	return number
+}
+
+func (gh *GitHub) ensureLabel(key string, name string) *github.Label {
+	for _, label := range gh.labels[key] {
+		if *label.Name == name {
+			return label
+		}
+	}
+
+	color := "ededed"
+
+	label := &github.Label{Name: &name, Color: &color}
+	gh.labels[key] = append(gh.labels[key], label)
+
+	return label
+}
+
+func (gh *GitHub) addComment(key string, number int, user github.User, body string) *github.IssueComment {
+	id := gh.id()
+	htmlURL := fmt.Sprintf("https://github.com/%s/issues/%d#issuecomment-%d", key, number, id)
+	now := time.Now()
+
+	comment := &github.IssueComment{
+		ID:        &id,
+		Body:      &body,
+		User:      &user,
+		HTMLURL:   &htmlURL,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+
+	gh.comments[issueKey(key, number)] = append(gh.comments[issueKey(key, number)], comment)
+
+	if issue := gh.issue(key, number); issue != nil {
+		gh.touch(issue)
+	}
+
+	return comment
+}
+
+func (gh *GitHub) touch(issue *github.Issue) {
+	now := time.Now()
+	issue.UpdatedAt = &now
+}
+
+// writePage writes the requested page of count items, linking to the next
+// page like GitHub does.
+func (gh *GitHub) writePage(w http.ResponseWriter, r *http.Request, count int, item func(int) interface{}) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > gh.PerPage {
+		perPage = gh.PerPage
+	}
+
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > count {
+		end = count
+	}
+
+	items := []interface{}{}
+	for i := start; i < end; i++ {
+		items = append(items, item(i))
+	}
+
+	if end < count {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, gh.URL, next.RequestURI()))
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+func repoKey(owner string, repo string) string {
+	return strings.ToLower(owner) + "/" + repo
+}
+
+func issueKey(repoKey string, number int) string {
+	return fmt.Sprintf("%s#%d", repoKey, number)
+}
+
+// splitPath splits the request path into unescaped segments, so that label
+// names containing slashes survive.
+func splitPath(u *url.URL) []string {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+
+		segments = append(segments, unescaped)
+	}
+
+	return segments
+}
+
+// match checks the method and path against a pattern, where "*" matches any
+// segment and "#" matches a number.
+func match(r *http.Request, method string, path []string, pattern ...string) bool {
+	if r.Method != method || len(path) != len(pattern) {
+		return false
+	}
+
+	for i, segment := range pattern {
+		switch segment {
+		case "*":
+		case "#":
+			if _, err := strconv.Atoi(path[i]); err != nil {
+				return false
+			}
+		default:
+			if path[i] != segment {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, errorBody("Not Found"))
+}
+
+func errorBody(message string) map[string]string {
+	return map[string]string{"message": message}
+}
@@ -0,0 +1,627 @@
+package fakes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxGitLabPerPage = 100
+
+// GitLab is a fake of GitLab's REST API holding projects, issues, labels,
+// notes, and merge requests in memory.
+type GitLab struct {
+	*httptest.Server
+
+	lock sync.Mutex
+
+	user GitLabUser
+
+	projects      []*GitLabProject
+	issues        map[string][]*GitLabIssue
+	labels        map[string][]*GitLabLabel
+	notes         map[string][]*GitLabNote
+	mergeRequests map[string][]*GitLabMergeRequest
+
+	nextID int
+}
+
+type GitLabProject struct {
+	ID                int        `json:"id"`
+	Path              string     `json:"path"`
+	PathWithNamespace string     `json:"path_with_namespace"`
+	Visibility        string     `json:"visibility"`
+	Archived          bool       `json:"archived"`
+	ForkedFromProject *struct{}  `json:"forked_from_project"`
+	WebURL            string     `json:"web_url"`
+	Topics            []string   `json:"topics"`
+	Namespace         GitLabPath `json:"namespace"`
+}
+
+type GitLabPath struct {
+	FullPath string `json:"full_path"`
+}
+
+type GitLabUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	WebURL   string `json:"web_url"`
+}
+
+type GitLabIssue struct {
+	ID                 int        `json:"id"`
+	IID                int        `json:"iid"`
+	Title              string     `json:"title"`
+	Description        string     `json:"description"`
+	State              string     `json:"state"`
+	Labels             []string   `json:"labels"`
+	Author             GitLabUser `json:"author"`
+	WebURL             string     `json:"web_url"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	MergeRequestsCount int        `json:"merge_requests_count"`
+}
+
+type GitLabLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type GitLabNote struct {
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	Author    GitLabUser `json:"author"`
+	System    bool       `json:"system"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type GitLabMergeRequest struct {
+	IID             int        `json:"iid"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	State           string     `json:"state"`
+	WebURL          string     `json:"web_url"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	MergedAt        *time.Time `json:"merged_at"`
+	MergeCommitSHA  *string    `json:"merge_commit_sha"`
+	SquashCommitSHA *string    `json:"squash_commit_sha"`
+
+	Commits []GitLabCommit `json:"-"`
+}
+
+type GitLabCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// NewGitLab starts a fake GitLab API, authenticated as the given user.
+func NewGitLab(username string) *GitLab {
+	gl := &GitLab{
+		issues:        map[string][]*GitLabIssue{},
+		labels:        map[string][]*GitLabLabel{},
+		notes:         map[string][]*GitLabNote{},
+		mergeRequests: map[string][]*GitLabMergeRequest{},
+	}
+
+	gl.user = gl.newUser(username)
+
+	gl.Server = httptest.NewServer(gl)
+
+	return gl
+}
+
+// AddProject adds a public project under the group, which may be a subgroup,
+// e.g. "some-group/some-subgroup".
+func (gl *GitLab) AddProject(group string, path string) *GitLabProject {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	project := &GitLabProject{
+		ID:                gl.id(),
+		Path:              path,
+		PathWithNamespace: group + "/" + path,
+		Visibility:        "public",
+		WebURL:            fmt.Sprintf("https://gitlab.example.com/%s/%s", group, path),
+		Namespace:         GitLabPath{FullPath: group},
+	}
+
+	gl.projects = append(gl.projects, project)
+
+	return project
+}
+
+// AddIssue opens an issue with the given labels, as someone other than the
+// authenticated user.
+func (gl *GitLab) AddIssue(project string, title string, labels ...string) *GitLabIssue {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	now := time.Now()
+
+	iid := len(gl.issues[project]) + 1
+
+	issue := &GitLabIssue{
+		ID:        gl.id(),
+		IID:       iid,
+		Title:     title,
+		State:     "opened",
+		Labels:    append([]string{}, labels...),
+		Author:    gl.newUser("someone"),
+		WebURL:    fmt.Sprintf("https://gitlab.example.com/%s/-/issues/%d", project, iid),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, label := range labels {
+		gl.ensureLabel(project, label)
+	}
+
+	gl.issues[project] = append(gl.issues[project], issue)
+
+	return issue
+}
+
+// AddNote comments on an issue as someone other than the authenticated user.
+// System notes are those GitLab leaves itself, e.g. for label changes.
+func (gl *GitLab) AddNote(project string, iid int, body string, system bool) *GitLabNote {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	note := gl.addNote(project, iid, gl.newUser("someone"), body)
+	note.System = system
+
+	return note
+}
+
+// AddMergeRequest opens a merge request with commits with the given
+// messages, relating it to any issues it closes.
+func (gl *GitLab) AddMergeRequest(project string, title string, description string, commitMessages ...string) *GitLabMergeRequest {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	iid := len(gl.mergeRequests[project]) + 1
+
+	mr := &GitLabMergeRequest{
+		IID:         iid,
+		Title:       title,
+		Description: description,
+		State:       "opened",
+		WebURL:      fmt.Sprintf("https://gitlab.example.com/%s/-/merge_requests/%d", project, iid),
+		UpdatedAt:   time.Now(),
+	}
+
+	for i, message := range commitMessages {
+		mr.Commits = append(mr.Commits, GitLabCommit{
+			ID:      fmt.Sprintf("%040d", gl.id()*100+i),
+			Message: message,
+		})
+	}
+
+	for _, issue := range gl.issues[project] {
+		if strings.Contains(description, fmt.Sprintf("#%d", issue.IID)) {
+			issue.MergeRequestsCount++
+		}
+	}
+
+	gl.mergeRequests[project] = append(gl.mergeRequests[project], mr)
+
+	return mr
+}
+
+// MergeMergeRequest merges a merge request, either as a merge commit or, if
+// squashed, as a squash commit alone.
+func (gl *GitLab) MergeMergeRequest(project string, iid int, sha string, squash bool) {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	now := time.Now()
+
+	mr := gl.mergeRequest(project, iid)
+	mr.State = "merged"
+	mr.MergedAt = &now
+	mr.UpdatedAt = now
+
+	if squash {
+		mr.SquashCommitSHA = &sha
+	} else {
+		mr.MergeCommitSHA = &sha
+	}
+}
+
+// CloseMergeRequest closes a merge request without merging it.
+func (gl *GitLab) CloseMergeRequest(project string, iid int) {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	mr := gl.mergeRequest(project, iid)
+	mr.State = "closed"
+	mr.UpdatedAt = time.Now()
+}
+
+// Issue returns a copy of an issue.
+func (gl *GitLab) Issue(project string, iid int) GitLabIssue {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	return *gl.issue(project, iid)
+}
+
+// Notes returns copies of the notes on an issue.
+func (gl *GitLab) Notes(project string, iid int) []GitLabNote {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	var notes []GitLabNote
+	for _, note := range gl.notes[issueKey(project, iid)] {
+		notes = append(notes, *note)
+	}
+
+	return notes
+}
+
+func (gl *GitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gl.lock.Lock()
+	defer gl.lock.Unlock()
+
+	if r.Header.Get("Private-Token") == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "401 Unauthorized"})
+		return
+	}
+
+	path := splitPath(r.URL)
+	if len(path) < 2 || path[0] != "api" || path[1] != "v4" {
+		notFound(w)
+		return
+	}
+
+	path = path[2:]
+
+	switch {
+	case match(r, "GET", path, "user"):
+		writeJSON(w, http.StatusOK, gl.user)
+
+	case match(r, "GET", path, "groups", "*", "projects"):
+		group := path[1]
+		subgroups := r.URL.Query().Get("include_subgroups") == "true"
+
+		var projects []*GitLabProject
+		for _, project := range gl.projects {
+			namespace := project.Namespace.FullPath
+			if namespace != group && !(subgroups && strings.HasPrefix(namespace, group+"/")) {
+				continue
+			}
+
+			if visibility := r.URL.Query().Get("visibility"); visibility != "" && project.Visibility != visibility {
+				continue
+			}
+
+			projects = append(projects, project)
+		}
+
+		gl.writePage(w, r, len(projects), func(i int) interface{} { return projects[i] })
+
+	case match(r, "GET", path, "projects", "*"):
+		project := gl.project(path[1])
+		if project == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, project)
+
+	case match(r, "GET", path, "projects", "*", "issues"):
+		var updatedAfter time.Time
+		if param := r.URL.Query().Get("updated_after"); param != "" {
+			updatedAfter, _ = time.Parse(time.RFC3339, param)
+		}
+
+		var issues []*GitLabIssue
+		for _, issue := range gl.issues[path[1]] {
+			if state := r.URL.Query().Get("state"); state != "" && issue.State != state {
+				continue
+			}
+
+			if issue.UpdatedAt.Before(updatedAfter) {
+				continue
+			}
+
+			issues = append(issues, issue)
+		}
+
+		gl.writePage(w, r, len(issues), func(i int) interface{} { return issues[i] })
+
+	case match(r, "GET", path, "projects", "*", "issues", "#"):
+		issue := gl.issue(path[1], atoi(path[3]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, issue)
+
+	case match(r, "PUT", path, "projects", "*", "issues", "#"):
+		issue := gl.issue(path[1], atoi(path[3]))
+		if issue == nil {
+			notFound(w)
+			return
+		}
+
+		var update struct {
+			StateEvent   string `json:"state_event"`
+			AddLabels    string `json:"add_labels"`
+			RemoveLabels string `json:"remove_labels"`
+		}
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		switch update.StateEvent {
+		case "close":
+			issue.State = "closed"
+		case "reopen":
+			issue.State = "opened"
+		}
+
+		for _, label := range splitLabels(update.AddLabels) {
+			if !containsString(issue.Labels, label) {
+				issue.Labels = append(issue.Labels, label)
+			}
+
+			// like GitLab, labels that don't exist yet are created
+			gl.ensureLabel(path[1], label)
+		}
+
+		for _, label := range splitLabels(update.RemoveLabels) {
+			var labels []string
+			for _, existing := range issue.Labels {
+				if existing != label {
+					labels = append(labels, existing)
+				}
+			}
+
+			issue.Labels = labels
+		}
+
+		issue.UpdatedAt = time.Now()
+
+		writeJSON(w, http.StatusOK, issue)
+
+	case match(r, "GET", path, "projects", "*", "labels"):
+		labels := gl.labels[path[1]]
+		gl.writePage(w, r, len(labels), func(i int) interface{} { return labels[i] })
+
+	case match(r, "POST", path, "projects", "*", "labels"):
+		var label GitLabLabel
+		if !readJSON(w, r, &label) {
+			return
+		}
+
+		for _, existing := range gl.labels[path[1]] {
+			if existing.Name == label.Name {
+				writeJSON(w, http.StatusConflict, map[string]string{"message": "Label already exists"})
+				return
+			}
+		}
+
+		created := gl.ensureLabel(path[1], label.Name)
+		created.Color = label.Color
+
+		writeJSON(w, http.StatusCreated, created)
+
+	case match(r, "PUT", path, "projects", "*", "labels", "*"):
+		var update GitLabLabel
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		for _, label := range gl.labels[path[1]] {
+			if label.Name == path[3] {
+				if update.Color != "" {
+					label.Color = update.Color
+				}
+
+				writeJSON(w, http.StatusOK, label)
+				return
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "projects", "*", "issues", "#", "notes"):
+		notes := gl.notes[issueKey(path[1], atoi(path[3]))]
+		gl.writePage(w, r, len(notes), func(i int) interface{} { return notes[i] })
+
+	case match(r, "POST", path, "projects", "*", "issues", "#", "notes"):
+		var create struct {
+			Body string `json:"body"`
+		}
+		if !readJSON(w, r, &create) {
+			return
+		}
+
+		if gl.issue(path[1], atoi(path[3])) == nil {
+			notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, gl.addNote(path[1], atoi(path[3]), gl.user, create.Body))
+
+	case match(r, "PUT", path, "projects", "*", "issues", "#", "notes", "#"):
+		var update struct {
+			Body string `json:"body"`
+		}
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		for _, note := range gl.notes[issueKey(path[1], atoi(path[3]))] {
+			if note.ID == atoi(path[5]) {
+				note.Body = update.Body
+				note.UpdatedAt = time.Now()
+				writeJSON(w, http.StatusOK, note)
+				return
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "projects", "*", "merge_requests"):
+		var updatedAfter time.Time
+		if param := r.URL.Query().Get("updated_after"); param != "" {
+			updatedAfter, _ = time.Parse(time.RFC3339, param)
+		}
+
+		var mrs []*GitLabMergeRequest
+		for _, mr := range gl.mergeRequests[path[1]] {
+			if state := r.URL.Query().Get("state"); state != "" && state != "all" && mr.State != state {
+				continue
+			}
+
+			if mr.UpdatedAt.Before(updatedAfter) {
+				continue
+			}
+
+			mrs = append(mrs, mr)
+		}
+
+		gl.writePage(w, r, len(mrs), func(i int) interface{} { return mrs[i] })
+
+	case match(r, "GET", path, "projects", "*", "merge_requests", "#", "commits"):
+		mr := gl.mergeRequest(path[1], atoi(path[3]))
+		if mr == nil {
+			notFound(w)
+			return
+		}
+
+		gl.writePage(w, r, len(mr.Commits), func(i int) interface{} { return mr.Commits[i] })
+
+	default:
+		notFound(w)
+	}
+}
+
+func (gl *GitLab) id() int {
+	gl.nextID++
+	return gl.nextID
+}
+
+func (gl *GitLab) newUser(username string) GitLabUser {
+	return GitLabUser{
+		ID:       gl.id(),
+		Username: username,
+		WebURL:   "https://gitlab.example.com/" + username,
+	}
+}
+
+// project finds a project by its path with namespace, which is how tracksuit
+// refers to them.
+func (gl *GitLab) project(path string) *GitLabProject {
+	for _, project := range gl.projects {
+		if project.PathWithNamespace == path {
+			return project
+		}
+	}
+
+	return nil
+}
+
+func (gl *GitLab) issue(project string, iid int) *GitLabIssue {
+	for _, issue := range gl.issues[project] {
+		if issue.IID == iid {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+func (gl *GitLab) mergeRequest(project string, iid int) *GitLabMergeRequest {
+	for _, mr := range gl.mergeRequests[project] {
+		if mr.IID == iid {
+			return mr
+		}
+	}
+
+	return nil
+}
+
+func (gl *GitLab) ensureLabel(project string, name string) *GitLabLabel {
+	for _, label := range gl.labels[project] {
+		if label.Name == name {
+			return label
+		}
+	}
+
+	label := &GitLabLabel{Name: name, Color: "#ededed"}
+	gl.labels[project] = append(gl.labels[project], label)
+
+	return label
+}
+
+func (gl *GitLab) addNote(project string, iid int, author GitLabUser, body string) *GitLabNote {
+	now := time.Now()
+
+	note := &GitLabNote{
+		ID:        gl.id(),
+		Body:      body,
+		Author:    author,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	gl.notes[issueKey(project, iid)] = append(gl.notes[issueKey(project, iid)], note)
+
+	if issue := gl.issue(project, iid); issue != nil {
+		issue.UpdatedAt = now
+	}
+
+	return note
+}
+
+// writePage writes the requested page of count items. Like GitLab, no more
+// than 100 are returned however many are asked for.
+func (gl *GitLab) writePage(w http.ResponseWriter, r *http.Request, count int, item func(int) interface{}) {
+	page := atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = 20
+	}
+
+	if perPage > maxGitLabPerPage {
+		perPage = maxGitLabPerPage
+	}
+
+	writeJSON(w, http.StatusOK, pageItems(page, perPage, count, item))
+}
+
+// pageItems returns the items on the given page, numbered from 1.
+func pageItems(page int, perPage int, count int, item func(int) interface{}) []interface{} {
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > count {
+		end = count
+	}
+
+	items := []interface{}{}
+	for i := start; i < end; i++ {
+		items = append(items, item(i))
+	}
+
+	return items
+}
+
+func splitLabels(labels string) []string {
+	if labels == "" {
+		return nil
+	}
+
+	return strings.Split(labels, ",")
+}
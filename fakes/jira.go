@@ -0,0 +1,635 @@
+package fakes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultJiraPageSize = 50
+
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// Jira is a fake of Jira's REST API holding a single project's issues and
+// comments in memory.
+//
+// Every issue shares a workflow with a status in each category, and may move
+// between any two of them. Searches only understand the JQL tracksuit sends.
+type Jira struct {
+	*httptest.Server
+
+	ProjectKey string
+
+	// PageSize is the most results returned in a page, unless the request
+	// asks for fewer. Set it low to exercise pagination.
+	PageSize int
+
+	lock sync.Mutex
+
+	issues []*JiraIssue
+
+	nextID     int
+	nextNumber int
+}
+
+type JiraIssue struct {
+	ID          string
+	Key         string
+	Summary     string
+	Description string
+	IssueType   string
+	Labels      []string
+	Assignee    *JiraUser
+
+	// StatusCategory is "new", "indeterminate", or "done".
+	StatusCategory string
+
+	Created  time.Time
+	Updated  time.Time
+	Resolved *time.Time
+
+	Comments []JiraComment
+}
+
+type JiraUser struct {
+	AccountID   string `json:"accountId"`
+	DisplayName string `json:"displayName"`
+}
+
+type JiraComment struct {
+	ID      string
+	Body    string
+	Author  JiraUser
+	Created time.Time
+}
+
+// jiraStatuses are the workflow's statuses by category, along with the ID of
+// the transition to each.
+var jiraStatuses = []struct {
+	Name         string
+	Category     string
+	TransitionID string
+}{
+	{"To Do", "new", "11"},
+	{"In Progress", "indeterminate", "21"},
+	{"Done", "done", "31"},
+}
+
+var jiraClausePattern = regexp.MustCompile(`^(\w+) (=|in|>=) (.+)$`)
+
+// NewJira starts a fake Jira API serving the given project.
+func NewJira(projectKey string) *Jira {
+	fake := &Jira{
+		ProjectKey: projectKey,
+		PageSize:   defaultJiraPageSize,
+
+		nextID: 10000,
+	}
+
+	fake.Server = httptest.NewServer(fake)
+
+	return fake
+}
+
+// AddIssue adds an issue of the given type to do, with the given labels.
+func (fake *Jira) AddIssue(summary string, issueType string, labels ...string) JiraIssue {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return *fake.createIssue(summary, "", issueType, labels)
+}
+
+// SetIssueStatus moves an issue to the status in the given category, as
+// someone working on it would.
+func (fake *Jira) SetIssueStatus(id string, category string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.setStatus(fake.issue(id), category)
+}
+
+// SetIssueAssignee assigns an issue to someone.
+func (fake *Jira) SetIssueAssignee(id string, user JiraUser) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	issue := fake.issue(id)
+	issue.Assignee = &user
+	issue.Updated = time.Now()
+}
+
+// SetIssueUpdated backdates when an issue was last updated.
+func (fake *Jira) SetIssueUpdated(id string, updated time.Time) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.issue(id).Updated = updated
+}
+
+// Issues returns copies of all issues, in the order they were created.
+func (fake *Jira) Issues() []JiraIssue {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	var issues []JiraIssue
+	for _, issue := range fake.issues {
+		issues = append(issues, *issue)
+	}
+
+	return issues
+}
+
+func (fake *Jira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	if r.Header.Get("Authorization") == "" {
+		writeJSON(w, http.StatusUnauthorized, jiraErrors("not authenticated"))
+		return
+	}
+
+	path := splitPath(r.URL)
+
+	switch {
+	case match(r, "GET", path, "rest", "api", "2", "search"):
+		issues, err := fake.search(r.URL.Query().Get("jql"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, jiraErrors(err.Error()))
+			return
+		}
+
+		start := atoi(r.URL.Query().Get("startAt"))
+		end := fake.pageEnd(r, start, len(issues))
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"startAt":    start,
+			"maxResults": end - start,
+			"total":      len(issues),
+			"issues":     fake.issuesJSON(issues[start:end]),
+		})
+
+	case match(r, "GET", path, "rest", "api", "2", "search", "jql"):
+		issues, err := fake.search(r.URL.Query().Get("jql"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, jiraErrors(err.Error()))
+			return
+		}
+
+		// the token is just the offset of the next page
+		start := atoi(r.URL.Query().Get("nextPageToken"))
+		end := fake.pageEnd(r, start, len(issues))
+
+		page := map[string]interface{}{
+			"issues": fake.issuesJSON(issues[start:end]),
+			"isLast": end == len(issues),
+		}
+
+		if end < len(issues) {
+			page["nextPageToken"] = strconv.Itoa(end)
+		}
+
+		writeJSON(w, http.StatusOK, page)
+
+	case match(r, "POST", path, "rest", "api", "2", "issue"):
+		var create struct {
+			Fields struct {
+				Project struct {
+					Key string `json:"key"`
+				} `json:"project"`
+				Summary     string `json:"summary"`
+				Description string `json:"description"`
+				IssueType   struct {
+					Name string `json:"name"`
+				} `json:"issuetype"`
+				Labels []string `json:"labels"`
+			} `json:"fields"`
+		}
+		if !readJSON(w, r, &create) {
+			return
+		}
+
+		if create.Fields.Project.Key != fake.ProjectKey {
+			writeJSON(w, http.StatusBadRequest, jiraErrors("unknown project "+create.Fields.Project.Key))
+			return
+		}
+
+		issue := fake.createIssue(create.Fields.Summary, create.Fields.Description, create.Fields.IssueType.Name, create.Fields.Labels)
+
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"id":   issue.ID,
+			"key":  issue.Key,
+			"self": fake.URL + "/rest/api/2/issue/" + issue.ID,
+		})
+
+	case match(r, "GET", path, "rest", "api", "2", "issue", "*"):
+		issue := fake.issue(path[4])
+		if issue == nil {
+			fake.notFound(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, fake.issueJSON(issue))
+
+	case match(r, "PUT", path, "rest", "api", "2", "issue", "*"):
+		issue := fake.issue(path[4])
+		if issue == nil {
+			fake.notFound(w)
+			return
+		}
+
+		var edit struct {
+			Fields struct {
+				Summary   *string `json:"summary"`
+				IssueType *struct {
+					Name string `json:"name"`
+				} `json:"issuetype"`
+			} `json:"fields"`
+			Update struct {
+				Labels []struct {
+					Add    string `json:"add"`
+					Remove string `json:"remove"`
+				} `json:"labels"`
+			} `json:"update"`
+		}
+		if !readJSON(w, r, &edit) {
+			return
+		}
+
+		if edit.Fields.Summary != nil {
+			issue.Summary = *edit.Fields.Summary
+		}
+
+		if edit.Fields.IssueType != nil {
+			issue.IssueType = edit.Fields.IssueType.Name
+		}
+
+		for _, op := range edit.Update.Labels {
+			if op.Add != "" && !containsString(issue.Labels, op.Add) {
+				issue.Labels = append(issue.Labels, op.Add)
+			}
+
+			if op.Remove != "" {
+				var labels []string
+				for _, label := range issue.Labels {
+					if label != op.Remove {
+						labels = append(labels, label)
+					}
+				}
+
+				issue.Labels = labels
+			}
+		}
+
+		issue.Updated = time.Now()
+
+		w.WriteHeader(http.StatusNoContent)
+
+	case match(r, "DELETE", path, "rest", "api", "2", "issue", "*"):
+		for i, issue := range fake.issues {
+			if issue.ID == path[4] || issue.Key == path[4] {
+				fake.issues = append(fake.issues[:i], fake.issues[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		fake.notFound(w)
+
+	case match(r, "GET", path, "rest", "api", "2", "issue", "*", "transitions"):
+		issue := fake.issue(path[4])
+		if issue == nil {
+			fake.notFound(w)
+			return
+		}
+
+		transitions := []interface{}{}
+		for _, status := range jiraStatuses {
+			if status.Category == issue.StatusCategory {
+				continue
+			}
+
+			transitions = append(transitions, map[string]interface{}{
+				"id":   status.TransitionID,
+				"name": status.Name,
+				"to":   jiraStatusJSON(status.Category),
+			})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"transitions": transitions})
+
+	case match(r, "POST", path, "rest", "api", "2", "issue", "*", "transitions"):
+		issue := fake.issue(path[4])
+		if issue == nil {
+			fake.notFound(w)
+			return
+		}
+
+		var transition struct {
+			Transition struct {
+				ID string `json:"id"`
+			} `json:"transition"`
+		}
+		if !readJSON(w, r, &transition) {
+			return
+		}
+
+		for _, status := range jiraStatuses {
+			if status.TransitionID == transition.Transition.ID && status.Category != issue.StatusCategory {
+				fake.setStatus(issue, status.Category)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusBadRequest, jiraErrors("transition "+transition.Transition.ID+" is not valid for this issue"))
+
+	case match(r, "GET", path, "rest", "api", "2", "issue", "*", "comment"):
+		issue := fake.issue(path[4])
+		if issue == nil {
+			fake.notFound(w)
+			return
+		}
+
+		start := atoi(r.URL.Query().Get("startAt"))
+		end := fake.pageEnd(r, start, len(issue.Comments))
+
+		comments := []interface{}{}
+		for _, comment := range issue.Comments[start:end] {
+			comments = append(comments, jiraCommentJSON(comment))
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"startAt":    start,
+			"maxResults": end - start,
+			"total":      len(issue.Comments),
+			"comments":   comments,
+		})
+
+	case match(r, "POST", path, "rest", "api", "2", "issue", "*", "comment"):
+		issue := fake.issue(path[4])
+		if issue == nil {
+			fake.notFound(w)
+			return
+		}
+
+		var create struct {
+			Body string `json:"body"`
+		}
+		if !readJSON(w, r, &create) {
+			return
+		}
+
+		comment := JiraComment{
+			ID:      fake.id(),
+			Body:    create.Body,
+			Author:  JiraUser{AccountID: "tracksuit", DisplayName: "tracksuit"},
+			Created: time.Now(),
+		}
+
+		issue.Comments = append(issue.Comments, comment)
+		issue.Updated = time.Now()
+
+		writeJSON(w, http.StatusCreated, jiraCommentJSON(comment))
+
+	default:
+		fake.notFound(w)
+	}
+}
+
+// search supports clauses on the project, labels, IDs, and relative update
+// times, joined with AND, which is all tracksuit uses.
+func (fake *Jira) search(jql string) ([]*JiraIssue, error) {
+	jql = strings.TrimSuffix(jql, " ORDER BY id")
+
+	var filters []func(*JiraIssue) bool
+	for _, clause := range strings.Split(jql, " AND ") {
+		parts := jiraClausePattern.FindStringSubmatch(clause)
+		if parts == nil {
+			return nil, fmt.Errorf("unsupported JQL clause '%s'", clause)
+		}
+
+		field, operator, value := parts[1], parts[2], parts[3]
+
+		switch {
+		case field == "project" && operator == "=":
+			if unquoteJQL(value) != fake.ProjectKey {
+				return nil, fmt.Errorf("unknown project %s", value)
+			}
+
+		case field == "labels" && operator == "=":
+			label := unquoteJQL(value)
+			filters = append(filters, func(issue *JiraIssue) bool {
+				return containsString(issue.Labels, label)
+			})
+
+		case field == "id" && operator == "in":
+			ids := strings.Split(strings.Trim(value, "()"), ",")
+
+			// like Jira, the whole search fails if any of the issues don't exist
+			for _, id := range ids {
+				if fake.issue(id) == nil {
+					return nil, fmt.Errorf("An issue with key '%s' does not exist for field 'id'.", id)
+				}
+			}
+
+			filters = append(filters, func(issue *JiraIssue) bool {
+				return containsString(ids, issue.ID)
+			})
+
+		case field == "updated" && operator == ">=":
+			ago, err := time.ParseDuration(strings.TrimPrefix(unquoteJQL(value), "-"))
+			if err != nil {
+				return nil, fmt.Errorf("unsupported relative date %s", value)
+			}
+
+			since := time.Now().Add(-ago)
+			filters = append(filters, func(issue *JiraIssue) bool {
+				return !issue.Updated.Before(since)
+			})
+
+		default:
+			return nil, fmt.Errorf("unsupported JQL clause '%s'", clause)
+		}
+	}
+
+	var issues []*JiraIssue
+
+	for _, issue := range fake.issues {
+		matched := true
+		for _, filter := range filters {
+			if !filter(issue) {
+				matched = false
+			}
+		}
+
+		if matched {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues, nil
+}
+
+// pageEnd returns where the page starting at start ends, given the requested
+// maxResults.
+func (fake *Jira) pageEnd(r *http.Request, start int, count int) int {
+	maxResults := atoi(r.URL.Query().Get("maxResults"))
+	if maxResults < 1 || maxResults > fake.PageSize {
+		maxResults = fake.PageSize
+	}
+
+	if start > count {
+		start = count
+	}
+
+	end := start + maxResults
+	if end > count {
+		end = count
+	}
+
+	return end
+}
+
+func (fake *Jira) createIssue(summary string, description string, issueType string, labels []string) *JiraIssue {
+	id := fake.id()
+	now := time.Now()
+
+	fake.nextNumber++
+
+	issue := &JiraIssue{
+		ID:             id,
+		Key:            fmt.Sprintf("%s-%d", fake.ProjectKey, fake.nextNumber),
+		Summary:        summary,
+		Description:    description,
+		IssueType:      issueType,
+		Labels:         labels,
+		StatusCategory: "new",
+		Created:        now,
+		Updated:        now,
+	}
+
+	fake.issues = append(fake.issues, issue)
+
+	return issue
+}
+
+func (fake *Jira) setStatus(issue *JiraIssue, category string) {
+	now := time.Now()
+
+	issue.StatusCategory = category
+	issue.Updated = now
+
+	if category == "done" {
+		issue.Resolved = &now
+	} else {
+		issue.Resolved = nil
+	}
+}
+
+// issue finds an issue by its ID or key.
+func (fake *Jira) issue(id string) *JiraIssue {
+	for _, issue := range fake.issues {
+		if issue.ID == id || issue.Key == id {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+func (fake *Jira) issuesJSON(issues []*JiraIssue) []interface{} {
+	payloads := []interface{}{}
+	for _, issue := range issues {
+		payloads = append(payloads, fake.issueJSON(issue))
+	}
+
+	return payloads
+}
+
+func (fake *Jira) issueJSON(issue *JiraIssue) map[string]interface{} {
+	labels := issue.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+
+	fields := map[string]interface{}{
+		"summary":     issue.Summary,
+		"description": issue.Description,
+		"issuetype":   map[string]string{"name": issue.IssueType},
+		"status":      jiraStatusJSON(issue.StatusCategory),
+		"labels":      labels,
+		"assignee":    issue.Assignee,
+		"created":     issue.Created.Format(jiraTimeLayout),
+		"updated":     issue.Updated.Format(jiraTimeLayout),
+	}
+
+	if issue.Resolved != nil {
+		fields["resolutiondate"] = issue.Resolved.Format(jiraTimeLayout)
+	}
+
+	return map[string]interface{}{
+		"id":     issue.ID,
+		"key":    issue.Key,
+		"self":   fake.URL + "/rest/api/2/issue/" + issue.ID,
+		"fields": fields,
+	}
+}
+
+func (fake *Jira) notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, jiraErrors("Issue does not exist or you do not have permission to see it."))
+}
+
+func (fake *Jira) id() string {
+	fake.nextID++
+	return strconv.Itoa(fake.nextID)
+}
+
+func jiraStatusJSON(category string) map[string]interface{} {
+	for _, status := range jiraStatuses {
+		if status.Category == category {
+			return map[string]interface{}{
+				"name":           status.Name,
+				"statusCategory": map[string]string{"key": status.Category},
+			}
+		}
+	}
+
+	return nil
+}
+
+func jiraCommentJSON(comment JiraComment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      comment.ID,
+		"body":    comment.Body,
+		"author":  comment.Author,
+		"created": comment.Created.Format(jiraTimeLayout),
+	}
+}
+
+func jiraErrors(message string) map[string]interface{} {
+	return map[string]interface{}{"errorMessages": []string{message}}
+}
+
+// unquoteJQL undoes the quoting of a JQL string, if it's quoted.
+func unquoteJQL(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
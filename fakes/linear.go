@@ -0,0 +1,614 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultLinearPageSize = 50
+
+// Linear is a fake of Linear's GraphQL API holding a single team's issues,
+// labels, and comments in memory.
+//
+// It doesn't parse GraphQL; requests are answered by operation name, which
+// covers the operations tracksuit sends.
+type Linear struct {
+	*httptest.Server
+
+	TeamKey string
+
+	// PageSize is the most results returned in a page, unless the request
+	// asks for fewer. Set it low to exercise pagination.
+	PageSize int
+
+	lock sync.Mutex
+
+	teamID string
+	states []LinearState
+	labels []LinearLabel
+	issues []*LinearIssue
+
+	nextID int
+}
+
+type LinearState struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type LinearLabel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type LinearUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+}
+
+type LinearIssue struct {
+	ID          string     `json:"id"`
+	Number      int        `json:"number"`
+	Identifier  string     `json:"identifier"`
+	URL         string     `json:"url"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	CanceledAt  *time.Time `json:"canceledAt"`
+
+	State    LinearState   `json:"state"`
+	Assignee *LinearUser   `json:"assignee"`
+	Labels   []LinearLabel `json:"-"`
+
+	Comments []LinearComment `json:"-"`
+}
+
+type LinearComment struct {
+	ID        string      `json:"id"`
+	Body      string      `json:"body"`
+	CreatedAt time.Time   `json:"createdAt"`
+	User      *LinearUser `json:"user"`
+}
+
+type linearRequest struct {
+	OperationName string                     `json:"operationName"`
+	Variables     map[string]json.RawMessage `json:"variables"`
+}
+
+// NewLinear starts a fake Linear API serving the given team, with a workflow
+// state of each type.
+func NewLinear(teamKey string) *Linear {
+	fake := &Linear{
+		TeamKey:  teamKey,
+		PageSize: defaultLinearPageSize,
+
+		nextID: 1,
+	}
+
+	fake.teamID = fake.id()
+
+	for _, stateType := range []string{"triage", "backlog", "unstarted", "started", "completed", "canceled"} {
+		fake.states = append(fake.states, LinearState{
+			ID:   fake.id(),
+			Name: strings.Title(stateType),
+			Type: stateType,
+		})
+	}
+
+	fake.Server = httptest.NewServer(fake)
+
+	return fake
+}
+
+// AddIssue adds an issue in the backlog with the given labels.
+func (fake *Linear) AddIssue(title string, labels ...string) LinearIssue {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	var labelIDs []string
+	for _, name := range labels {
+		labelIDs = append(labelIDs, fake.ensureLabel(name).ID)
+	}
+
+	return *fake.createIssue(title, "", labelIDs)
+}
+
+// SetIssueState moves an issue to the workflow state of the given type, as
+// someone working on it would.
+func (fake *Linear) SetIssueState(number int, stateType string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	issue := fake.issue(strconv.Itoa(number))
+	issue.State = fake.stateOfType(stateType)
+
+	now := time.Now()
+	switch stateType {
+	case "completed":
+		issue.CompletedAt = &now
+	case "canceled":
+		issue.CanceledAt = &now
+	}
+
+	issue.UpdatedAt = now
+}
+
+// Issues returns copies of all issues, ordered by number.
+func (fake *Linear) Issues() []LinearIssue {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	var issues []LinearIssue
+	for _, issue := range fake.issues {
+		issues = append(issues, *issue)
+	}
+
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Number < issues[j].Number })
+
+	return issues
+}
+
+// LabelNames returns the names of an issue's labels.
+func (issue LinearIssue) LabelNames() []string {
+	var names []string
+	for _, label := range issue.Labels {
+		names = append(names, label.Name)
+	}
+
+	return names
+}
+
+func (fake *Linear) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	var req linearRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	var data interface{}
+	var err error
+
+	switch req.OperationName {
+	case "Team":
+		data = map[string]interface{}{
+			"teams": map[string]interface{}{
+				"nodes": []interface{}{fake.team()},
+			},
+		}
+
+	case "Issues":
+		var filter map[string]interface{}
+		decode(req.Variables["filter"], &filter)
+
+		var issues []*LinearIssue
+		for _, issue := range fake.issues {
+			if fake.matches(issue, filter) {
+				issues = append(issues, issue)
+			}
+		}
+
+		data = map[string]interface{}{
+			"issues": fake.page(req, len(issues), func(i int) interface{} { return fake.issueJSON(issues[i]) }),
+		}
+
+	case "Issue":
+		var issue *LinearIssue
+		issue, err = fake.issueVar(req)
+		if err == nil {
+			data = map[string]interface{}{"issue": fake.issueJSON(issue)}
+		}
+
+	case "IssueCreate":
+		var input struct {
+			Title       string   `json:"title"`
+			Description string   `json:"description"`
+			LabelIDs    []string `json:"labelIds"`
+		}
+		decode(req.Variables["input"], &input)
+
+		issue := fake.createIssue(input.Title, input.Description, input.LabelIDs)
+		data = map[string]interface{}{"issueCreate": fake.issuePayload(issue)}
+
+	case "IssueUpdate":
+		var issue *LinearIssue
+		issue, err = fake.issueVar(req)
+		if err == nil {
+			var input struct {
+				Title    *string   `json:"title"`
+				StateID  *string   `json:"stateId"`
+				LabelIDs *[]string `json:"labelIds"`
+			}
+			decode(req.Variables["input"], &input)
+
+			if input.Title != nil {
+				issue.Title = *input.Title
+			}
+
+			if input.StateID != nil {
+				for _, state := range fake.states {
+					if state.ID == *input.StateID {
+						issue.State = state
+					}
+				}
+			}
+
+			if input.LabelIDs != nil {
+				issue.Labels = fake.labelsWithIDs(*input.LabelIDs)
+			}
+
+			issue.UpdatedAt = time.Now()
+
+			data = map[string]interface{}{"issueUpdate": fake.issuePayload(issue)}
+		}
+
+	case "IssueDelete":
+		var issue *LinearIssue
+		issue, err = fake.issueVar(req)
+		if err == nil {
+			for i, candidate := range fake.issues {
+				if candidate == issue {
+					fake.issues = append(fake.issues[:i], fake.issues[i+1:]...)
+					break
+				}
+			}
+
+			data = map[string]interface{}{"issueDelete": map[string]bool{"success": true}}
+		}
+
+	case "IssueAddLabel", "IssueRemoveLabel":
+		var issue *LinearIssue
+		issue, err = fake.issueVar(req)
+		if err == nil {
+			var labelID string
+			decode(req.Variables["labelId"], &labelID)
+
+			var labels []LinearLabel
+			for _, label := range issue.Labels {
+				if label.ID != labelID {
+					labels = append(labels, label)
+				}
+			}
+
+			if req.OperationName == "IssueAddLabel" {
+				labels = append(labels, fake.labelsWithIDs([]string{labelID})...)
+			}
+
+			issue.Labels = labels
+			issue.UpdatedAt = time.Now()
+
+			// e.g. issueAddLabel
+			data = map[string]interface{}{"issue" + req.OperationName[5:]: fake.issuePayload(issue)}
+		}
+
+	case "IssueLabels":
+		var filter struct {
+			Name struct {
+				Eq string `json:"eq"`
+			} `json:"name"`
+		}
+		decode(req.Variables["filter"], &filter)
+
+		labels := []LinearLabel{}
+		for _, label := range fake.labels {
+			if label.Name == filter.Name.Eq {
+				labels = append(labels, label)
+			}
+		}
+
+		data = map[string]interface{}{
+			"issueLabels": map[string]interface{}{"nodes": labels},
+		}
+
+	case "IssueLabelCreate":
+		var input struct {
+			Name string `json:"name"`
+		}
+		decode(req.Variables["input"], &input)
+
+		data = map[string]interface{}{
+			"issueLabelCreate": map[string]interface{}{
+				"success":    true,
+				"issueLabel": fake.ensureLabel(input.Name),
+			},
+		}
+
+	case "WorkflowStates":
+		var filter struct {
+			Type struct {
+				Eq string `json:"eq"`
+			} `json:"type"`
+		}
+		decode(req.Variables["filter"], &filter)
+
+		states := []LinearState{}
+		for _, state := range fake.states {
+			if filter.Type.Eq == "" || state.Type == filter.Type.Eq {
+				states = append(states, state)
+			}
+		}
+
+		data = map[string]interface{}{
+			"workflowStates": map[string]interface{}{"nodes": states},
+		}
+
+	case "IssueComments":
+		var issue *LinearIssue
+		issue, err = fake.issueVar(req)
+		if err == nil {
+			comments := issue.Comments
+			data = map[string]interface{}{
+				"issue": map[string]interface{}{
+					"comments": fake.page(req, len(comments), func(i int) interface{} { return comments[i] }),
+				},
+			}
+		}
+
+	case "CommentCreate":
+		var input struct {
+			IssueID string `json:"issueId"`
+			Body    string `json:"body"`
+		}
+		decode(req.Variables["input"], &input)
+
+		issue := fake.issue(input.IssueID)
+		if issue == nil {
+			err = fmt.Errorf("issue %s not found", input.IssueID)
+			break
+		}
+
+		comment := LinearComment{
+			ID:        fake.id(),
+			Body:      input.Body,
+			CreatedAt: time.Now(),
+			User:      &LinearUser{ID: "tracksuit", Name: "tracksuit", DisplayName: "tracksuit"},
+		}
+
+		issue.Comments = append(issue.Comments, comment)
+
+		data = map[string]interface{}{
+			"commentCreate": map[string]interface{}{"success": true, "comment": comment},
+		}
+
+	default:
+		err = fmt.Errorf("unknown operation '%s'", req.OperationName)
+	}
+
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"errors": []interface{}{errorBody(err.Error())},
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (fake *Linear) team() map[string]interface{} {
+	return map[string]interface{}{
+		"id":           fake.teamID,
+		"key":          fake.TeamKey,
+		"organization": map[string]string{"urlKey": "fake"},
+	}
+}
+
+// matches supports the team, number, labels, and updatedAt filters, which is
+// all tracksuit uses.
+func (fake *Linear) matches(issue *LinearIssue, filter map[string]interface{}) bool {
+	if numbers, found := dig(filter, "number", "in").([]interface{}); found {
+		match := false
+		for _, number := range numbers {
+			if int(number.(float64)) == issue.Number {
+				match = true
+			}
+		}
+
+		if !match {
+			return false
+		}
+	}
+
+	if name, found := dig(filter, "labels", "some", "name", "eq").(string); found {
+		match := false
+		for _, label := range issue.Labels {
+			if label.Name == name {
+				match = true
+			}
+		}
+
+		if !match {
+			return false
+		}
+	}
+
+	if since, found := dig(filter, "updatedAt", "gte").(string); found {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err == nil && issue.UpdatedAt.Before(sinceTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (fake *Linear) page(req linearRequest, count int, item func(int) interface{}) map[string]interface{} {
+	first := fake.PageSize
+	decode(req.Variables["first"], &first)
+	if first > fake.PageSize {
+		first = fake.PageSize
+	}
+
+	var after string
+	decode(req.Variables["after"], &after)
+
+	start := 0
+	if after != "" {
+		start = atoi(after)
+	}
+
+	end := start + first
+	if end > count {
+		end = count
+	}
+
+	nodes := []interface{}{}
+	for i := start; i < end; i++ {
+		nodes = append(nodes, item(i))
+	}
+
+	return map[string]interface{}{
+		"nodes": nodes,
+		"pageInfo": map[string]interface{}{
+			"hasNextPage": end < count,
+			"endCursor":   strconv.Itoa(end),
+		},
+	}
+}
+
+func (fake *Linear) issueVar(req linearRequest) (*LinearIssue, error) {
+	var id string
+	decode(req.Variables["id"], &id)
+
+	issue := fake.issue(id)
+	if issue == nil {
+		return nil, fmt.Errorf("issue %s not found", id)
+	}
+
+	return issue, nil
+}
+
+// issue finds an issue by its UUID, identifier, or number.
+func (fake *Linear) issue(id string) *LinearIssue {
+	for _, issue := range fake.issues {
+		if issue.ID == id || issue.Identifier == id || strconv.Itoa(issue.Number) == id {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+func (fake *Linear) issueJSON(issue *LinearIssue) map[string]interface{} {
+	var payload map[string]interface{}
+
+	encoded, _ := json.Marshal(issue)
+	json.Unmarshal(encoded, &payload)
+
+	labels := issue.Labels
+	if labels == nil {
+		labels = []LinearLabel{}
+	}
+
+	payload["labels"] = map[string]interface{}{"nodes": labels}
+
+	return payload
+}
+
+func (fake *Linear) issuePayload(issue *LinearIssue) map[string]interface{} {
+	return map[string]interface{}{
+		"success": true,
+		"issue":   fake.issueJSON(issue),
+	}
+}
+
+func (fake *Linear) createIssue(title string, description string, labelIDs []string) *LinearIssue {
+	now := time.Now()
+
+	number := len(fake.issues) + 1
+	for _, issue := range fake.issues {
+		if issue.Number >= number {
+			number = issue.Number + 1
+		}
+	}
+
+	issue := &LinearIssue{
+		ID:          fake.id(),
+		Number:      number,
+		Identifier:  fmt.Sprintf("%s-%d", fake.TeamKey, number),
+		URL:         fmt.Sprintf("https://linear.app/fake/issue/%s-%d", fake.TeamKey, number),
+		Title:       title,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		State:       fake.stateOfType("backlog"),
+		Labels:      fake.labelsWithIDs(labelIDs),
+	}
+
+	fake.issues = append(fake.issues, issue)
+
+	return issue
+}
+
+func (fake *Linear) stateOfType(stateType string) LinearState {
+	for _, state := range fake.states {
+		if state.Type == stateType {
+			return state
+		}
+	}
+
+	return LinearState{}
+}
+
+func (fake *Linear) labelsWithIDs(ids []string) []LinearLabel {
+	var labels []LinearLabel
+	for _, id := range ids {
+		for _, label := range fake.labels {
+			if label.ID == id {
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	return labels
+}
+
+func (fake *Linear) ensureLabel(name string) LinearLabel {
+	for _, label := range fake.labels {
+		if label.Name == name {
+			return label
+		}
+	}
+
+	label := LinearLabel{ID: fake.id(), Name: name}
+	fake.labels = append(fake.labels, label)
+
+	return label
+}
+
+func (fake *Linear) id() string {
+	fake.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", fake.nextID)
+}
+
+func decode(raw json.RawMessage, v interface{}) {
+	if len(raw) > 0 {
+		json.Unmarshal(raw, v)
+	}
+}
+
+// dig returns the value at the given path of nested JSON objects.
+func dig(value interface{}, path ...string) interface{} {
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = object[key]
+	}
+
+	return value
+}
@@ -0,0 +1,537 @@
+package fakes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xoebus/go-tracker"
+)
+
+const defaultTrackerPageSize = 100
+
+// storyStateUnstarted is the state of stories in the backlog, which
+// go-tracker doesn't name.
+const storyStateUnstarted tracker.StoryState = "unstarted"
+
+// trackerStory is a story with the fields go-tracker's Story leaves out.
+type trackerStory struct {
+	tracker.Story
+
+	Estimate *float64 `json:"estimate,omitempty"`
+	OwnerIDs []int    `json:"owner_ids,omitempty"`
+}
+
+// TrackerComment is a comment on a story, with the fields go-tracker's
+// Comment leaves out.
+type TrackerComment struct {
+	ID       int    `json:"id,omitempty"`
+	StoryID  int    `json:"story_id,omitempty"`
+	PersonID int    `json:"person_id,omitempty"`
+	Text     string `json:"text,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Tracker is a fake Tracker API holding a single project's stories, labels,
+// comments, and activity in memory.
+type Tracker struct {
+	*httptest.Server
+
+	ProjectID int
+
+	// PageSize is the most results returned in a page, unless the request
+	// asks for fewer. Set it low to exercise pagination.
+	PageSize int
+
+	lock sync.Mutex
+
+	stories  []trackerStory
+	labels   []tracker.Label
+	comments map[int][]TrackerComment
+	members  []tracker.ProjectMembership
+	activity []tracker.Activity
+
+	version int
+	nextID  int
+}
+
+// NewTracker starts a fake Tracker API serving the given project.
+func NewTracker(projectID int) *Tracker {
+	fake := &Tracker{
+		ProjectID: projectID,
+		PageSize:  defaultTrackerPageSize,
+
+		comments: map[int][]TrackerComment{},
+
+		nextID: 1000,
+	}
+
+	fake.Server = httptest.NewServer(fake)
+
+	return fake
+}
+
+// AddStory adds a story, assigning it an ID and creating its labels.
+func (fake *Tracker) AddStory(story tracker.Story) tracker.Story {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return fake.createStory(trackerStory{Story: story}).Story
+}
+
+// AddMember adds someone to the project.
+func (fake *Tracker) AddMember(person tracker.Person) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.members = append(fake.members, tracker.ProjectMembership{
+		ID:     fake.id(),
+		Person: person,
+	})
+}
+
+// SetStoryOwners assigns the story to the people with the given IDs, who
+// needn't be members of the project.
+func (fake *Tracker) SetStoryOwners(id int, ownerIDs ...int) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	story := fake.story(id)
+	story.OwnerIDs = ownerIDs
+
+	fake.touch(story)
+}
+
+// SetStoryState moves a story along, as someone working on it would.
+func (fake *Tracker) SetStoryState(id int, state tracker.StoryState) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	story := fake.story(id)
+	story.State = state
+
+	if state == tracker.StoryStateAccepted {
+		now := time.Now()
+		story.AcceptedAt = &now
+	}
+
+	fake.touch(story)
+}
+
+// Stories returns copies of all stories, ordered by ID.
+func (fake *Tracker) Stories() []tracker.Story {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	var stories []tracker.Story
+	for _, story := range fake.stories {
+		stories = append(stories, story.Story)
+	}
+
+	sort.Slice(stories, func(i, j int) bool { return stories[i].ID < stories[j].ID })
+
+	return stories
+}
+
+// StoriesWithLabel returns copies of the stories with the given label.
+func (fake *Tracker) StoriesWithLabel(label string) []tracker.Story {
+	var stories []tracker.Story
+	for _, story := range fake.Stories() {
+		if hasLabel(story, label) {
+			stories = append(stories, story)
+		}
+	}
+
+	return stories
+}
+
+// Comments returns copies of the comments on a story.
+func (fake *Tracker) Comments(storyID int) []TrackerComment {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return append([]TrackerComment(nil), fake.comments[storyID]...)
+}
+
+func (fake *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	path := splitPath(r.URL)
+
+	prefix := []string{"services", "v5", "projects", strconv.Itoa(fake.ProjectID)}
+	if len(path) < len(prefix) || strings.Join(path[:len(prefix)], "/") != strings.Join(prefix, "/") {
+		notFound(w)
+		return
+	}
+
+	path = path[len(prefix):]
+
+	switch {
+	case match(r, "GET", path, "stories"):
+		stories := fake.filterStories(r.URL.Query())
+		fake.writePage(w, r, len(stories), func(i int) interface{} { return stories[i] })
+
+	case match(r, "POST", path, "stories"):
+		var story trackerStory
+		if !readJSON(w, r, &story) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, fake.createStory(story))
+
+	case match(r, "PUT", path, "stories", "#"):
+		story := fake.story(atoi(path[1]))
+		if story == nil {
+			notFound(w)
+			return
+		}
+
+		var update tracker.Story
+		if !readJSON(w, r, &update) {
+			return
+		}
+
+		if update.State != "" {
+			story.State = update.State
+		}
+
+		if update.Type != "" {
+			story.Type = update.Type
+		}
+
+		if update.Name != "" {
+			story.Name = update.Name
+		}
+
+		fake.touch(story)
+
+		writeJSON(w, http.StatusOK, story)
+
+	case match(r, "DELETE", path, "stories", "#"):
+		for i, story := range fake.stories {
+			if story.ID == atoi(path[1]) {
+				fake.stories = append(fake.stories[:i], fake.stories[i+1:]...)
+				fake.record(story.ID)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "POST", path, "stories", "#", "labels"):
+		story := fake.story(atoi(path[1]))
+		if story == nil {
+			notFound(w)
+			return
+		}
+
+		var label tracker.Label
+		if !readJSON(w, r, &label) {
+			return
+		}
+
+		created := fake.ensureLabel(label.Name)
+		if !hasLabel(story.Story, created.Name) {
+			story.Labels = append(story.Labels, created)
+			fake.touch(story)
+		}
+
+		writeJSON(w, http.StatusOK, created)
+
+	case match(r, "DELETE", path, "stories", "#", "labels", "#"):
+		story := fake.story(atoi(path[1]))
+		if story == nil {
+			notFound(w)
+			return
+		}
+
+		for i, label := range story.Labels {
+			if label.ID == atoi(path[3]) {
+				story.Labels = append(story.Labels[:i], story.Labels[i+1:]...)
+				fake.touch(story)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "stories", "#", "comments"):
+		comments := append([]TrackerComment{}, fake.comments[atoi(path[1])]...)
+		writeJSON(w, http.StatusOK, comments)
+
+	case match(r, "POST", path, "stories", "#", "comments"):
+		story := fake.story(atoi(path[1]))
+		if story == nil {
+			notFound(w)
+			return
+		}
+
+		var comment TrackerComment
+		if !readJSON(w, r, &comment) {
+			return
+		}
+
+		now := time.Now()
+		comment.ID = fake.id()
+		comment.StoryID = story.ID
+		comment.CreatedAt = &now
+
+		fake.comments[story.ID] = append(fake.comments[story.ID], comment)
+		fake.touch(story)
+
+		writeJSON(w, http.StatusOK, comment)
+
+	case match(r, "GET", path, "labels"):
+		labels := []tracker.Label{}
+		for _, label := range fake.labels {
+			labels = append(labels, fake.withCounts(label))
+		}
+
+		writeJSON(w, http.StatusOK, labels)
+
+	case match(r, "DELETE", path, "labels", "#"):
+		id := atoi(path[1])
+
+		for i, label := range fake.labels {
+			if label.ID != id {
+				continue
+			}
+
+			fake.labels = append(fake.labels[:i], fake.labels[i+1:]...)
+
+			for s := range fake.stories {
+				story := &fake.stories[s]
+				for l, storyLabel := range story.Labels {
+					if storyLabel.ID == id {
+						story.Labels = append(story.Labels[:l], story.Labels[l+1:]...)
+						fake.touch(story)
+						break
+					}
+				}
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		notFound(w)
+
+	case match(r, "GET", path, "memberships"):
+		members := append([]tracker.ProjectMembership{}, fake.members...)
+		writeJSON(w, http.StatusOK, members)
+
+	case match(r, "GET", path, "activity"):
+		since := atoi(r.URL.Query().Get("since_version"))
+
+		// newest first, like Tracker
+		var activity []tracker.Activity
+		for i := len(fake.activity) - 1; i >= 0; i-- {
+			if fake.activity[i].ProjectVersion > since {
+				activity = append(activity, fake.activity[i])
+			}
+		}
+
+		fake.writePage(w, r, len(activity), func(i int) interface{} { return activity[i] })
+
+	default:
+		notFound(w)
+	}
+}
+
+// filterStories supports the with_label parameter and "id:" filters, which
+// is all tracksuit uses.
+func (fake *Tracker) filterStories(params url.Values) []trackerStory {
+	var ids map[int]bool
+	for _, term := range strings.Fields(params.Get("filter")) {
+		if !strings.HasPrefix(term, "id:") {
+			continue
+		}
+
+		ids = map[int]bool{}
+		for _, id := range strings.Split(strings.TrimPrefix(term, "id:"), ",") {
+			ids[atoi(id)] = true
+		}
+	}
+
+	label := params.Get("with_label")
+
+	stories := []trackerStory{}
+	for _, story := range fake.stories {
+		if ids != nil && !ids[story.ID] {
+			continue
+		}
+
+		if label != "" && !hasLabel(story.Story, label) {
+			continue
+		}
+
+		stories = append(stories, story)
+	}
+
+	return stories
+}
+
+func (fake *Tracker) createStory(story trackerStory) trackerStory {
+	now := time.Now()
+
+	story.ID = fake.id()
+	story.ProjectID = fake.ProjectID
+	story.URL = fmt.Sprintf("https://www.pivotaltracker.com/story/show/%d", story.ID)
+	story.CreatedAt = &now
+	story.UpdatedAt = &now
+
+	if story.State == "" {
+		story.State = tracker.StoryStateUnscheduled
+	}
+
+	if story.Type == "" {
+		story.Type = tracker.StoryTypeFeature
+	}
+
+	var labels []tracker.Label
+	for _, label := range story.Labels {
+		labels = append(labels, fake.ensureLabel(label.Name))
+	}
+
+	story.Labels = labels
+
+	fake.stories = append(fake.stories, story)
+	fake.record(story.ID)
+
+	return story
+}
+
+func (fake *Tracker) story(id int) *trackerStory {
+	for i := range fake.stories {
+		if fake.stories[i].ID == id {
+			return &fake.stories[i]
+		}
+	}
+
+	return nil
+}
+
+func (fake *Tracker) ensureLabel(name string) tracker.Label {
+	for _, label := range fake.labels {
+		if label.Name == name {
+			return label
+		}
+	}
+
+	label := tracker.Label{
+		ID:        fake.id(),
+		ProjectID: fake.ProjectID,
+		Name:      name,
+	}
+
+	fake.labels = append(fake.labels, label)
+
+	return label
+}
+
+func (fake *Tracker) withCounts(label tracker.Label) tracker.Label {
+	byState := &tracker.CountsByStoryState{}
+
+	for _, story := range fake.stories {
+		if !hasLabel(story.Story, label.Name) {
+			continue
+		}
+
+		switch story.State {
+		case tracker.StoryStateUnscheduled:
+			byState.Unscheduled++
+		case storyStateUnstarted:
+			byState.Unstarted++
+		case tracker.StoryStatePlanned:
+			byState.Planned++
+		case tracker.StoryStateStarted:
+			byState.Started++
+		case tracker.StoryStateFinished:
+			byState.Finished++
+		case tracker.StoryStateDelivered:
+			byState.Delivered++
+		case tracker.StoryStateAccepted:
+			byState.Accepted++
+		case tracker.StoryStateRejected:
+			byState.Rejected++
+		}
+	}
+
+	label.Counts = &tracker.StoryCounts{
+		NumberOfStoriesByState:          byState,
+		NumberOfZeroPointStoriesByState: &tracker.CountsByStoryState{},
+		SumOfStoryEstimatesByState:      &tracker.CountsByStoryState{},
+	}
+
+	return label
+}
+
+func (fake *Tracker) touch(story *trackerStory) {
+	now := time.Now()
+	story.UpdatedAt = &now
+
+	fake.record(story.ID)
+}
+
+// record bumps the project version, noting the story that changed.
+func (fake *Tracker) record(storyID int) {
+	fake.version++
+
+	fake.activity = append(fake.activity, tracker.Activity{
+		Kind:           "story_update_activity",
+		ProjectVersion: fake.version,
+		PrimaryResources: []interface{}{
+			map[string]interface{}{"kind": "story", "id": storyID},
+		},
+		OccurredAt: time.Now(),
+	})
+}
+
+func (fake *Tracker) id() int {
+	id := fake.nextID
+	fake.nextID++
+	return id
+}
+
+// writePage writes the requested page of count items along with Tracker's
+// pagination headers.
+func (fake *Tracker) writePage(w http.ResponseWriter, r *http.Request, count int, item func(int) interface{}) {
+	offset := atoi(r.URL.Query().Get("offset"))
+
+	limit := atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > fake.PageSize {
+		limit = fake.PageSize
+	}
+
+	items := []interface{}{}
+	for i := offset; i < count && i < offset+limit; i++ {
+		items = append(items, item(i))
+	}
+
+	w.Header().Set("X-Tracker-Pagination-Total", strconv.Itoa(count))
+	w.Header().Set("X-Tracker-Pagination-Offset", strconv.Itoa(offset))
+	w.Header().Set("X-Tracker-Pagination-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-Tracker-Pagination-Returned", strconv.Itoa(len(items)))
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+func hasLabel(story tracker.Story, name string) bool {
+	for _, label := range story.Labels {
+		if label.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
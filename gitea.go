@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const giteaPageSize = 50
+
+// GiteaSource syncs the issues of a Gitea (or Forgejo) organization. Gitea's
+// API is modeled on GitHub's, so most of its responses decode straight into
+// go-github's types.
+type GiteaSource struct {
+	URL   string
+	Token string
+
+	Client *http.Client
+}
+
+type giteaLabel struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+func NewGiteaSource(giteaURL string, token string, client *http.Client) *GiteaSource {
+	return &GiteaSource{
+		URL:    strings.TrimSuffix(giteaURL, "/"),
+		Token:  token,
+		Client: client,
+	}
+}
+
+func (source *GiteaSource) Host() string {
+	return hostOf(source.URL)
+}
+
+func (source *GiteaSource) Repos(organization string, includePrivate bool) ([]*Repository, error) {
+	var repos []*Repository
+	err := source.paginate("/orgs/"+url.PathEscape(organization)+"/repos", nil, func() interface{} {
+		return &[]*Repository{}
+	}, func(page interface{}) int {
+		pageRepos := *page.(*[]*Repository)
+		repos = append(repos, pageRepos...)
+		return len(pageRepos)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+func (source *GiteaSource) Repo(owner string, name string) (*Repository, error) {
+	var repo Repository
+	err := source.request("GET", source.repoPath(owner, name), nil, nil, &repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func (source *GiteaSource) Issues(repo *Repository, since time.Time) ([]*github.Issue, error) {
+	query := url.Values{"state": {"open"}, "type": {"issues"}}
+	if !since.IsZero() {
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+
+	var issues []*github.Issue
+	err := source.paginate(source.path(repo)+"/issues", query, func() interface{} {
+		return &[]*github.Issue{}
+	}, func(page interface{}) int {
+		pageIssues := *page.(*[]*github.Issue)
+		for _, issue := range pageIssues {
+			issues = append(issues, source.issue(issue))
+		}
+
+		return len(pageIssues)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+func (source *GiteaSource) Issue(repo *Repository, number int) (*github.Issue, error) {
+	var issue github.Issue
+	err := source.request("GET", source.issuePath(repo, number), nil, nil, &issue)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.issue(&issue), nil
+}
+
+func (source *GiteaSource) CloseIssue(repo *Repository, number int) error {
+	return source.request("PATCH", source.issuePath(repo, number), nil, map[string]string{"state": "closed"}, nil)
+}
+
+// AddIssueLabels adds labels to the issue by their IDs, which is all older
+// versions of Gitea accept.
+func (source *GiteaSource) AddIssueLabels(repo *Repository, number int, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	repoLabels, err := source.labels(repo)
+	if err != nil {
+		return err
+	}
+
+	ids := []int{}
+	for _, name := range labels {
+		label, found := repoLabels[name]
+		if !found {
+			return fmt.Errorf("gitea: label %q does not exist", name)
+		}
+
+		ids = append(ids, label.ID)
+	}
+
+	return source.request("POST", source.issuePath(repo, number)+"/labels", nil, map[string][]int{"labels": ids}, nil)
+}
+
+func (source *GiteaSource) RemoveIssueLabel(repo *Repository, number int, name string) error {
+	repoLabels, err := source.labels(repo)
+	if err != nil {
+		return err
+	}
+
+	label, found := repoLabels[name]
+	if !found {
+		return nil
+	}
+
+	return source.request("DELETE", fmt.Sprintf("%s/labels/%d", source.issuePath(repo, number), label.ID), nil, nil, nil)
+}
+
+func (source *GiteaSource) Labels(repo *Repository) ([]*github.Label, error) {
+	repoLabels, err := source.labels(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := []*github.Label{}
+	for _, label := range repoLabels {
+		labels = append(labels, forgeLabel(label.Name, label.Color))
+	}
+
+	return labels, nil
+}
+
+func (source *GiteaSource) CreateLabel(repo *Repository, name string, color string) error {
+	return source.request("POST", source.path(repo)+"/labels", nil, map[string]string{
+		"name":  name,
+		"color": forgeLabelColor(color),
+	}, nil)
+}
+
+func (source *GiteaSource) EditLabel(repo *Repository, name string, color string) error {
+	repoLabels, err := source.labels(repo)
+	if err != nil {
+		return err
+	}
+
+	label, found := repoLabels[name]
+	if !found {
+		return fmt.Errorf("gitea: label %q does not exist", name)
+	}
+
+	return source.request("PATCH", fmt.Sprintf("%s/labels/%d", source.path(repo), label.ID), nil, map[string]string{
+		"color": forgeLabelColor(color),
+	}, nil)
+}
+
+func (source *GiteaSource) Comments(repo *Repository, number int) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	seen := map[int]bool{}
+
+	err := source.paginate(source.issuePath(repo, number)+"/comments", nil, func() interface{} {
+		return &[]*github.IssueComment{}
+	}, func(page interface{}) int {
+		pageComments := *page.(*[]*github.IssueComment)
+		for _, comment := range pageComments {
+			// versions of Gitea that don't paginate comments return all of
+			// them for every page
+			if seen[*comment.ID] {
+				return 0
+			}
+
+			seen[*comment.ID] = true
+			comments = append(comments, comment)
+		}
+
+		return len(pageComments)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (source *GiteaSource) CreateComment(repo *Repository, number int, body string) (*github.IssueComment, error) {
+	var comment github.IssueComment
+	err := source.request("POST", source.issuePath(repo, number)+"/comments", nil, map[string]string{"body": body}, &comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (source *GiteaSource) EditComment(repo *Repository, number int, commentID int, body string) (*github.IssueComment, error) {
+	var comment github.IssueComment
+	err := source.request("PATCH", fmt.Sprintf("%s/issues/comments/%d", source.path(repo), commentID), nil, map[string]string{"body": body}, &comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (source *GiteaSource) CurrentUser() (*github.User, error) {
+	var user github.User
+	if err := source.request("GET", "/user", nil, nil, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (source *GiteaSource) PullRequests(repo *Repository, closedSince time.Time) ([]*PullRequest, error) {
+	var pulls []*PullRequest
+
+	query := url.Values{"state": {"all"}, "sort": {"recentupdate"}}
+
+	err := source.paginate(source.path(repo)+"/pulls", query, func() interface{} {
+		return &[]*PullRequest{}
+	}, func(page interface{}) int {
+		pagePulls := *page.(*[]*PullRequest)
+		for _, pull := range pagePulls {
+			if *pull.State == "closed" && pull.UpdatedAt != nil && pull.UpdatedAt.Before(closedSince) {
+				// sorted by most recently updated, so the rest are older
+				return 0
+			}
+
+			pulls = append(pulls, pull)
+		}
+
+		return len(pagePulls)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pulls, nil
+}
+
+func (source *GiteaSource) PullRequestCommits(repo *Repository, number int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	err := source.paginate(fmt.Sprintf("%s/pulls/%d/commits", source.path(repo), number), nil, func() interface{} {
+		return &[]*github.RepositoryCommit{}
+	}, func(page interface{}) int {
+		pageCommits := *page.(*[]*github.RepositoryCommit)
+		commits = append(commits, pageCommits...)
+		return len(pageCommits)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commits, nil
+}
+
+func (source *GiteaSource) labels(repo *Repository) (map[string]giteaLabel, error) {
+	labels := map[string]giteaLabel{}
+	err := source.paginate(source.path(repo)+"/labels", nil, func() interface{} {
+		return &[]giteaLabel{}
+	}, func(page interface{}) int {
+		pageLabels := *page.(*[]giteaLabel)
+		for _, label := range pageLabels {
+			labels[label.Name] = label
+		}
+
+		return len(pageLabels)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// issue fills in what Gitea leaves out of issues: older versions don't link
+// to their authors.
+func (source *GiteaSource) issue(issue *github.Issue) *github.Issue {
+	if issue.User != nil && issue.User.HTMLURL == nil && issue.User.Login != nil {
+		htmlURL := source.URL + "/" + *issue.User.Login
+		issue.User.HTMLURL = &htmlURL
+	}
+
+	for i, label := range issue.Labels {
+		if label.Color != nil {
+			color := strings.TrimPrefix(*label.Color, "#")
+			issue.Labels[i].Color = &color
+		}
+	}
+
+	return issue
+}
+
+func (source *GiteaSource) repoPath(owner string, name string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+}
+
+func (source *GiteaSource) path(repo *Repository) string {
+	return source.repoPath(*repo.Owner.Login, *repo.Name)
+}
+
+func (source *GiteaSource) issuePath(repo *Repository, number int) string {
+	return fmt.Sprintf("%s/issues/%d", source.path(repo), number)
+}
+
+// paginate fetches every page at the given path.
+func (source *GiteaSource) paginate(
+	path string,
+	query url.Values,
+	newPage func() interface{},
+	collect func(interface{}) int,
+) error {
+	return source.api().paginate(path, query, "limit", giteaPageSize, newPage, collect)
+}
+
+func (source *GiteaSource) request(method string, path string, query url.Values, body interface{}, result interface{}) error {
+	return source.api().request(method, path, query, body, result)
+}
+
+func (source *GiteaSource) api() restAPI {
+	return restAPI{
+		Name:    "gitea",
+		BaseURL: source.URL + "/api/v1",
+		Header:  http.Header{"Authorization": {"token " + source.Token}},
+		Client:  source.Client,
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vito/tracksuit/fakes"
+	"github.com/xoebus/go-tracker"
+)
+
+// giteaFixture syncs a fake Gitea organization with a fake Tracker project.
+type giteaFixture struct {
+	Gitea   *fakes.Gitea
+	Tracker *fakes.Tracker
+
+	Source *GiteaSource
+	Syncer *Syncer
+}
+
+func newGiteaFixture(t *testing.T) *giteaFixture {
+	gitea := fakes.NewGitea(testBotLogin)
+	t.Cleanup(gitea.Close)
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	t.Cleanup(fakeTracker.Close)
+
+	gitea.AddRepo(testOrganization, testRepo)
+
+	source := NewGiteaSource(gitea.URL, "some-token", nil)
+
+	return &giteaFixture{
+		Gitea:   gitea,
+		Tracker: fakeTracker,
+
+		Source: source,
+		Syncer: &Syncer{
+			Source:           source,
+			Backend:          NewTrackerBackend(fakeTracker.URL, testProjectID, "some-token", nil),
+			OrganizationName: testOrganization,
+			CloseIssues:      true,
+		},
+	}
+}
+
+func (fixture *giteaFixture) sync(t *testing.T) {
+	t.Helper()
+
+	if err := fixture.Syncer.SyncIssuesAndStories(); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+}
+
+func (fixture *giteaFixture) repo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo, err := fixture.Source.Repo(testOrganization, testRepo)
+	if err != nil {
+		t.Fatalf("failed to fetch repository: %s", err)
+	}
+
+	return repo
+}
+
+func (fixture *giteaFixture) stories(number int) []tracker.Story {
+	return fixture.Tracker.StoriesWithLabel(issueLabel(fixture.Source.Host(), testOrganization, testRepo, number))
+}
+
+func TestGiteaSyncCreatesStoriesForNewIssues(t *testing.T) {
+	fixture := newGiteaFixture(t)
+
+	fixture.Gitea.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	stories := fixture.stories(1)
+	if len(stories) != 1 {
+		t.Fatalf("expected a story for #1, got %+v", fixture.Tracker.Stories())
+	}
+
+	if stories[0].Name != "something broke" || stories[0].Type != tracker.StoryTypeBug {
+		t.Errorf("unexpected story: %+v", stories[0])
+	}
+
+	assertLabels(t, fixture.Gitea.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelUnscheduled)
+
+	comments := fixture.Gitea.Comments(testOrganization, testRepo, 1)
+	if len(comments) != 1 || comments[0].User.Login != testBotLogin || !strings.Contains(comments[0].Body, stories[0].URL) {
+		t.Fatalf("expected a status comment linking to the story, got %+v", comments)
+	}
+
+	fixture.sync(t)
+
+	if stories := fixture.stories(1); len(stories) != 1 {
+		t.Errorf("expected the story not to be duplicated, got %+v", stories)
+	}
+
+	if comments := fixture.Gitea.Comments(testOrganization, testRepo, 1); len(comments) != 1 {
+		t.Errorf("expected the status comment to be left alone, got %+v", comments)
+	}
+}
+
+func TestGiteaSyncMovesStateLabelsAndClosesIssues(t *testing.T) {
+	fixture := newGiteaFixture(t)
+
+	fixture.Gitea.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(1)[0]
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateStarted)
+	fixture.sync(t)
+	assertLabels(t, fixture.Gitea.IssueLabels(testOrganization, testRepo, 1), IssueLabelInFlight)
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+	fixture.sync(t)
+
+	if state := fixture.Gitea.Issue(testOrganization, testRepo, 1).State; state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+}
+
+func TestGiteaAddIssueLabelsSendsLabelIDs(t *testing.T) {
+	fixture := newGiteaFixture(t)
+
+	fixture.Gitea.AddIssue(testOrganization, testRepo, "something broke")
+
+	repo := fixture.repo(t)
+
+	for _, name := range []string{"first", "second"} {
+		if err := fixture.Source.CreateLabel(repo, name, "ededed"); err != nil {
+			t.Fatalf("failed to create label %s: %s", name, err)
+		}
+	}
+
+	if err := fixture.Source.AddIssueLabels(repo, 1, []string{"second", "first"}); err != nil {
+		t.Fatalf("failed to add labels: %s", err)
+	}
+
+	assertLabels(t, fixture.Gitea.IssueLabels(testOrganization, testRepo, 1), "second", "first")
+
+	if err := fixture.Source.RemoveIssueLabel(repo, 1, "second"); err != nil {
+		t.Fatalf("failed to remove label: %s", err)
+	}
+
+	assertLabels(t, fixture.Gitea.IssueLabels(testOrganization, testRepo, 1), "first")
+
+	err := fixture.Source.AddIssueLabels(repo, 1, []string{"missing"})
+	if err == nil || !strings.Contains(err.Error(), `label "missing" does not exist`) {
+		t.Errorf("expected adding a missing label to fail, got %v", err)
+	}
+}
+
+func TestGiteaPullRequestsStopAtTheLookback(t *testing.T) {
+	fixture := newGiteaFixture(t)
+
+	fixture.Gitea.AddPull(testOrganization, testRepo, "old", "")
+	fixture.Gitea.MergePull(testOrganization, testRepo, 1, "old-sha")
+
+	closedSince := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	fixture.Gitea.AddPull(testOrganization, testRepo, "merged", "")
+	fixture.Gitea.MergePull(testOrganization, testRepo, 2, "merged-sha")
+
+	fixture.Gitea.AddPull(testOrganization, testRepo, "open", "")
+
+	pulls, err := fixture.Source.PullRequests(fixture.repo(t), closedSince)
+	if err != nil {
+		t.Fatalf("failed to list pull requests: %s", err)
+	}
+
+	if len(pulls) != 2 {
+		t.Fatalf("expected the open pull request and the one merged since the lookback, got %d", len(pulls))
+	}
+
+	if *pulls[0].Number != 3 || *pulls[0].State != "open" {
+		t.Errorf("unexpected open pull request: %+v", pulls[0])
+	}
+
+	if *pulls[1].Number != 2 || pulls[1].MergedAt == nil || pulls[1].MergeCommitSHA == nil || *pulls[1].MergeCommitSHA != "merged-sha" {
+		t.Errorf("unexpected merged pull request: %+v", pulls[1])
+	}
+}
+
+func TestGiteaIssuesPaginates(t *testing.T) {
+	fixture := newGiteaFixture(t)
+
+	count := giteaPageSize*2 + 1
+	for i := 0; i < count; i++ {
+		fixture.Gitea.AddIssue(testOrganization, testRepo, "issue "+strconv.Itoa(i+1))
+	}
+
+	issues, err := fixture.Source.Issues(fixture.repo(t), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to list issues: %s", err)
+	}
+
+	if len(issues) != count {
+		t.Fatalf("expected %d issues across pages, got %d", count, len(issues))
+	}
+
+	for i, issue := range issues {
+		if *issue.Number != i+1 {
+			t.Fatalf("expected issue %d to be #%d, got #%d", i, i+1, *issue.Number)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+const mediaTypeGitHubAppPreview = "application/vnd.github.machine-man-preview+json"
+
+// installation tokens last an hour; refresh them well before then so that a
+// long request doesn't outlive its token
+const installationTokenRefreshMargin = 5 * time.Minute
+
+// GitHubApp authenticates as a GitHub App, minting tokens for each
+// organization the app is installed on.
+type GitHubApp struct {
+	ID         int
+	PrivateKey *rsa.PrivateKey
+
+	// BaseURL overrides the GitHub API URL.
+	BaseURL *url.URL
+
+	// Transport makes the requests for the app's JWT-authenticated calls.
+	Transport http.RoundTripper
+
+	Logger *Logger
+
+	slug     string
+	slugLock sync.Mutex
+}
+
+// LoadGitHubApp reads the app's PEM-encoded private key from keyPath.
+func LoadGitHubApp(id int, keyPath string) (*GitHubApp, error) {
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyPath)
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		key, ok = parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not an RSA key")
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected PEM block type '%s' in %s", block.Type, keyPath)
+	}
+
+	return &GitHubApp{
+		ID:         id,
+		PrivateKey: key,
+	}, nil
+}
+
+// TokenSource returns installation tokens for the app's installation on the
+// given organization, refreshing them before they expire.
+func (app *GitHubApp) TokenSource(org string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &installationTokenSource{
+		app: app,
+		org: org,
+	})
+}
+
+// BotLogin returns the login of the app's bot user, e.g. "tracksuit[bot]",
+// which is who comments and labels appear to come from.
+func (app *GitHubApp) BotLogin() (string, error) {
+	app.slugLock.Lock()
+	defer app.slugLock.Unlock()
+
+	if app.slug == "" {
+		var info struct {
+			Slug string `json:"slug"`
+		}
+
+		if err := app.do("GET", "app", &info); err != nil {
+			return "", fmt.Errorf("failed to fetch app: %s", err)
+		}
+
+		app.slug = info.Slug
+	}
+
+	return app.slug + "[bot]", nil
+}
+
+// jwt signs a short-lived token authenticating as the app itself.
+func (app *GitHubApp) jwt() (string, error) {
+	now := time.Now()
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		// allow for clock drift between us and GitHub
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.Itoa(app.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, app.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// do makes a request authenticated as the app, decoding the response into v.
+func (app *GitHubApp) do(method string, path string, v interface{}) error {
+	jwt, err := app.jwt()
+	if err != nil {
+		return fmt.Errorf("failed to sign JWT: %s", err)
+	}
+
+	transport := app.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	client := github.NewClient(&http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{
+				AccessToken: jwt,
+				TokenType:   "Bearer",
+			}),
+			Base: transport,
+		},
+	})
+
+	if app.BaseURL != nil {
+		client.BaseURL = app.BaseURL
+	}
+
+	req, err := client.NewRequest(method, path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", mediaTypeGitHubAppPreview)
+
+	_, err = client.Do(context.TODO(), req, v)
+	return err
+}
+
+type installationTokenSource struct {
+	app *GitHubApp
+	org string
+
+	installationID int
+}
+
+func (source *installationTokenSource) Token() (*oauth2.Token, error) {
+	if source.installationID == 0 {
+		id, err := source.findInstallation()
+		if err != nil {
+			return nil, err
+		}
+
+		source.installationID = id
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	err := source.app.do("POST", fmt.Sprintf("installations/%d/access_tokens", source.installationID), &token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for %s: %s", source.org, err)
+	}
+
+	source.app.Logger.Info("created installation token", "organization", source.org, "expires_at", token.ExpiresAt)
+
+	return &oauth2.Token{
+		AccessToken: token.Token,
+		TokenType:   "token",
+		Expiry:      token.ExpiresAt.Add(-installationTokenRefreshMargin),
+	}, nil
+}
+
+// findInstallation looks up the app's installation on the organization,
+// falling back to a user account of the same name.
+func (source *installationTokenSource) findInstallation() (int, error) {
+	var installation github.Installation
+
+	err := source.app.do("GET", fmt.Sprintf("orgs/%s/installation", source.org), &installation)
+	if errResp, ok := err.(*github.ErrorResponse); ok && errResp.Response.StatusCode == http.StatusNotFound {
+		err = source.app.do("GET", fmt.Sprintf("users/%s/installation", source.org), &installation)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to find installation for %s: %s", source.org, err)
+	}
+
+	return *installation.ID, nil
+}
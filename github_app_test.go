@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAppID = 1234
+
+// fakeGitHubApp serves the endpoints a GitHub App authenticates against,
+// checking that each request carries a JWT signed by the app's key.
+type fakeGitHubApp struct {
+	t   *testing.T
+	key *rsa.PublicKey
+
+	// Organizations and Users map the accounts the app is installed on to
+	// their installation IDs.
+	Organizations map[string]int
+	Users         map[string]int
+
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+func (app *fakeGitHubApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.lock.Lock()
+	app.requests[r.Method+" "+r.URL.Path]++
+	app.lock.Unlock()
+
+	if err := app.verify(r.Header.Get("Authorization")); err != "" {
+		app.t.Errorf("%s %s: %s", r.Method, r.URL.Path, err)
+		http.Error(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/app":
+		json.NewEncoder(w).Encode(map[string]string{"slug": "tracksuit"})
+
+	case r.Method == "GET" && len(path) == 3 && path[2] == "installation":
+		installations := app.Organizations
+		if path[0] == "users" {
+			installations = app.Users
+		}
+
+		id, found := installations[path[1]]
+		if !found {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]int{"id": id})
+
+	case r.Method == "POST" && len(path) == 3 && path[0] == "installations" && path[2] == "access_tokens":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "token-for-" + path[1],
+			"expires_at": time.Now().Add(time.Hour),
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verify returns what's wrong with the request's JWT, if anything.
+func (app *fakeGitHubApp) verify(authorization string) string {
+	jwt := strings.TrimPrefix(authorization, "Bearer ")
+	if jwt == authorization {
+		return "expected a bearer token, got " + authorization
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return "malformed JWT " + jwt
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "malformed signature: " + err.Error()
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(app.key, crypto.SHA256, digest[:], signature); err != nil {
+		return "bad signature: " + err.Error()
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "malformed claims: " + err.Error()
+	}
+
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "malformed claims: " + err.Error()
+	}
+
+	now := time.Now().Unix()
+	if claims.Issuer != strconv.Itoa(testAppID) || claims.IssuedAt > now || claims.ExpiresAt <= now || claims.ExpiresAt-claims.IssuedAt > 10*60 {
+		return "unexpected claims " + string(payload)
+	}
+
+	return ""
+}
+
+func (app *fakeGitHubApp) requested(method string, path string) int {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	return app.requests[method+" "+path]
+}
+
+func newTestGitHubApp(t *testing.T) (*GitHubApp, *fakeGitHubApp) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeGitHubApp{
+		t:   t,
+		key: &key.PublicKey,
+
+		requests: map[string]int{},
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	baseURL, _ := url.Parse(server.URL + "/")
+
+	return &GitHubApp{ID: testAppID, PrivateKey: key, BaseURL: baseURL}, fake
+}
+
+func TestGitHubAppExchangesJWTsForInstallationTokens(t *testing.T) {
+	app, fake := newTestGitHubApp(t)
+	fake.Organizations = map[string]int{"some-org": 1}
+	fake.Users = map[string]int{"someone": 2}
+
+	for owner, expected := range map[string]string{
+		"some-org": "token-for-1",
+		"someone":  "token-for-2",
+	} {
+		source := app.TokenSource(owner)
+
+		for i := 0; i < 2; i++ {
+			token, err := source.Token()
+			if err != nil {
+				t.Fatalf("failed to get a token for %s: %s", owner, err)
+			}
+
+			if token.AccessToken != expected || token.TokenType != "token" {
+				t.Errorf("unexpected token for %s: %+v", owner, token)
+			}
+
+			if remaining := time.Until(token.Expiry); remaining > time.Hour-installationTokenRefreshMargin || remaining < 50*time.Minute {
+				t.Errorf("expected the token to be refreshed ahead of expiring, got %s remaining", remaining)
+			}
+		}
+	}
+
+	if created := fake.requested("POST", "/installations/1/access_tokens"); created != 1 {
+		t.Errorf("expected the token to be reused until it expires, got %d tokens", created)
+	}
+
+	if fake.requested("GET", "/users/some-org/installation") != 0 || fake.requested("GET", "/users/someone/installation") != 1 {
+		t.Error("expected only the user's installation to be looked up as a user")
+	}
+
+	if _, err := app.TokenSource("nobody").Token(); err == nil || !strings.Contains(err.Error(), "failed to find installation for nobody") {
+		t.Errorf("expected an error without an installation, got %v", err)
+	}
+}
+
+func TestGitHubAppBotLogin(t *testing.T) {
+	app, fake := newTestGitHubApp(t)
+
+	for i := 0; i < 2; i++ {
+		login, err := app.BotLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if login != "tracksuit[bot]" {
+			t.Errorf("expected the bot's login, got %s", login)
+		}
+	}
+
+	if fetched := fake.requested("GET", "/app"); fetched != 1 {
+		t.Errorf("expected the app to be fetched once, got %d", fetched)
+	}
+}
+
+func TestLoadGitHubAppReadsPrivateKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	for _, block := range []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		path := filepath.Join(dir, "key.pem")
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		app, err := LoadGitHubApp(testAppID, path)
+		if err != nil {
+			t.Fatalf("failed to load %s: %s", block.Type, err)
+		}
+
+		if app.ID != testAppID || !app.PrivateKey.Equal(key) {
+			t.Errorf("expected the %s to be loaded", block.Type)
+		}
+	}
+
+	for name, contents := range map[string][]byte{
+		"not-pem.pem":     []byte("not a key"),
+		"certificate.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a key")}),
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadGitHubApp(testAppID, path); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+}
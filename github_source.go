@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+)
+
+// GitHubSource syncs the issues of a GitHub organization.
+type GitHubSource struct {
+	Client *github.Client
+
+	// BotLogin is the login of the GitHub App bot the client is authenticated
+	// as, if any. Bots can't look themselves up like users can.
+	BotLogin string
+
+	// InstallationRepos lists the repositories the GitHub App installation
+	// can access rather than those of the organization.
+	InstallationRepos bool
+}
+
+func (source *GitHubSource) Host() string {
+	return ""
+}
+
+func (source *GitHubSource) Repo(owner string, name string) (*Repository, error) {
+	var repo Repository
+	_, err := source.get(fmt.Sprintf("repos/%s/%s", owner, name), nil, "", &repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+func (source *GitHubSource) Issue(repo *Repository, number int) (*github.Issue, error) {
+	issue, _, err := source.Client.Issues.Get(context.TODO(), *repo.Owner.Login, *repo.Name, number)
+	return issue, err
+}
+
+func (source *GitHubSource) CloseIssue(repo *Repository, number int) error {
+	state := "closed"
+	_, _, err := source.Client.Issues.Edit(
+		context.TODO(),
+		*repo.Owner.Login,
+		*repo.Name,
+		number,
+		&github.IssueRequest{State: &state},
+	)
+	return err
+}
+
+func (source *GitHubSource) AddIssueLabels(repo *Repository, number int, labels []string) error {
+	_, _, err := source.Client.Issues.AddLabelsToIssue(context.TODO(), *repo.Owner.Login, *repo.Name, number, labels)
+	return err
+}
+
+func (source *GitHubSource) RemoveIssueLabel(repo *Repository, number int, label string) error {
+	_, err := source.Client.Issues.RemoveLabelForIssue(context.TODO(), *repo.Owner.Login, *repo.Name, number, label)
+	return err
+}
+
+func (source *GitHubSource) CreateLabel(repo *Repository, name string, color string) error {
+	_, _, err := source.Client.Issues.CreateLabel(
+		context.TODO(),
+		*repo.Owner.Login,
+		*repo.Name,
+		&github.Label{
+			Name:  &name,
+			Color: &color,
+		},
+	)
+	return err
+}
+
+func (source *GitHubSource) EditLabel(repo *Repository, name string, color string) error {
+	_, _, err := source.Client.Issues.EditLabel(
+		context.TODO(),
+		*repo.Owner.Login,
+		*repo.Name,
+		name,
+		&github.Label{
+			Name:  &name,
+			Color: &color,
+		},
+	)
+	return err
+}
+
+func (source *GitHubSource) CreateComment(repo *Repository, number int, body string) (*github.IssueComment, error) {
+	comment, _, err := source.Client.Issues.CreateComment(
+		context.TODO(),
+		*repo.Owner.Login,
+		*repo.Name,
+		number,
+		&github.IssueComment{Body: &body},
+	)
+	return comment, err
+}
+
+func (source *GitHubSource) EditComment(repo *Repository, number int, commentID int, body string) (*github.IssueComment, error) {
+	comment, _, err := source.Client.Issues.EditComment(
+		context.TODO(),
+		*repo.Owner.Login,
+		*repo.Name,
+		commentID,
+		&github.IssueComment{Body: &body},
+	)
+	return comment, err
+}
+
+func (source *GitHubSource) CurrentUser() (*github.User, error) {
+	// an empty login fetches the authenticated user
+	user, _, err := source.Client.Users.Get(context.TODO(), source.BotLogin)
+	return user, err
+}
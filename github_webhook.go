@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/hashicorp/go-multierror"
+)
+
+// GitHubWebhookHandler syncs the issue affected by each webhook delivery
+// rather than waiting for the next full sync.
+//
+// Deliveries are acknowledged as soon as they're verified, and synced in the
+// background by Queue, since GitHub gives up on deliveries after 10 seconds.
+type GitHubWebhookHandler struct {
+	Syncers []*Syncer
+	Secret  []byte
+
+	Queue *WorkQueue
+
+	Logger *Logger
+}
+
+func (handler *GitHubWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := github.ValidatePayload(r, handler.Secret)
+	if err != nil {
+		handler.Logger.Warn("rejecting webhook", "error", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	eventType := github.WebHookType(r)
+
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		handler.Logger.Debug("ignoring webhook", "error", err)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// decoded again for what go-github's Repository leaves out
+	var repoPayload struct {
+		Repository *Repository `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &repoPayload); err != nil {
+		handler.Logger.Debug("ignoring webhook", "error", err)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	repo := repoPayload.Repository
+
+	switch event := event.(type) {
+	case *github.PingEvent:
+		handler.Logger.Info("received ping")
+
+	case *github.IssuesEvent:
+		if event.Action != nil && (*event.Action == "deleted" || *event.Action == "transferred") {
+			// there's no issue left to sync; its stories are left for
+			// orphan reconciliation
+			handler.Logger.Info("ignoring event", "event", eventType, "action", *event.Action, "issue", *event.Issue.Number)
+			break
+		}
+
+		handler.syncIssue(eventType, repo, *event.Issue.Number)
+
+	case *github.IssueCommentEvent:
+		if handler.sentBySyncer(event.Sender) {
+			// our own status comment being created or updated
+			break
+		}
+
+		handler.syncIssue(eventType, repo, *event.Issue.Number)
+
+	case *github.PullRequestEvent:
+		number := *event.Number
+
+		handler.Logger.Info(
+			"received event",
+			"event", eventType,
+			"repo", *repo.Owner.Login+"/"+*repo.Name,
+			"pull_request", number,
+		)
+
+		handler.Queue.Enqueue(fmt.Sprintf("pull:%s/%s#%d", *repo.Owner.Login, *repo.Name, number), func() error {
+			return handler.eachSyncer(func(syncer *Syncer) error {
+				return syncer.SyncPullRequest(repo, number)
+			})
+		})
+
+	case *github.LabelEvent:
+		handler.Logger.Info("received event", "event", eventType, "repo", *repo.Owner.Login+"/"+*repo.Name)
+
+		handler.Queue.Enqueue(fmt.Sprintf("labels:%s/%s", *repo.Owner.Login, *repo.Name), func() error {
+			return handler.eachSyncer(func(syncer *Syncer) error {
+				return syncer.SyncRepoLabels(repo)
+			})
+		})
+
+	default:
+		handler.Logger.Debug("ignoring webhook", "event", eventType)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (handler *GitHubWebhookHandler) syncIssue(eventType string, repo *Repository, number int) {
+	handler.Logger.Info("received event", "event", eventType, "repo", *repo.Owner.Login+"/"+*repo.Name, "issue", number)
+
+	handler.Queue.Enqueue(fmt.Sprintf("issue:%s/%s#%d", *repo.Owner.Login, *repo.Name, number), func() error {
+		return handler.eachSyncer(func(syncer *Syncer) error {
+			return syncer.SyncIssue(repo, number)
+		})
+	})
+}
+
+// eachSyncer runs sync with every syncer, carrying on past failures so that
+// one mapping failing doesn't hold up the rest.
+func (handler *GitHubWebhookHandler) eachSyncer(sync func(*Syncer) error) error {
+	var multiErr *multierror.Error
+	for _, syncer := range handler.Syncers {
+		if err := sync(syncer); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+
+	return multiErr.ErrorOrNil()
+}
+
+func (handler *GitHubWebhookHandler) sentBySyncer(sender *github.User) bool {
+	if sender == nil || len(handler.Syncers) == 0 {
+		return false
+	}
+
+	// all syncers share the same GitHub credentials
+	currentUser, err := handler.Syncers[0].currentUser()
+	if err != nil {
+		handler.Logger.Error("failed to get current user", err)
+		return false
+	}
+
+	return *sender.ID == *currentUser.ID
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "some-secret"
+
+type githubWebhookFixture struct {
+	*syncFixture
+
+	Lock    *sync.Mutex
+	Queue   *WorkQueue
+	Handler *GitHubWebhookHandler
+}
+
+func newGitHubWebhookFixture(t *testing.T) *githubWebhookFixture {
+	fixture := newSyncFixture(t)
+
+	lock := &sync.Mutex{}
+
+	queue := NewWorkQueue(lock, nil)
+	go queue.Run()
+
+	return &githubWebhookFixture{
+		syncFixture: fixture,
+
+		Lock:  lock,
+		Queue: queue,
+
+		Handler: &GitHubWebhookHandler{
+			Syncers: []*Syncer{fixture.Syncer},
+			Secret:  []byte(testWebhookSecret),
+			Queue:   queue,
+		},
+	}
+}
+
+// deliver posts the event, signed with the given secret, failing if the
+// handler doesn't respond promptly.
+func (fixture *githubWebhookFixture) deliver(t *testing.T, secret string, eventType string, event interface{}) int {
+	t.Helper()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(payload)
+
+	req := httptest.NewRequest("POST", "/github", bytes.NewReader(payload))
+	req.Header.Set("X-Github-Event", eventType)
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+
+	recorder := httptest.NewRecorder()
+
+	served := make(chan struct{})
+	go func() {
+		fixture.Handler.ServeHTTP(recorder, req)
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the delivery to be acknowledged")
+	}
+
+	return recorder.Code
+}
+
+func issuesEvent(action string, number int) map[string]interface{} {
+	return map[string]interface{}{
+		"action": action,
+		"issue":  map[string]interface{}{"number": number},
+		"repository": map[string]interface{}{
+			"name":  testRepo,
+			"owner": map[string]interface{}{"login": testOrganization},
+		},
+	}
+}
+
+func TestGitHubWebhookSyncsIssues(t *testing.T) {
+	fixture := newGitHubWebhookFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	if code := fixture.deliver(t, testWebhookSecret, "issues", issuesEvent("opened", 1)); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	fixture.Queue.Wait()
+
+	fixture.stories(t, 1, 1)
+
+	if comments := fixture.botComments(1); len(comments) != 1 {
+		t.Fatalf("expected a status comment, got %d comments", len(comments))
+	}
+}
+
+func TestGitHubWebhookAcknowledgesDeliveriesDuringFullSyncs(t *testing.T) {
+	fixture := newGitHubWebhookFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	// a full sync in progress
+	fixture.Lock.Lock()
+
+	if code := fixture.deliver(t, testWebhookSecret, "issues", issuesEvent("opened", 1)); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	if code := fixture.deliver(t, testWebhookSecret, "issues", issuesEvent("labeled", 1)); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	fixture.stories(t, 1, 0)
+
+	fixture.Lock.Unlock()
+
+	fixture.Queue.Wait()
+
+	fixture.stories(t, 1, 1)
+}
+
+func TestGitHubWebhookAcknowledgesIssuesThatAreGone(t *testing.T) {
+	fixture := newGitHubWebhookFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.DeleteIssue(testOrganization, testRepo, 1)
+
+	for _, action := range []string{"deleted", "transferred", "edited"} {
+		if code := fixture.deliver(t, testWebhookSecret, "issues", issuesEvent(action, 1)); code != http.StatusAccepted {
+			t.Fatalf("expected %d for %s, got %d", http.StatusAccepted, action, code)
+		}
+	}
+
+	fixture.Queue.Wait()
+
+	fixture.stories(t, 1, 0)
+
+	repo, err := fixture.Syncer.Source.Repo(testOrganization, testRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fixture.Syncer.SyncIssue(repo, 1); err != nil {
+		t.Fatalf("expected syncing an issue that is gone to succeed, got %s", err)
+	}
+}
+
+func TestGitHubWebhookRejectsUnsignedDeliveries(t *testing.T) {
+	fixture := newGitHubWebhookFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	if code := fixture.deliver(t, "wrong-secret", "issues", issuesEvent("opened", 1)); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	fixture.Queue.Wait()
+
+	fixture.stories(t, 1, 0)
+}
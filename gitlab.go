@@ -0,0 +1,468 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// GitLabDefaultURL is where GitLab.com is served.
+const GitLabDefaultURL = "https://gitlab.com"
+
+const gitlabPageSize = 100
+
+// GitLabSource syncs the issues of the projects in a GitLab group, including
+// its subgroups. Issues with related merge requests are treated like GitHub
+// issues with a pull request.
+type GitLabSource struct {
+	URL   string
+	Token string
+
+	Client *http.Client
+}
+
+type gitlabProject struct {
+	ID                int             `json:"id"`
+	Path              string          `json:"path"`
+	PathWithNamespace string          `json:"path_with_namespace"`
+	Visibility        string          `json:"visibility"`
+	Archived          bool            `json:"archived"`
+	ForkedFromProject *struct{}       `json:"forked_from_project"`
+	WebURL            string          `json:"web_url"`
+	Topics            []string        `json:"topics"`
+	Namespace         gitlabNamespace `json:"namespace"`
+}
+
+type gitlabNamespace struct {
+	FullPath string `json:"full_path"`
+}
+
+type gitlabUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	WebURL   string `json:"web_url"`
+}
+
+type gitlabIssue struct {
+	ID                 int        `json:"id"`
+	IID                int        `json:"iid"`
+	Title              string     `json:"title"`
+	Description        string     `json:"description"`
+	State              string     `json:"state"`
+	Labels             []string   `json:"labels"`
+	Author             gitlabUser `json:"author"`
+	WebURL             string     `json:"web_url"`
+	CreatedAt          *time.Time `json:"created_at"`
+	UpdatedAt          *time.Time `json:"updated_at"`
+	MergeRequestsCount int        `json:"merge_requests_count"`
+}
+
+type gitlabLabel struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type gitlabNote struct {
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	Author    gitlabUser `json:"author"`
+	System    bool       `json:"system"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type gitlabMergeRequest struct {
+	IID             int        `json:"iid"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	State           string     `json:"state"`
+	WebURL          string     `json:"web_url"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+	MergedAt        *time.Time `json:"merged_at"`
+	MergeCommitSHA  string     `json:"merge_commit_sha"`
+	SquashCommitSHA string     `json:"squash_commit_sha"`
+}
+
+type gitlabCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+func NewGitLabSource(gitlabURL string, token string, client *http.Client) *GitLabSource {
+	return &GitLabSource{
+		URL:    strings.TrimSuffix(gitlabURL, "/"),
+		Token:  token,
+		Client: client,
+	}
+}
+
+func (source *GitLabSource) Host() string {
+	return hostOf(source.URL)
+}
+
+func (source *GitLabSource) Repos(organization string, includePrivate bool) ([]*Repository, error) {
+	query := url.Values{"include_subgroups": {"true"}}
+	if !includePrivate {
+		query.Set("visibility", "public")
+	}
+
+	var repos []*Repository
+	err := source.paginate("/groups/"+url.PathEscape(organization)+"/projects", query, func() interface{} {
+		return &[]gitlabProject{}
+	}, func(page interface{}) int {
+		projects := *page.(*[]gitlabProject)
+		for _, project := range projects {
+			repos = append(repos, project.repository())
+		}
+
+		return len(projects)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+func (source *GitLabSource) Repo(owner string, name string) (*Repository, error) {
+	var project gitlabProject
+	err := source.request("GET", source.projectPath(owner, name), nil, nil, &project)
+	if err != nil {
+		return nil, err
+	}
+
+	return project.repository(), nil
+}
+
+func (source *GitLabSource) Issues(repo *Repository, since time.Time) ([]*github.Issue, error) {
+	query := url.Values{"state": {"opened"}}
+	if !since.IsZero() {
+		query.Set("updated_after", since.UTC().Format(time.RFC3339))
+	}
+
+	var issues []*github.Issue
+	err := source.paginate(source.repoPath(repo)+"/issues", query, func() interface{} {
+		return &[]gitlabIssue{}
+	}, func(page interface{}) int {
+		gitlabIssues := *page.(*[]gitlabIssue)
+		for _, issue := range gitlabIssues {
+			issues = append(issues, issue.issue())
+		}
+
+		return len(gitlabIssues)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+func (source *GitLabSource) Issue(repo *Repository, number int) (*github.Issue, error) {
+	var issue gitlabIssue
+	err := source.request("GET", source.issuePath(repo, number), nil, nil, &issue)
+	if err != nil {
+		return nil, err
+	}
+
+	return issue.issue(), nil
+}
+
+func (source *GitLabSource) CloseIssue(repo *Repository, number int) error {
+	return source.request("PUT", source.issuePath(repo, number), nil, map[string]string{"state_event": "close"}, nil)
+}
+
+func (source *GitLabSource) AddIssueLabels(repo *Repository, number int, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return source.request("PUT", source.issuePath(repo, number), nil, map[string]string{
+		"add_labels": strings.Join(labels, ","),
+	}, nil)
+}
+
+func (source *GitLabSource) RemoveIssueLabel(repo *Repository, number int, label string) error {
+	return source.request("PUT", source.issuePath(repo, number), nil, map[string]string{
+		"remove_labels": label,
+	}, nil)
+}
+
+func (source *GitLabSource) Labels(repo *Repository) ([]*github.Label, error) {
+	var labels []*github.Label
+	err := source.paginate(source.repoPath(repo)+"/labels", nil, func() interface{} {
+		return &[]gitlabLabel{}
+	}, func(page interface{}) int {
+		gitlabLabels := *page.(*[]gitlabLabel)
+		for _, label := range gitlabLabels {
+			labels = append(labels, forgeLabel(label.Name, label.Color))
+		}
+
+		return len(gitlabLabels)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+func (source *GitLabSource) CreateLabel(repo *Repository, name string, color string) error {
+	return source.request("POST", source.repoPath(repo)+"/labels", nil, map[string]string{
+		"name":  name,
+		"color": forgeLabelColor(color),
+	}, nil)
+}
+
+func (source *GitLabSource) EditLabel(repo *Repository, name string, color string) error {
+	return source.request("PUT", source.repoPath(repo)+"/labels/"+url.PathEscape(name), nil, map[string]string{
+		"color": forgeLabelColor(color),
+	}, nil)
+}
+
+// Comments returns the notes on the issue, leaving out those GitLab leaves
+// itself, e.g. for label changes.
+func (source *GitLabSource) Comments(repo *Repository, number int) ([]*github.IssueComment, error) {
+	query := url.Values{"sort": {"asc"}, "order_by": {"created_at"}}
+
+	var comments []*github.IssueComment
+	err := source.paginate(source.issuePath(repo, number)+"/notes", query, func() interface{} {
+		return &[]gitlabNote{}
+	}, func(page interface{}) int {
+		notes := *page.(*[]gitlabNote)
+		for _, note := range notes {
+			if !note.System {
+				comments = append(comments, source.comment(repo, number, note))
+			}
+		}
+
+		return len(notes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (source *GitLabSource) CreateComment(repo *Repository, number int, body string) (*github.IssueComment, error) {
+	var note gitlabNote
+	err := source.request("POST", source.issuePath(repo, number)+"/notes", nil, map[string]string{"body": body}, &note)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.comment(repo, number, note), nil
+}
+
+func (source *GitLabSource) EditComment(repo *Repository, number int, commentID int, body string) (*github.IssueComment, error) {
+	var note gitlabNote
+	err := source.request("PUT", fmt.Sprintf("%s/notes/%d", source.issuePath(repo, number), commentID), nil, map[string]string{"body": body}, &note)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.comment(repo, number, note), nil
+}
+
+func (source *GitLabSource) CurrentUser() (*github.User, error) {
+	var user gitlabUser
+	if err := source.request("GET", "/user", nil, nil, &user); err != nil {
+		return nil, err
+	}
+
+	return user.user(), nil
+}
+
+// PullRequests returns the open merge requests along with those merged since
+// the given time. Merge requests closed without merging are left out, as
+// they can't deliver anything.
+func (source *GitLabSource) PullRequests(repo *Repository, closedSince time.Time) ([]*PullRequest, error) {
+	var pulls []*PullRequest
+
+	for _, query := range []url.Values{
+		{"state": {"opened"}},
+		{"state": {"merged"}, "updated_after": {closedSince.UTC().Format(time.RFC3339)}},
+	} {
+		err := source.paginate(source.repoPath(repo)+"/merge_requests", query, func() interface{} {
+			return &[]gitlabMergeRequest{}
+		}, func(page interface{}) int {
+			mergeRequests := *page.(*[]gitlabMergeRequest)
+			for _, mr := range mergeRequests {
+				pulls = append(pulls, mr.pullRequest())
+			}
+
+			return len(mergeRequests)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pulls, nil
+}
+
+func (source *GitLabSource) PullRequestCommits(repo *Repository, number int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	err := source.paginate(fmt.Sprintf("%s/merge_requests/%d/commits", source.repoPath(repo), number), nil, func() interface{} {
+		return &[]gitlabCommit{}
+	}, func(page interface{}) int {
+		gitlabCommits := *page.(*[]gitlabCommit)
+		for _, commit := range gitlabCommits {
+			commits = append(commits, forgeCommit(commit.ID, commit.Message))
+		}
+
+		return len(gitlabCommits)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commits, nil
+}
+
+func (source *GitLabSource) projectPath(owner string, name string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+name)
+}
+
+func (source *GitLabSource) repoPath(repo *Repository) string {
+	return source.projectPath(*repo.Owner.Login, *repo.Name)
+}
+
+func (source *GitLabSource) issuePath(repo *Repository, number int) string {
+	return fmt.Sprintf("%s/issues/%d", source.repoPath(repo), number)
+}
+
+func (source *GitLabSource) comment(repo *Repository, number int, note gitlabNote) *github.IssueComment {
+	comment := &github.IssueComment{
+		ID:        &note.ID,
+		Body:      &note.Body,
+		User:      note.Author.user(),
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+	}
+
+	if repo.HTMLURL != nil {
+		htmlURL := fmt.Sprintf("%s/-/issues/%d#note_%d", *repo.HTMLURL, number, note.ID)
+		comment.HTMLURL = &htmlURL
+	}
+
+	return comment
+}
+
+// paginate fetches every page at the given path.
+func (source *GitLabSource) paginate(
+	path string,
+	query url.Values,
+	newPage func() interface{},
+	collect func(interface{}) int,
+) error {
+	return source.api().paginate(path, query, "per_page", gitlabPageSize, newPage, collect)
+}
+
+func (source *GitLabSource) request(method string, path string, query url.Values, body interface{}, result interface{}) error {
+	return source.api().request(method, path, query, body, result)
+}
+
+func (source *GitLabSource) api() restAPI {
+	return restAPI{
+		Name:    "gitlab",
+		BaseURL: source.URL + "/api/v4",
+		Header:  http.Header{"Private-Token": {source.Token}},
+		Client:  source.Client,
+	}
+}
+
+func (project gitlabProject) repository() *Repository {
+	private := project.Visibility != "public"
+	fork := project.ForkedFromProject != nil
+
+	return &Repository{
+		Repository: github.Repository{
+			ID:       &project.ID,
+			Name:     &project.Path,
+			FullName: &project.PathWithNamespace,
+			Owner:    &github.User{Login: &project.Namespace.FullPath},
+			Private:  &private,
+			Fork:     &fork,
+			HTMLURL:  &project.WebURL,
+		},
+		Archived: &project.Archived,
+		Topics:   project.Topics,
+	}
+}
+
+func (issue gitlabIssue) issue() *github.Issue {
+	state := "open"
+	if issue.State != "opened" {
+		state = "closed"
+	}
+
+	converted := &github.Issue{
+		ID:        &issue.ID,
+		Number:    &issue.IID,
+		Title:     &issue.Title,
+		Body:      &issue.Description,
+		State:     &state,
+		User:      issue.Author.user(),
+		HTMLURL:   &issue.WebURL,
+		CreatedAt: issue.CreatedAt,
+		UpdatedAt: issue.UpdatedAt,
+	}
+
+	for _, label := range issue.Labels {
+		name := label
+		converted.Labels = append(converted.Labels, github.Label{Name: &name})
+	}
+
+	if issue.MergeRequestsCount > 0 {
+		converted.PullRequestLinks = &github.PullRequestLinks{HTMLURL: &issue.WebURL}
+	}
+
+	return converted
+}
+
+func (user gitlabUser) user() *github.User {
+	return &github.User{
+		ID:      &user.ID,
+		Login:   &user.Username,
+		HTMLURL: &user.WebURL,
+	}
+}
+
+func (mr gitlabMergeRequest) pullRequest() *PullRequest {
+	state := "open"
+	if mr.State != "opened" {
+		state = "closed"
+	}
+
+	merged := mr.MergedAt != nil
+
+	pr := &PullRequest{
+		PullRequest: github.PullRequest{
+			Number:    &mr.IID,
+			Title:     &mr.Title,
+			Body:      &mr.Description,
+			State:     &state,
+			HTMLURL:   &mr.WebURL,
+			UpdatedAt: mr.UpdatedAt,
+			MergedAt:  mr.MergedAt,
+			Merged:    &merged,
+		},
+	}
+
+	sha := mr.MergeCommitSHA
+	if sha == "" {
+		sha = mr.SquashCommitSHA
+	}
+
+	if sha != "" {
+		pr.MergeCommitSHA = &sha
+	}
+
+	return pr
+}
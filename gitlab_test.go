@@ -0,0 +1,251 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vito/tracksuit/fakes"
+	"github.com/xoebus/go-tracker"
+)
+
+const (
+	testGitLabGroup   = "some-group/some-subgroup"
+	testGitLabProject = "some-project"
+)
+
+// gitlabFixture syncs a fake GitLab group with a fake Tracker project.
+type gitlabFixture struct {
+	GitLab  *fakes.GitLab
+	Tracker *fakes.Tracker
+
+	Source *GitLabSource
+	Syncer *Syncer
+}
+
+func newGitLabFixture(t *testing.T) *gitlabFixture {
+	gl := fakes.NewGitLab(testBotLogin)
+	t.Cleanup(gl.Close)
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	t.Cleanup(fakeTracker.Close)
+
+	gl.AddProject(testGitLabGroup, testGitLabProject)
+
+	source := NewGitLabSource(gl.URL, "some-token", nil)
+
+	return &gitlabFixture{
+		GitLab:  gl,
+		Tracker: fakeTracker,
+
+		Source: source,
+		Syncer: &Syncer{
+			Source:           source,
+			Backend:          NewTrackerBackend(fakeTracker.URL, testProjectID, "some-token", nil),
+			OrganizationName: "some-group",
+			CloseIssues:      true,
+		},
+	}
+}
+
+func (fixture *gitlabFixture) sync(t *testing.T) {
+	t.Helper()
+
+	if err := fixture.Syncer.SyncIssuesAndStories(); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+}
+
+func (fixture *gitlabFixture) path() string {
+	return testGitLabGroup + "/" + testGitLabProject
+}
+
+func (fixture *gitlabFixture) repo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo, err := fixture.Source.Repo(testGitLabGroup, testGitLabProject)
+	if err != nil {
+		t.Fatalf("failed to fetch project: %s", err)
+	}
+
+	return repo
+}
+
+func TestGitLabSyncCreatesStoriesForIssuesInSubgroups(t *testing.T) {
+	fixture := newGitLabFixture(t)
+
+	fixture.GitLab.AddIssue(fixture.path(), "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	label := issueLabel(fixture.Source.Host(), testGitLabGroup, testGitLabProject, 1)
+	if !strings.HasPrefix(label, "127.0.0.1:") {
+		t.Fatalf("expected the label to name the GitLab host, got %s", label)
+	}
+
+	stories := fixture.Tracker.StoriesWithLabel(label)
+	if len(stories) != 1 {
+		t.Fatalf("expected a story labelled %s, got %+v", label, fixture.Tracker.Stories())
+	}
+
+	if stories[0].Name != "something broke" || stories[0].Type != tracker.StoryTypeBug {
+		t.Errorf("unexpected story: %+v", stories[0])
+	}
+
+	issue := fixture.GitLab.Issue(fixture.path(), 1)
+	assertLabels(t, issue.Labels, IssueLabelBug, IssueLabelUnscheduled)
+
+	notes := fixture.GitLab.Notes(fixture.path(), 1)
+	if len(notes) != 1 || notes[0].Author.Username != testBotLogin || !strings.Contains(notes[0].Body, stories[0].URL) {
+		t.Fatalf("expected a status note linking to the story, got %+v", notes)
+	}
+
+	fixture.sync(t)
+
+	if stories := fixture.Tracker.StoriesWithLabel(label); len(stories) != 1 {
+		t.Errorf("expected the story not to be duplicated, got %+v", stories)
+	}
+
+	if notes := fixture.GitLab.Notes(fixture.path(), 1); len(notes) != 1 {
+		t.Errorf("expected the status note to be left alone, got %+v", notes)
+	}
+}
+
+func TestGitLabSyncClosesIssuesOnceAccepted(t *testing.T) {
+	fixture := newGitLabFixture(t)
+
+	fixture.GitLab.AddIssue(fixture.path(), "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.Tracker.StoriesWithLabel(issueLabel(fixture.Source.Host(), testGitLabGroup, testGitLabProject, 1))[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+
+	fixture.sync(t)
+
+	if state := fixture.GitLab.Issue(fixture.path(), 1).State; state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+}
+
+func TestGitLabCommentsLeaveOutSystemNotes(t *testing.T) {
+	fixture := newGitLabFixture(t)
+
+	fixture.GitLab.AddIssue(fixture.path(), "something broke")
+	fixture.GitLab.AddNote(fixture.path(), 1, "added ~bug label", true)
+	note := fixture.GitLab.AddNote(fixture.path(), 1, "me too", false)
+
+	comments, err := fixture.Source.Comments(fixture.repo(t), 1)
+	if err != nil {
+		t.Fatalf("failed to fetch comments: %s", err)
+	}
+
+	if len(comments) != 1 {
+		t.Fatalf("expected only the user's note, got %d comments", len(comments))
+	}
+
+	comment := comments[0]
+	if *comment.ID != note.ID || *comment.Body != "me too" || *comment.User.Login != "someone" {
+		t.Errorf("unexpected comment: %+v", comment)
+	}
+
+	if !strings.HasSuffix(*comment.HTMLURL, "/-/issues/1#note_"+strconv.Itoa(note.ID)) {
+		t.Errorf("expected the comment to link to the note, got %s", *comment.HTMLURL)
+	}
+}
+
+func TestGitLabMergeRequestsMapToPullRequests(t *testing.T) {
+	fixture := newGitLabFixture(t)
+
+	fixture.GitLab.AddMergeRequest(fixture.path(), "open", "")
+	fixture.GitLab.AddMergeRequest(fixture.path(), "merged", "")
+	fixture.GitLab.AddMergeRequest(fixture.path(), "squashed", "")
+	fixture.GitLab.AddMergeRequest(fixture.path(), "abandoned", "")
+
+	fixture.GitLab.MergeMergeRequest(fixture.path(), 2, "merge-sha", false)
+	fixture.GitLab.MergeMergeRequest(fixture.path(), 3, "squash-sha", true)
+	fixture.GitLab.CloseMergeRequest(fixture.path(), 4)
+
+	pulls, err := fixture.Source.PullRequests(fixture.repo(t), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("failed to list merge requests: %s", err)
+	}
+
+	if len(pulls) != 3 {
+		t.Fatalf("expected the open and merged merge requests, got %d", len(pulls))
+	}
+
+	open, merged, squashed := pulls[0], pulls[1], pulls[2]
+
+	if *open.Number != 1 || *open.State != "open" || *open.Merged || open.MergeCommitSHA != nil {
+		t.Errorf("unexpected open pull request: %+v", open)
+	}
+
+	if *merged.Number != 2 || *merged.State != "closed" || !*merged.Merged || *merged.MergeCommitSHA != "merge-sha" {
+		t.Errorf("unexpected merged pull request: %+v", merged)
+	}
+
+	if *squashed.Number != 3 || !*squashed.Merged || squashed.MergeCommitSHA == nil || *squashed.MergeCommitSHA != "squash-sha" {
+		t.Errorf("expected the squash commit to stand in for the merge commit, got %+v", squashed)
+	}
+}
+
+func TestGitLabSyncDeliversStoriesOfMergedMergeRequests(t *testing.T) {
+	fixture := newGitLabFixture(t)
+	fixture.Syncer.LinkPullRequests = true
+	fixture.Syncer.PullRequestLookback = time.Hour
+
+	fixture.GitLab.AddIssue(fixture.path(), "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.Tracker.StoriesWithLabel(issueLabel(fixture.Source.Host(), testGitLabGroup, testGitLabProject, 1))[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateFinished)
+
+	fixture.GitLab.AddMergeRequest(fixture.path(), "fix it", "", "Fixes #1")
+
+	time.Sleep(10 * time.Millisecond)
+	fixture.GitLab.MergeMergeRequest(fixture.path(), 1, "0123456789abcdef", true)
+
+	fixture.sync(t)
+
+	delivered := fixture.Tracker.StoriesWithLabel(issueLabel(fixture.Source.Host(), testGitLabGroup, testGitLabProject, 1))[0]
+	if delivered.State != tracker.StoryStateDelivered {
+		t.Fatalf("expected the story to be delivered, got %s", delivered.State)
+	}
+
+	comments := fixture.Tracker.Comments(story.ID)
+	if len(comments) != 1 {
+		t.Fatalf("expected a delivery comment, got %+v", comments)
+	}
+
+	expected := "in [0123456](https://gitlab.example.com/" + fixture.path() + "/commit/0123456789abcdef)"
+	if !strings.Contains(comments[0].Text, expected) {
+		t.Errorf("expected the delivery comment to link to the squash commit, got:\n%s", comments[0].Text)
+	}
+}
+
+func TestGitLabIssuesPaginates(t *testing.T) {
+	fixture := newGitLabFixture(t)
+
+	count := gitlabPageSize + gitlabPageSize/2
+	for i := 0; i < count; i++ {
+		fixture.GitLab.AddIssue(fixture.path(), "issue "+strconv.Itoa(i+1))
+	}
+
+	issues, err := fixture.Source.Issues(fixture.repo(t), time.Time{})
+	if err != nil {
+		t.Fatalf("failed to list issues: %s", err)
+	}
+
+	if len(issues) != count {
+		t.Fatalf("expected %d issues across pages, got %d", count, len(issues))
+	}
+
+	for i, issue := range issues {
+		if *issue.Number != i+1 {
+			t.Fatalf("expected issue %d to be #%d, got #%d", i, i+1, *issue.Number)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// IssueSource is a forge whose issues are synced with stories.
+//
+// Repositories, issues, and comments are described with go-github's types
+// whichever forge holds them, so other forges map their own resources onto
+// GitHub's. Issues are referred to by their number within the repository.
+type IssueSource interface {
+	// Host prefixes the labels linking stories to issues, so that issues on
+	// different forges can share a project. It is empty for GitHub, keeping
+	// its labels as they've always been.
+	Host() string
+
+	Repos(organization string, includePrivate bool) ([]*Repository, error)
+	Repo(owner string, name string) (*Repository, error)
+
+	// Issues returns the repository's open issues updated since the given
+	// time.
+	Issues(repo *Repository, since time.Time) ([]*github.Issue, error)
+	Issue(repo *Repository, number int) (*github.Issue, error)
+	CloseIssue(repo *Repository, number int) error
+
+	AddIssueLabels(repo *Repository, number int, labels []string) error
+	RemoveIssueLabel(repo *Repository, number int, label string) error
+
+	Labels(repo *Repository) ([]*github.Label, error)
+	CreateLabel(repo *Repository, name string, color string) error
+	EditLabel(repo *Repository, name string, color string) error
+
+	Comments(repo *Repository, number int) ([]*github.IssueComment, error)
+	CreateComment(repo *Repository, number int, body string) (*github.IssueComment, error)
+	EditComment(repo *Repository, number int, commentID int, body string) (*github.IssueComment, error)
+
+	// CurrentUser returns the user that comments are left as.
+	CurrentUser() (*github.User, error)
+
+	// PullRequests returns all open pull requests, along with any closed
+	// since the given time.
+	PullRequests(repo *Repository, closedSince time.Time) ([]*PullRequest, error)
+	PullRequestCommits(repo *Repository, number int) ([]*github.RepositoryCommit, error)
+}
+
+// Repository is a repository, with the fields go-github's Repository leaves
+// out.
+type Repository struct {
+	github.Repository
+
+	Archived *bool    `json:"archived,omitempty"`
+	Topics   []string `json:"topics,omitempty"`
+}
+
+// PullRequest is a pull request, with the fields go-github's PullRequest
+// leaves out.
+type PullRequest struct {
+	github.PullRequest
+
+	MergeCommitSHA *string `json:"merge_commit_sha,omitempty"`
+}
+
+// matches issue labels, with an optional forge host, e.g. "org/repo#123" or
+// "gitlab.example.com/group/project#123"
+var issueLabelPattern = regexp.MustCompile(`^(?:([^/\s]+[.:][^/\s]*)/)?([^\s#]+)/([^/#\s]+)#(\d+)$`)
+
+// issueLabel names the label linking stories to an issue.
+func issueLabel(host string, owner string, repo string, number int) string {
+	label := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	if host != "" {
+		label = host + "/" + label
+	}
+
+	return label
+}
+
+// parseIssueLabel returns the forge host, owner, repository, and number of
+// the issue the label links to. Hosts are told apart from GitHub owners, which
+// can't contain dots or colons, by containing one.
+func parseIssueLabel(label string) (string, string, string, int, bool) {
+	match := issueLabelPattern.FindStringSubmatch(label)
+	if match == nil {
+		return "", "", "", 0, false
+	}
+
+	number, err := strconv.Atoi(match[4])
+	if err != nil {
+		return "", "", "", 0, false
+	}
+
+	return match[1], match[2], match[3], number, true
+}
+
+// hostOf returns the host of the forge at the given URL, for labels.
+func hostOf(forgeURL string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(forgeURL, "https://"), "http://")
+	return strings.TrimSuffix(strings.SplitN(host, "/", 2)[0], ":443")
+}
+
+// forgeLabel describes another forge's label as GitHub would, with a color
+// that has no leading '#'.
+func forgeLabel(name string, color string) *github.Label {
+	color = strings.TrimPrefix(color, "#")
+
+	return &github.Label{
+		Name:  &name,
+		Color: &color,
+	}
+}
+
+// forgeLabelColor converts a GitHub label color for forges that want a
+// leading '#', defaulting to GitHub's gray as they require a color.
+func forgeLabelColor(color string) string {
+	if color == "" {
+		color = "ededed"
+	}
+
+	return "#" + strings.TrimPrefix(color, "#")
+}
+
+func forgeCommit(sha string, message string) *github.RepositoryCommit {
+	return &github.RepositoryCommit{
+		SHA:    &sha,
+		Commit: &github.Commit{Message: &message},
+	}
+}
+
+// isGone returns whether the error is a forge responding that the issue or
+// repository isn't there, as opposed to failing to respond.
+func isGone(err error) bool {
+	status := responseStatus(err)
+	return status == http.StatusNotFound || status == http.StatusGone
+}
+
+// responseStatus returns the status of the response the error came from, or
+// 0 if it didn't come from one.
+func responseStatus(err error) int {
+	switch err := err.(type) {
+	case *github.ErrorResponse:
+		if err.Response != nil {
+			return err.Response.StatusCode
+		}
+	case *StatusError:
+		return err.StatusCode
+	}
+
+	return 0
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// jiraTimeLayout is how Jira formats timestamps.
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+const jiraPageSize = 100
+
+const jiraSearchFields = "summary,description,issuetype,status,labels,assignee,created,updated,resolutiondate"
+
+// jiraIssueTypes are the Jira issue types that stories of each type are
+// created as.
+var jiraIssueTypes = map[tracker.StoryType]string{
+	tracker.StoryTypeFeature: "Story",
+	tracker.StoryTypeBug:     "Bug",
+	tracker.StoryTypeChore:   "Task",
+	tracker.StoryTypeRelease: "Task",
+}
+
+// jiraStoryTypes are the story types of Jira issue types. Other issue types
+// are treated as features.
+var jiraStoryTypes = map[string]tracker.StoryType{
+	"story":    tracker.StoryTypeFeature,
+	"bug":      tracker.StoryTypeBug,
+	"task":     tracker.StoryTypeChore,
+	"sub-task": tracker.StoryTypeChore,
+	"subtask":  tracker.StoryTypeChore,
+}
+
+// jiraStoryStates are the story states of Jira status categories.
+var jiraStoryStates = map[string]tracker.StoryState{
+	"new":           tracker.StoryStateUnscheduled,
+	"indeterminate": tracker.StoryStateStarted,
+	"done":          tracker.StoryStateAccepted,
+}
+
+// JiraBackend syncs issues with the issues of a Jira project, using the REST
+// API shared by Jira Cloud and Jira Server.
+//
+// Jira users have no numeric IDs, so people are numbered as they're seen on
+// issues and comments for Members to name them.
+type JiraBackend struct {
+	URL        string
+	ProjectKey string
+
+	// User and Token authenticate with basic auth, as with Jira Cloud API
+	// tokens. Without a User, Token is sent as a bearer token, as with Jira
+	// Server personal access tokens.
+	User  string
+	Token string
+
+	// Server uses the search API of Jira Server and Data Center, which Jira
+	// Cloud no longer offers.
+	Server bool
+
+	Client *http.Client
+
+	people     map[string]tracker.Person
+	peopleLock sync.Mutex
+}
+
+type jiraIssue struct {
+	ID     string          `json:"id"`
+	Key    string          `json:"key"`
+	Fields jiraIssueFields `json:"fields"`
+}
+
+type jiraIssueFields struct {
+	Summary     string     `json:"summary"`
+	Description string     `json:"description"`
+	IssueType   jiraName   `json:"issuetype"`
+	Status      jiraStatus `json:"status"`
+	Labels      []string   `json:"labels"`
+	Assignee    *jiraUser  `json:"assignee"`
+
+	Created        string `json:"created"`
+	Updated        string `json:"updated"`
+	ResolutionDate string `json:"resolutiondate"`
+}
+
+type jiraName struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type jiraStatus struct {
+	Name           string `json:"name"`
+	StatusCategory struct {
+		Key string `json:"key"`
+	} `json:"statusCategory"`
+}
+
+type jiraUser struct {
+	AccountID    string `json:"accountId"`
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+type jiraComment struct {
+	ID      string    `json:"id"`
+	Body    string    `json:"body"`
+	Author  *jiraUser `json:"author"`
+	Created string    `json:"created"`
+}
+
+type jiraTransition struct {
+	ID string `json:"id"`
+	To struct {
+		StatusCategory struct {
+			Key string `json:"key"`
+		} `json:"statusCategory"`
+	} `json:"to"`
+}
+
+func NewJiraBackend(jiraURL string, projectKey string, user string, token string, client *http.Client) *JiraBackend {
+	return &JiraBackend{
+		URL:        strings.TrimSuffix(jiraURL, "/"),
+		ProjectKey: projectKey,
+		User:       user,
+		Token:      token,
+		Client:     client,
+	}
+}
+
+func (backend *JiraBackend) Project() string {
+	return backend.ProjectKey
+}
+
+func (backend *JiraBackend) ProjectURL() string {
+	return backend.URL + "/browse/" + url.PathEscape(backend.ProjectKey)
+}
+
+func (backend *JiraBackend) Tool() string {
+	return "Jira"
+}
+
+func (backend *JiraBackend) AllStories() (StorySet, error) {
+	return backend.search("")
+}
+
+func (backend *JiraBackend) StoriesWithLabel(label string) (StorySet, error) {
+	return backend.search(fmt.Sprintf("labels = %s", jqlString(label)))
+}
+
+func (backend *JiraBackend) StoriesByID(ids []int) (StorySet, error) {
+	var stories StorySet
+
+	for start := 0; start < len(ids); start += storyIDBatchSize {
+		end := start + storyIDBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var idList []string
+		for _, id := range ids[start:end] {
+			idList = append(idList, strconv.Itoa(id))
+		}
+
+		batch, err := backend.search("id in (" + strings.Join(idList, ",") + ")")
+		if err != nil {
+			return nil, err
+		}
+
+		stories = append(stories, batch...)
+	}
+
+	return stories, nil
+}
+
+// LatestVersion returns the current time in Unix seconds, as Jira has no
+// notion of a project version.
+func (backend *JiraBackend) LatestVersion() (int, error) {
+	return int(time.Now().Unix()), nil
+}
+
+// ChangedSince searches for stories updated since the version's time.
+// Relative dates are used since JQL interprets absolute ones in the user's
+// time zone; the extra minute makes up for their resolution.
+func (backend *JiraBackend) ChangedSince(version int) ([]int, int, error) {
+	latestVersion := int(time.Now().Unix())
+
+	minutes := int(time.Since(time.Unix(int64(version), 0))/time.Minute) + 1
+
+	stories, err := backend.search(fmt.Sprintf(`updated >= "-%dm"`, minutes))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ids []int
+	for _, story := range stories {
+		ids = append(ids, story.ID)
+	}
+
+	return ids, latestVersion, nil
+}
+
+func (backend *JiraBackend) CreateStory(story Story) (Story, error) {
+	var labels []string
+	for _, label := range story.Labels {
+		labels = append(labels, label.Name)
+	}
+
+	fields := map[string]interface{}{
+		"project":   map[string]string{"key": backend.ProjectKey},
+		"summary":   story.Name,
+		"issuetype": jiraName{Name: jiraIssueTypes[story.Type]},
+		"labels":    labels,
+	}
+
+	if story.Description != "" {
+		fields["description"] = story.Description
+	}
+
+	var created jiraIssue
+	err := backend.request("POST", "/rest/api/2/issue", nil, map[string]interface{}{"fields": fields}, &created)
+	if err != nil {
+		return Story{}, err
+	}
+
+	id, err := strconv.Atoi(created.ID)
+	if err != nil {
+		return Story{}, fmt.Errorf("invalid issue id '%s': %s", created.ID, err)
+	}
+
+	return backend.story(id)
+}
+
+func (backend *JiraBackend) DeleteStory(id int) error {
+	return backend.request("DELETE", backend.issuePath(id), nil, nil, nil)
+}
+
+func (backend *JiraBackend) SetStoryType(id int, storyType tracker.StoryType) (Story, error) {
+	return backend.editIssue(id, map[string]interface{}{
+		"fields": map[string]interface{}{
+			"issuetype": jiraName{Name: jiraIssueTypes[storyType]},
+		},
+	})
+}
+
+func (backend *JiraBackend) SetStoryName(id int, name string) (Story, error) {
+	return backend.editIssue(id, map[string]interface{}{
+		"fields": map[string]interface{}{
+			"summary": name,
+		},
+	})
+}
+
+// UnscheduleStory moves the issue back to a status in the "To Do" category.
+func (backend *JiraBackend) UnscheduleStory(id int) (Story, error) {
+	return backend.transition(id, "new")
+}
+
+// SetStoryState moves the issue to a status in the category closest to the
+// state: "To Do" for unstarted stories, "Done" for accepted ones, and "In
+// Progress" for everything in between.
+func (backend *JiraBackend) SetStoryState(id int, state tracker.StoryState) (Story, error) {
+	switch state {
+	case tracker.StoryStateUnscheduled, StoryStateUnstarted, tracker.StoryStatePlanned:
+		return backend.transition(id, "new")
+	case tracker.StoryStateAccepted:
+		return backend.transition(id, "done")
+	default:
+		return backend.transition(id, "indeterminate")
+	}
+}
+
+// transition moves the issue to the first status in the given category that
+// its workflow allows.
+func (backend *JiraBackend) transition(id int, category string) (Story, error) {
+	var transitions struct {
+		Transitions []jiraTransition `json:"transitions"`
+	}
+
+	err := backend.request("GET", backend.issuePath(id)+"/transitions", nil, nil, &transitions)
+	if err != nil {
+		return Story{}, err
+	}
+
+	for _, transition := range transitions.Transitions {
+		if transition.To.StatusCategory.Key != category {
+			continue
+		}
+
+		err := backend.request("POST", backend.issuePath(id)+"/transitions", nil, map[string]interface{}{
+			"transition": map[string]string{"id": transition.ID},
+		}, nil)
+		if err != nil {
+			return Story{}, err
+		}
+
+		return backend.story(id)
+	}
+
+	return Story{}, fmt.Errorf("no transition to a status in category '%s' for issue %d", category, id)
+}
+
+// DeliverStoryWithComment only leaves the comment, as Jira workflows have no
+// common status for work awaiting acceptance.
+func (backend *JiraBackend) DeliverStoryWithComment(id int, comment string) (Story, error) {
+	if _, err := backend.CreateStoryComment(id, comment); err != nil {
+		return Story{}, err
+	}
+
+	return backend.story(id)
+}
+
+func (backend *JiraBackend) AddStoryLabel(id int, label string) error {
+	_, err := backend.editIssue(id, map[string]interface{}{
+		"update": map[string]interface{}{
+			"labels": []map[string]string{{"add": label}},
+		},
+	})
+	return err
+}
+
+func (backend *JiraBackend) RemoveStoryLabel(id int, label tracker.Label) error {
+	_, err := backend.editIssue(id, map[string]interface{}{
+		"update": map[string]interface{}{
+			"labels": []map[string]string{{"remove": label.Name}},
+		},
+	})
+	return err
+}
+
+func (backend *JiraBackend) StoryComments(id int) ([]StoryComment, error) {
+	var comments []StoryComment
+
+	for {
+		var page struct {
+			Total    int           `json:"total"`
+			Comments []jiraComment `json:"comments"`
+		}
+
+		query := url.Values{
+			"startAt":    {strconv.Itoa(len(comments))},
+			"maxResults": {strconv.Itoa(jiraPageSize)},
+		}
+
+		err := backend.request("GET", backend.issuePath(id)+"/comment", query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, comment := range page.Comments {
+			converted, err := backend.comment(id, comment)
+			if err != nil {
+				return nil, err
+			}
+
+			comments = append(comments, converted)
+		}
+
+		if len(page.Comments) == 0 || len(comments) >= page.Total {
+			break
+		}
+	}
+
+	return comments, nil
+}
+
+func (backend *JiraBackend) CreateStoryComment(id int, text string) (StoryComment, error) {
+	var created jiraComment
+	err := backend.request("POST", backend.issuePath(id)+"/comment", nil, map[string]string{"body": text}, &created)
+	if err != nil {
+		return StoryComment{}, err
+	}
+
+	return backend.comment(id, created)
+}
+
+// Members returns the people seen so far.
+func (backend *JiraBackend) Members() ([]tracker.Person, error) {
+	backend.peopleLock.Lock()
+	defer backend.peopleLock.Unlock()
+
+	var people []tracker.Person
+	for _, person := range backend.people {
+		people = append(people, person)
+	}
+
+	return people, nil
+}
+
+func (backend *JiraBackend) search(jql string) (StorySet, error) {
+	projectJQL := "project = " + jqlString(backend.ProjectKey)
+	if jql != "" {
+		projectJQL += " AND " + jql
+	}
+
+	query := url.Values{
+		"jql":        {projectJQL + " ORDER BY id"},
+		"fields":     {jiraSearchFields},
+		"maxResults": {strconv.Itoa(jiraPageSize)},
+	}
+
+	var stories StorySet
+
+	for {
+		var page struct {
+			Total         int         `json:"total"`
+			Issues        []jiraIssue `json:"issues"`
+			NextPageToken string      `json:"nextPageToken"`
+			IsLast        bool        `json:"isLast"`
+		}
+
+		path := "/rest/api/2/search/jql"
+		if backend.Server {
+			path = "/rest/api/2/search"
+			query.Set("startAt", strconv.Itoa(len(stories)))
+		}
+
+		if err := backend.request("GET", path, query, nil, &page); err != nil {
+			return nil, err
+		}
+
+		for _, issue := range page.Issues {
+			story, err := backend.toStory(issue)
+			if err != nil {
+				return nil, err
+			}
+
+			stories = append(stories, story)
+		}
+
+		if len(page.Issues) == 0 {
+			break
+		}
+
+		if backend.Server {
+			if len(stories) >= page.Total {
+				break
+			}
+		} else {
+			if page.IsLast || page.NextPageToken == "" {
+				break
+			}
+
+			query.Set("nextPageToken", page.NextPageToken)
+		}
+	}
+
+	return stories, nil
+}
+
+func (backend *JiraBackend) story(id int) (Story, error) {
+	var issue jiraIssue
+	err := backend.request("GET", backend.issuePath(id), url.Values{"fields": {jiraSearchFields}}, nil, &issue)
+	if err != nil {
+		return Story{}, err
+	}
+
+	return backend.toStory(issue)
+}
+
+func (backend *JiraBackend) editIssue(id int, edit interface{}) (Story, error) {
+	if err := backend.request("PUT", backend.issuePath(id), nil, edit, nil); err != nil {
+		return Story{}, err
+	}
+
+	return backend.story(id)
+}
+
+func (backend *JiraBackend) issuePath(id int) string {
+	return fmt.Sprintf("/rest/api/2/issue/%d", id)
+}
+
+func (backend *JiraBackend) toStory(issue jiraIssue) (Story, error) {
+	id, err := strconv.Atoi(issue.ID)
+	if err != nil {
+		return Story{}, fmt.Errorf("invalid issue id '%s': %s", issue.ID, err)
+	}
+
+	storyType, found := jiraStoryTypes[strings.ToLower(issue.Fields.IssueType.Name)]
+	if !found {
+		storyType = tracker.StoryTypeFeature
+	}
+
+	state, found := jiraStoryStates[issue.Fields.Status.StatusCategory.Key]
+	if !found {
+		state = tracker.StoryStateUnscheduled
+	}
+
+	story := Story{
+		Story: tracker.Story{
+			ID:          id,
+			URL:         backend.URL + "/browse/" + issue.Key,
+			Name:        issue.Fields.Summary,
+			Description: issue.Fields.Description,
+			Type:        storyType,
+			State:       state,
+			CreatedAt:   parseJiraTime(issue.Fields.Created),
+			UpdatedAt:   parseJiraTime(issue.Fields.Updated),
+		},
+	}
+
+	for _, label := range issue.Fields.Labels {
+		story.Labels = append(story.Labels, tracker.Label{Name: label})
+	}
+
+	if issue.Fields.Assignee != nil {
+		story.OwnerIDs = []int{backend.person(*issue.Fields.Assignee).ID}
+	}
+
+	if state == tracker.StoryStateAccepted {
+		story.AcceptedAt = parseJiraTime(issue.Fields.ResolutionDate)
+		if story.AcceptedAt == nil {
+			story.AcceptedAt = story.UpdatedAt
+		}
+	}
+
+	return story, nil
+}
+
+func (backend *JiraBackend) comment(storyID int, comment jiraComment) (StoryComment, error) {
+	id, err := strconv.Atoi(comment.ID)
+	if err != nil {
+		return StoryComment{}, fmt.Errorf("invalid comment id '%s': %s", comment.ID, err)
+	}
+
+	converted := StoryComment{
+		ID:        id,
+		StoryID:   storyID,
+		Text:      comment.Body,
+		CreatedAt: parseJiraTime(comment.Created),
+	}
+
+	if comment.Author != nil {
+		converted.PersonID = backend.person(*comment.Author).ID
+	}
+
+	return converted, nil
+}
+
+// person numbers the user the first time they're seen.
+func (backend *JiraBackend) person(user jiraUser) tracker.Person {
+	key := user.AccountID
+	if key == "" {
+		key = user.Key
+	}
+
+	if key == "" {
+		key = user.Name
+	}
+
+	backend.peopleLock.Lock()
+	defer backend.peopleLock.Unlock()
+
+	if backend.people == nil {
+		backend.people = map[string]tracker.Person{}
+	}
+
+	person, found := backend.people[key]
+	if !found {
+		person = tracker.Person{
+			ID:       len(backend.people) + 1,
+			Name:     user.DisplayName,
+			Username: user.Name,
+			Email:    user.EmailAddress,
+		}
+
+		backend.people[key] = person
+	}
+
+	return person
+}
+
+func (backend *JiraBackend) request(method string, path string, query url.Values, body interface{}, result interface{}) error {
+	return backend.api().request(method, path, query, body, result)
+}
+
+// api authenticates with basic auth given a User, and otherwise with Token as
+// a bearer token.
+func (backend *JiraBackend) api() restAPI {
+	authorization := "Bearer " + backend.Token
+	if backend.User != "" {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(backend.User+":"+backend.Token))
+	}
+
+	return restAPI{
+		Name:    "jira",
+		BaseURL: backend.URL,
+		Header:  http.Header{"Authorization": {authorization}},
+		Client:  backend.Client,
+	}
+}
+
+func parseJiraTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := time.Parse(jiraTimeLayout, value)
+	if err != nil {
+		return nil
+	}
+
+	return &parsed
+}
+
+// jqlString quotes a value for use in a JQL query.
+func jqlString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
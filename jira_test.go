@@ -0,0 +1,298 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vito/tracksuit/fakes"
+	"github.com/xoebus/go-tracker"
+)
+
+const testJiraProject = "ENG"
+
+// jiraFixture syncs a fake GitHub organization with a fake Jira project.
+type jiraFixture struct {
+	GitHub *fakes.GitHub
+	Jira   *fakes.Jira
+
+	Backend *JiraBackend
+	Syncer  *Syncer
+}
+
+func newJiraFixture(t *testing.T) *jiraFixture {
+	gh := fakes.NewGitHub(testBotLogin)
+	t.Cleanup(gh.Close)
+
+	jira := fakes.NewJira(testJiraProject)
+	t.Cleanup(jira.Close)
+
+	gh.AddRepo(testOrganization, testRepo)
+
+	backend := NewJiraBackend(jira.URL, testJiraProject, "someone@example.com", "some-token", nil)
+
+	return &jiraFixture{
+		GitHub: gh,
+		Jira:   jira,
+
+		Backend: backend,
+		Syncer: &Syncer{
+			Source:           &GitHubSource{Client: gh.Client()},
+			Backend:          backend,
+			OrganizationName: testOrganization,
+			CloseIssues:      true,
+		},
+	}
+}
+
+func (fixture *jiraFixture) sync(t *testing.T) {
+	t.Helper()
+
+	if err := fixture.Syncer.SyncIssuesAndStories(); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+}
+
+// issues returns the Jira issues for the GitHub issue, failing unless there
+// are as many as expected.
+func (fixture *jiraFixture) issues(t *testing.T, number int, expected int) []fakes.JiraIssue {
+	t.Helper()
+
+	label := issueLabel("", testOrganization, testRepo, number)
+
+	var issues []fakes.JiraIssue
+	for _, issue := range fixture.Jira.Issues() {
+		for _, name := range issue.Labels {
+			if name == label {
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	if len(issues) != expected {
+		t.Fatalf("expected %d Jira issues for #%d, got %d: %+v", expected, number, len(issues), issues)
+	}
+
+	return issues
+}
+
+func storyIDs(stories StorySet) []int {
+	var ids []int
+	for _, story := range stories {
+		ids = append(ids, story.ID)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func TestJiraSyncCreatesIssuesForNewIssues(t *testing.T) {
+	fixture := newJiraFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+	if issue.Summary != "something broke" || issue.IssueType != "Bug" || issue.StatusCategory != "new" {
+		t.Errorf("unexpected Jira issue: %+v", issue)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelUnscheduled)
+
+	var comment string
+	for _, c := range fixture.GitHub.Comments(testOrganization, testRepo, 1) {
+		if *c.User.Login == testBotLogin {
+			comment = *c.Body
+		}
+	}
+
+	if !strings.Contains(comment, "We use Jira") || !strings.Contains(comment, "/browse/"+issue.Key) {
+		t.Errorf("expected the status comment to link to the Jira issue:\n%s", comment)
+	}
+
+	fixture.sync(t)
+
+	fixture.issues(t, 1, 1)
+}
+
+func TestJiraSyncReflectsStatusCategoriesOnIssueLabels(t *testing.T) {
+	fixture := newJiraFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+
+	fixture.Jira.SetIssueStatus(issue.ID, "indeterminate")
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelInFlight)
+
+	fixture.Jira.SetIssueStatus(issue.ID, "new")
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelUnscheduled)
+}
+
+func TestJiraSyncClosesIssuesOnceDone(t *testing.T) {
+	fixture := newJiraFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+	fixture.Jira.SetIssueStatus(issue.ID, "done")
+
+	fixture.sync(t)
+
+	if state := *fixture.GitHub.Issue(testOrganization, testRepo, 1).State; state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+}
+
+func TestJiraSearchPaginates(t *testing.T) {
+	for _, server := range []bool{false, true} {
+		fixture := newJiraFixture(t)
+		fixture.Jira.PageSize = 2
+		fixture.Backend.Server = server
+
+		var expected []int
+		for i := 0; i < 5; i++ {
+			issue := fixture.Jira.AddIssue("issue "+strconv.Itoa(i), "Task", "some-label")
+			id, _ := strconv.Atoi(issue.ID)
+			expected = append(expected, id)
+		}
+
+		fixture.Jira.AddIssue("unlabelled issue", "Task")
+
+		stories, err := fixture.Backend.StoriesWithLabel("some-label")
+		if err != nil {
+			t.Fatalf("search failed (server: %t): %s", server, err)
+		}
+
+		if ids := storyIDs(stories); !intsEqual(ids, expected) {
+			t.Errorf("expected stories %v (server: %t), got %v", expected, server, ids)
+		}
+
+		byID, err := fixture.Backend.StoriesByID(expected[1:3])
+		if err != nil {
+			t.Fatalf("search by ID failed (server: %t): %s", server, err)
+		}
+
+		if ids := storyIDs(byID); !intsEqual(ids, expected[1:3]) {
+			t.Errorf("expected stories %v by ID (server: %t), got %v", expected[1:3], server, ids)
+		}
+	}
+}
+
+func TestJiraCreateStoryMapsTypesAndLabels(t *testing.T) {
+	fixture := newJiraFixture(t)
+
+	created, err := fixture.Backend.CreateStory(Story{Story: tracker.Story{
+		Name:        "do a thing",
+		Description: "in detail",
+		Type:        tracker.StoryTypeChore,
+		Labels:      []tracker.Label{{Name: "some-label"}},
+	}})
+	if err != nil {
+		t.Fatalf("failed to create story: %s", err)
+	}
+
+	issues := fixture.Jira.Issues()
+	if len(issues) != 1 {
+		t.Fatalf("expected one Jira issue, got %+v", issues)
+	}
+
+	issue := issues[0]
+	if issue.IssueType != "Task" || issue.Description != "in detail" || len(issue.Labels) != 1 || issue.Labels[0] != "some-label" {
+		t.Errorf("unexpected Jira issue: %+v", issue)
+	}
+
+	if strconv.Itoa(created.ID) != issue.ID || created.Type != tracker.StoryTypeChore || created.State != tracker.StoryStateUnscheduled {
+		t.Errorf("unexpected story: %+v", created)
+	}
+
+	if created.URL != fixture.Jira.URL+"/browse/"+issue.Key {
+		t.Errorf("expected the story to link to the issue, got %s", created.URL)
+	}
+}
+
+func TestJiraSetStoryStateTransitionsToTheStateCategory(t *testing.T) {
+	fixture := newJiraFixture(t)
+
+	issue := fixture.Jira.AddIssue("something broke", "Bug")
+	id, _ := strconv.Atoi(issue.ID)
+
+	for _, example := range []struct {
+		state    tracker.StoryState
+		category string
+	}{
+		{tracker.StoryStateStarted, "indeterminate"},
+		{tracker.StoryStateAccepted, "done"},
+		{StoryStateUnstarted, "new"},
+		{tracker.StoryStateFinished, "indeterminate"},
+	} {
+		story, err := fixture.Backend.SetStoryState(id, example.state)
+		if err != nil {
+			t.Fatalf("failed to set state %s: %s", example.state, err)
+		}
+
+		if category := fixture.Jira.Issues()[0].StatusCategory; category != example.category {
+			t.Errorf("expected state %s to move the issue to %s, got %s", example.state, example.category, category)
+		}
+
+		if example.state == tracker.StoryStateAccepted && story.AcceptedAt == nil {
+			t.Errorf("expected an accepted story to have been accepted at its resolution date")
+		}
+	}
+
+	// already done; there's no transition to the same category
+	fixture.Jira.SetIssueStatus(issue.ID, "done")
+
+	if _, err := fixture.Backend.SetStoryState(id, tracker.StoryStateAccepted); err == nil {
+		t.Error("expected an error without a transition to the category")
+	}
+}
+
+func TestJiraChangedSinceFindsRecentlyUpdatedIssues(t *testing.T) {
+	fixture := newJiraFixture(t)
+
+	stale := fixture.Jira.AddIssue("stale", "Task")
+	fresh := fixture.Jira.AddIssue("fresh", "Task")
+
+	fixture.Jira.SetIssueUpdated(stale.ID, time.Now().Add(-2*time.Hour))
+
+	version := int(time.Now().Add(-10 * time.Minute).Unix())
+
+	ids, latestVersion, err := fixture.Backend.ChangedSince(version)
+	if err != nil {
+		t.Fatalf("failed to find changes: %s", err)
+	}
+
+	freshID, _ := strconv.Atoi(fresh.ID)
+	if !intsEqual(ids, []int{freshID}) {
+		t.Errorf("expected only %d to have changed, got %v", freshID, ids)
+	}
+
+	if latestVersion <= version {
+		t.Errorf("expected the latest version to be after %d, got %d", version, latestVersion)
+	}
+}
+
+func intsEqual(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,19 +1,18 @@
 package main
 
-import (
-	"log"
+type LabelGCer struct {
+	Labels ProjectLabels
 
-	tracker "github.com/xoebus/go-tracker"
-)
+	// Plan, if set, causes deletions to be recorded rather than performed.
+	Plan *Plan
 
-type LabelGCer struct {
-	ProjectClient tracker.ProjectClient
+	Logger *Logger
 }
 
 func (gcer LabelGCer) GC() {
-	labels, err := gcer.ProjectClient.Labels()
+	labels, err := gcer.Labels.Labels()
 	if err != nil {
-		log.Println("failed to fetch errors:", err)
+		gcer.Logger.Error("failed to fetch labels", err)
 		return
 	}
 
@@ -22,11 +21,16 @@ func (gcer LabelGCer) GC() {
 			continue
 		}
 
-		log.Println("deleting label:", label.Name)
+		gcer.Logger.Info("deleting label", "label", label.Name)
+
+		if gcer.Plan != nil {
+			gcer.Plan.Record(ActionDeleteTrackerLabel, label.Name, "")
+			continue
+		}
 
-		err := gcer.ProjectClient.DeleteLabel(label.ID)
+		err := gcer.Labels.DeleteLabel(label)
 		if err != nil {
-			log.Println("failed to delete:", err)
+			gcer.Logger.Error("failed to delete label", err, "label", label.Name)
 		}
 	}
 }
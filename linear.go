@@ -0,0 +1,840 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// LinearDefaultURL is the endpoint of Linear's GraphQL API.
+const LinearDefaultURL = "https://api.linear.app/graphql"
+
+const linearPageSize = 100
+
+const linearIssueFields = `
+	id
+	number
+	identifier
+	url
+	title
+	description
+	createdAt
+	updatedAt
+	completedAt
+	state { type }
+	assignee { id name displayName email }
+	labels { nodes { id name } }
+`
+
+const linearCommentFields = `
+	id
+	body
+	createdAt
+	user { id name displayName email }
+`
+
+// linearTypeLabels are the Linear labels standing in for story types, as
+// Linear issues have no type of their own. Issues without any of them are
+// features.
+var linearTypeLabels = map[tracker.StoryType]string{
+	tracker.StoryTypeFeature: "Feature",
+	tracker.StoryTypeBug:     "Bug",
+	tracker.StoryTypeChore:   "Chore",
+	tracker.StoryTypeRelease: "Chore",
+}
+
+// linearStoryStates are the story states of Linear workflow state types.
+// Canceled issues are unscheduled rather than accepted, as their work was
+// dropped rather than done; the GitHub issue is left open for someone to
+// decide on.
+var linearStoryStates = map[string]tracker.StoryState{
+	"triage":    tracker.StoryStateUnscheduled,
+	"backlog":   tracker.StoryStateUnscheduled,
+	"unstarted": StoryStateUnstarted,
+	"started":   tracker.StoryStateStarted,
+	"completed": tracker.StoryStateAccepted,
+	"canceled":  tracker.StoryStateUnscheduled,
+}
+
+// LinearBackend syncs issues with the issues of a Linear team.
+//
+// Stories are numbered by their issue number within the team. Linear's other
+// IDs are UUIDs, so comments are numbered by a hash of theirs and people are
+// numbered as they're seen on issues and comments for Members to name them.
+type LinearBackend struct {
+	URL     string
+	TeamKey string
+
+	// Token is a personal API key, or an OAuth access token prefixed with
+	// "Bearer ".
+	Token string
+
+	Client *http.Client
+
+	team     *linearTeam
+	labelIDs map[string]string
+	lock     sync.Mutex
+
+	people     map[string]tracker.Person
+	peopleLock sync.Mutex
+}
+
+type linearTeam struct {
+	ID           string `json:"id"`
+	Key          string `json:"key"`
+	Organization struct {
+		URLKey string `json:"urlKey"`
+	} `json:"organization"`
+}
+
+type linearIssue struct {
+	ID          string     `json:"id"`
+	Number      int        `json:"number"`
+	Identifier  string     `json:"identifier"`
+	URL         string     `json:"url"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	CreatedAt   *time.Time `json:"createdAt"`
+	UpdatedAt   *time.Time `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+
+	State struct {
+		Type string `json:"type"`
+	} `json:"state"`
+
+	Assignee *linearUser `json:"assignee"`
+
+	Labels struct {
+		Nodes []linearLabel `json:"nodes"`
+	} `json:"labels"`
+}
+
+type linearLabel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type linearUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+}
+
+type linearComment struct {
+	ID        string      `json:"id"`
+	Body      string      `json:"body"`
+	CreatedAt *time.Time  `json:"createdAt"`
+	User      *linearUser `json:"user"`
+}
+
+type linearPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type linearIssuePayload struct {
+	Success bool        `json:"success"`
+	Issue   linearIssue `json:"issue"`
+}
+
+func NewLinearBackend(linearURL string, teamKey string, token string, client *http.Client) *LinearBackend {
+	return &LinearBackend{
+		URL:     linearURL,
+		TeamKey: teamKey,
+		Token:   token,
+		Client:  client,
+	}
+}
+
+func (backend *LinearBackend) Project() string {
+	return backend.TeamKey
+}
+
+func (backend *LinearBackend) ProjectURL() string {
+	team, err := backend.fetchTeam()
+	if err != nil {
+		return "https://linear.app"
+	}
+
+	return fmt.Sprintf("https://linear.app/%s/team/%s", team.Organization.URLKey, team.Key)
+}
+
+func (backend *LinearBackend) Tool() string {
+	return "Linear"
+}
+
+func (backend *LinearBackend) AllStories() (StorySet, error) {
+	return backend.search(nil)
+}
+
+func (backend *LinearBackend) StoriesWithLabel(label string) (StorySet, error) {
+	return backend.search(map[string]interface{}{
+		"labels": map[string]interface{}{
+			"some": map[string]interface{}{
+				"name": map[string]string{"eq": label},
+			},
+		},
+	})
+}
+
+func (backend *LinearBackend) StoriesByID(ids []int) (StorySet, error) {
+	var stories StorySet
+
+	for start := 0; start < len(ids); start += storyIDBatchSize {
+		end := start + storyIDBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		batch, err := backend.search(map[string]interface{}{
+			"number": map[string]interface{}{"in": ids[start:end]},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		stories = append(stories, batch...)
+	}
+
+	return stories, nil
+}
+
+// LatestVersion returns the current time in Unix seconds, as Linear has no
+// notion of a project version.
+func (backend *LinearBackend) LatestVersion() (int, error) {
+	return int(time.Now().Unix()), nil
+}
+
+// ChangedSince searches for stories updated since the version's time.
+func (backend *LinearBackend) ChangedSince(version int) ([]int, int, error) {
+	latestVersion := int(time.Now().Unix())
+
+	stories, err := backend.search(map[string]interface{}{
+		"updatedAt": map[string]string{
+			"gte": time.Unix(int64(version), 0).UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ids []int
+	for _, story := range stories {
+		ids = append(ids, story.ID)
+	}
+
+	return ids, latestVersion, nil
+}
+
+func (backend *LinearBackend) CreateStory(story Story) (Story, error) {
+	team, err := backend.fetchTeam()
+	if err != nil {
+		return Story{}, err
+	}
+
+	labelNames := []string{linearTypeLabels[story.Type]}
+	for _, label := range story.Labels {
+		labelNames = append(labelNames, label.Name)
+	}
+
+	var labelIDs []string
+	for _, name := range labelNames {
+		id, err := backend.labelID(name)
+		if err != nil {
+			return Story{}, err
+		}
+
+		labelIDs = append(labelIDs, id)
+	}
+
+	var result struct {
+		IssueCreate linearIssuePayload `json:"issueCreate"`
+	}
+
+	err = backend.query("IssueCreate", `mutation IssueCreate($input: IssueCreateInput!) {
+		issueCreate(input: $input) { success issue { `+linearIssueFields+` } }
+	}`, map[string]interface{}{
+		"input": map[string]interface{}{
+			"teamId":      team.ID,
+			"title":       story.Name,
+			"description": story.Description,
+			"labelIds":    labelIDs,
+		},
+	}, &result)
+	if err != nil {
+		return Story{}, err
+	}
+
+	return backend.toStory(result.IssueCreate.Issue), nil
+}
+
+func (backend *LinearBackend) DeleteStory(id int) error {
+	var result struct {
+		IssueDelete struct {
+			Success bool `json:"success"`
+		} `json:"issueDelete"`
+	}
+
+	return backend.query("IssueDelete", `mutation IssueDelete($id: String!) {
+		issueDelete(id: $id) { success }
+	}`, map[string]interface{}{"id": backend.identifier(id)}, &result)
+}
+
+// SetStoryType swaps the issue's type label for the one of the given type.
+func (backend *LinearBackend) SetStoryType(id int, storyType tracker.StoryType) (Story, error) {
+	issue, err := backend.fetchIssue(id)
+	if err != nil {
+		return Story{}, err
+	}
+
+	want := linearTypeLabels[storyType]
+
+	var labelIDs []string
+	for _, label := range issue.Labels.Nodes {
+		if _, isType := linearStoryType(label.Name); isType && label.Name != want {
+			continue
+		}
+
+		labelIDs = append(labelIDs, label.ID)
+	}
+
+	typeLabelID, err := backend.labelID(want)
+	if err != nil {
+		return Story{}, err
+	}
+
+	labelIDs = append(labelIDs, typeLabelID)
+
+	return backend.updateIssue(id, map[string]interface{}{"labelIds": labelIDs})
+}
+
+func (backend *LinearBackend) SetStoryName(id int, name string) (Story, error) {
+	return backend.updateIssue(id, map[string]interface{}{"title": name})
+}
+
+// UnscheduleStory moves the issue back to the team's backlog.
+func (backend *LinearBackend) UnscheduleStory(id int) (Story, error) {
+	return backend.moveToStateType(id, "backlog")
+}
+
+// SetStoryState moves the issue to the team's first workflow state of the
+// type closest to the state.
+func (backend *LinearBackend) SetStoryState(id int, state tracker.StoryState) (Story, error) {
+	switch state {
+	case tracker.StoryStateUnscheduled:
+		return backend.moveToStateType(id, "backlog")
+	case StoryStateUnstarted, tracker.StoryStatePlanned:
+		return backend.moveToStateType(id, "unstarted")
+	case tracker.StoryStateAccepted:
+		return backend.moveToStateType(id, "completed")
+	default:
+		return backend.moveToStateType(id, "started")
+	}
+}
+
+func (backend *LinearBackend) moveToStateType(id int, stateType string) (Story, error) {
+	team, err := backend.fetchTeam()
+	if err != nil {
+		return Story{}, err
+	}
+
+	var result struct {
+		WorkflowStates struct {
+			Nodes []struct {
+				ID string `json:"id"`
+			} `json:"nodes"`
+		} `json:"workflowStates"`
+	}
+
+	err = backend.query("WorkflowStates", `query WorkflowStates($filter: WorkflowStateFilter) {
+		workflowStates(filter: $filter, first: 1) { nodes { id } }
+	}`, map[string]interface{}{
+		"filter": map[string]interface{}{
+			"team": map[string]interface{}{"id": map[string]string{"eq": team.ID}},
+			"type": map[string]string{"eq": stateType},
+		},
+	}, &result)
+	if err != nil {
+		return Story{}, err
+	}
+
+	if len(result.WorkflowStates.Nodes) == 0 {
+		return Story{}, fmt.Errorf("team %s has no %s state", backend.TeamKey, stateType)
+	}
+
+	return backend.updateIssue(id, map[string]interface{}{"stateId": result.WorkflowStates.Nodes[0].ID})
+}
+
+// DeliverStoryWithComment only leaves the comment, as Linear workflows have no
+// common state for work awaiting acceptance.
+func (backend *LinearBackend) DeliverStoryWithComment(id int, comment string) (Story, error) {
+	if _, err := backend.CreateStoryComment(id, comment); err != nil {
+		return Story{}, err
+	}
+
+	issue, err := backend.fetchIssue(id)
+	if err != nil {
+		return Story{}, err
+	}
+
+	return backend.toStory(issue), nil
+}
+
+func (backend *LinearBackend) AddStoryLabel(id int, label string) error {
+	labelID, err := backend.labelID(label)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		IssueAddLabel linearIssuePayload `json:"issueAddLabel"`
+	}
+
+	return backend.query("IssueAddLabel", `mutation IssueAddLabel($id: String!, $labelId: String!) {
+		issueAddLabel(id: $id, labelId: $labelId) { success }
+	}`, map[string]interface{}{"id": backend.identifier(id), "labelId": labelID}, &result)
+}
+
+func (backend *LinearBackend) RemoveStoryLabel(id int, label tracker.Label) error {
+	labelID, err := backend.labelID(label.Name)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		IssueRemoveLabel linearIssuePayload `json:"issueRemoveLabel"`
+	}
+
+	return backend.query("IssueRemoveLabel", `mutation IssueRemoveLabel($id: String!, $labelId: String!) {
+		issueRemoveLabel(id: $id, labelId: $labelId) { success }
+	}`, map[string]interface{}{"id": backend.identifier(id), "labelId": labelID}, &result)
+}
+
+func (backend *LinearBackend) StoryComments(id int) ([]StoryComment, error) {
+	var comments []StoryComment
+
+	var after *string
+	for {
+		var result struct {
+			Issue struct {
+				Comments struct {
+					Nodes    []linearComment `json:"nodes"`
+					PageInfo linearPageInfo  `json:"pageInfo"`
+				} `json:"comments"`
+			} `json:"issue"`
+		}
+
+		err := backend.query("IssueComments", `query IssueComments($id: String!, $first: Int, $after: String) {
+			issue(id: $id) {
+				comments(first: $first, after: $after) {
+					nodes { `+linearCommentFields+` }
+					pageInfo { hasNextPage endCursor }
+				}
+			}
+		}`, map[string]interface{}{
+			"id":    backend.identifier(id),
+			"first": linearPageSize,
+			"after": after,
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, comment := range result.Issue.Comments.Nodes {
+			comments = append(comments, backend.toComment(id, comment))
+		}
+
+		pageInfo := result.Issue.Comments.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+
+		after = &pageInfo.EndCursor
+	}
+
+	return comments, nil
+}
+
+func (backend *LinearBackend) CreateStoryComment(id int, text string) (StoryComment, error) {
+	issue, err := backend.fetchIssue(id)
+	if err != nil {
+		return StoryComment{}, err
+	}
+
+	var result struct {
+		CommentCreate struct {
+			Success bool          `json:"success"`
+			Comment linearComment `json:"comment"`
+		} `json:"commentCreate"`
+	}
+
+	err = backend.query("CommentCreate", `mutation CommentCreate($input: CommentCreateInput!) {
+		commentCreate(input: $input) { success comment { `+linearCommentFields+` } }
+	}`, map[string]interface{}{
+		"input": map[string]string{"issueId": issue.ID, "body": text},
+	}, &result)
+	if err != nil {
+		return StoryComment{}, err
+	}
+
+	return backend.toComment(id, result.CommentCreate.Comment), nil
+}
+
+// Members returns the people seen so far.
+func (backend *LinearBackend) Members() ([]tracker.Person, error) {
+	backend.peopleLock.Lock()
+	defer backend.peopleLock.Unlock()
+
+	var people []tracker.Person
+	for _, person := range backend.people {
+		people = append(people, person)
+	}
+
+	return people, nil
+}
+
+func (backend *LinearBackend) search(filter map[string]interface{}) (StorySet, error) {
+	teamFilter := map[string]interface{}{
+		"team": map[string]interface{}{
+			"key": map[string]string{"eq": backend.TeamKey},
+		},
+	}
+
+	for key, value := range filter {
+		teamFilter[key] = value
+	}
+
+	var stories StorySet
+
+	var after *string
+	for {
+		var result struct {
+			Issues struct {
+				Nodes    []linearIssue  `json:"nodes"`
+				PageInfo linearPageInfo `json:"pageInfo"`
+			} `json:"issues"`
+		}
+
+		err := backend.query("Issues", `query Issues($filter: IssueFilter, $first: Int, $after: String) {
+			issues(filter: $filter, first: $first, after: $after) {
+				nodes { `+linearIssueFields+` }
+				pageInfo { hasNextPage endCursor }
+			}
+		}`, map[string]interface{}{
+			"filter": teamFilter,
+			"first":  linearPageSize,
+			"after":  after,
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, issue := range result.Issues.Nodes {
+			stories = append(stories, backend.toStory(issue))
+		}
+
+		if !result.Issues.PageInfo.HasNextPage {
+			break
+		}
+
+		after = &result.Issues.PageInfo.EndCursor
+	}
+
+	return stories, nil
+}
+
+func (backend *LinearBackend) fetchIssue(id int) (linearIssue, error) {
+	var result struct {
+		Issue linearIssue `json:"issue"`
+	}
+
+	err := backend.query("Issue", `query Issue($id: String!) {
+		issue(id: $id) { `+linearIssueFields+` }
+	}`, map[string]interface{}{"id": backend.identifier(id)}, &result)
+	if err != nil {
+		return linearIssue{}, err
+	}
+
+	return result.Issue, nil
+}
+
+func (backend *LinearBackend) updateIssue(id int, input map[string]interface{}) (Story, error) {
+	var result struct {
+		IssueUpdate linearIssuePayload `json:"issueUpdate"`
+	}
+
+	err := backend.query("IssueUpdate", `mutation IssueUpdate($id: String!, $input: IssueUpdateInput!) {
+		issueUpdate(id: $id, input: $input) { success issue { `+linearIssueFields+` } }
+	}`, map[string]interface{}{"id": backend.identifier(id), "input": input}, &result)
+	if err != nil {
+		return Story{}, err
+	}
+
+	return backend.toStory(result.IssueUpdate.Issue), nil
+}
+
+func (backend *LinearBackend) fetchTeam() (*linearTeam, error) {
+	backend.lock.Lock()
+	defer backend.lock.Unlock()
+
+	if backend.team != nil {
+		return backend.team, nil
+	}
+
+	var result struct {
+		Teams struct {
+			Nodes []linearTeam `json:"nodes"`
+		} `json:"teams"`
+	}
+
+	err := backend.query("Team", `query Team($filter: TeamFilter) {
+		teams(filter: $filter) { nodes { id key organization { urlKey } } }
+	}`, map[string]interface{}{
+		"filter": map[string]interface{}{
+			"key": map[string]string{"eq": backend.TeamKey},
+		},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Teams.Nodes) == 0 {
+		return nil, fmt.Errorf("team %s not found", backend.TeamKey)
+	}
+
+	backend.team = &result.Teams.Nodes[0]
+
+	return backend.team, nil
+}
+
+// labelID finds the team or workspace label with the given name, creating it
+// on the team if there isn't one.
+func (backend *LinearBackend) labelID(name string) (string, error) {
+	team, err := backend.fetchTeam()
+	if err != nil {
+		return "", err
+	}
+
+	backend.lock.Lock()
+	defer backend.lock.Unlock()
+
+	if id, found := backend.labelIDs[name]; found {
+		return id, nil
+	}
+
+	var found struct {
+		IssueLabels struct {
+			Nodes []linearLabel `json:"nodes"`
+		} `json:"issueLabels"`
+	}
+
+	err = backend.query("IssueLabels", `query IssueLabels($filter: IssueLabelFilter) {
+		issueLabels(filter: $filter) { nodes { id name } }
+	}`, map[string]interface{}{
+		"filter": map[string]interface{}{
+			"name": map[string]string{"eq": name},
+			"or": []interface{}{
+				map[string]interface{}{"team": map[string]interface{}{"id": map[string]string{"eq": team.ID}}},
+				map[string]interface{}{"team": map[string]bool{"null": true}},
+			},
+		},
+	}, &found)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	if len(found.IssueLabels.Nodes) > 0 {
+		id = found.IssueLabels.Nodes[0].ID
+	} else {
+		var created struct {
+			IssueLabelCreate struct {
+				Success    bool        `json:"success"`
+				IssueLabel linearLabel `json:"issueLabel"`
+			} `json:"issueLabelCreate"`
+		}
+
+		err := backend.query("IssueLabelCreate", `mutation IssueLabelCreate($input: IssueLabelCreateInput!) {
+			issueLabelCreate(input: $input) { success issueLabel { id name } }
+		}`, map[string]interface{}{
+			"input": map[string]string{"name": name, "teamId": team.ID},
+		}, &created)
+		if err != nil {
+			return "", fmt.Errorf("failed to create label '%s': %s", name, err)
+		}
+
+		id = created.IssueLabelCreate.IssueLabel.ID
+	}
+
+	if backend.labelIDs == nil {
+		backend.labelIDs = map[string]string{}
+	}
+
+	backend.labelIDs[name] = id
+
+	return id, nil
+}
+
+// identifier is how an issue is referred to in queries, e.g. ENG-123.
+func (backend *LinearBackend) identifier(id int) string {
+	return fmt.Sprintf("%s-%d", backend.TeamKey, id)
+}
+
+func (backend *LinearBackend) toStory(issue linearIssue) Story {
+	state, found := linearStoryStates[issue.State.Type]
+	if !found {
+		state = tracker.StoryStateUnscheduled
+	}
+
+	story := Story{
+		Story: tracker.Story{
+			ID:          issue.Number,
+			URL:         issue.URL,
+			Name:        issue.Title,
+			Description: issue.Description,
+			Type:        tracker.StoryTypeFeature,
+			State:       state,
+			CreatedAt:   issue.CreatedAt,
+			UpdatedAt:   issue.UpdatedAt,
+		},
+	}
+
+	for _, label := range issue.Labels.Nodes {
+		if storyType, isType := linearStoryType(label.Name); isType {
+			story.Type = storyType
+			continue
+		}
+
+		story.Labels = append(story.Labels, tracker.Label{Name: label.Name})
+	}
+
+	if issue.Assignee != nil {
+		story.OwnerIDs = []int{backend.person(*issue.Assignee).ID}
+	}
+
+	if state == tracker.StoryStateAccepted {
+		story.AcceptedAt = issue.CompletedAt
+		if story.AcceptedAt == nil {
+			story.AcceptedAt = issue.UpdatedAt
+		}
+	}
+
+	return story
+}
+
+func (backend *LinearBackend) toComment(storyID int, comment linearComment) StoryComment {
+	converted := StoryComment{
+		ID:        linearNumber(comment.ID),
+		StoryID:   storyID,
+		Text:      comment.Body,
+		CreatedAt: comment.CreatedAt,
+	}
+
+	if comment.User != nil {
+		converted.PersonID = backend.person(*comment.User).ID
+	}
+
+	return converted
+}
+
+// person numbers the user the first time they're seen.
+func (backend *LinearBackend) person(user linearUser) tracker.Person {
+	backend.peopleLock.Lock()
+	defer backend.peopleLock.Unlock()
+
+	if backend.people == nil {
+		backend.people = map[string]tracker.Person{}
+	}
+
+	person, found := backend.people[user.ID]
+	if !found {
+		name := user.DisplayName
+		if user.Name != "" {
+			name = user.Name
+		}
+
+		person = tracker.Person{
+			ID:       len(backend.people) + 1,
+			Name:     name,
+			Username: user.DisplayName,
+			Email:    user.Email,
+		}
+
+		backend.people[user.ID] = person
+	}
+
+	return person
+}
+
+func (backend *LinearBackend) query(operation string, query string, variables map[string]interface{}, result interface{}) error {
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	api := backend.api(operation)
+	if strings.HasPrefix(strings.TrimSpace(query), "query") {
+		// reads are safe to retry on server errors, unlike mutations; the
+		// nil value marks the request without sending the header
+		api.Header["X-Idempotency-Key"] = nil
+	}
+
+	err := api.request("POST", "", nil, map[string]interface{}{
+		"operationName": operation,
+		"query":         query,
+		"variables":     variables,
+	}, &response)
+	if err != nil {
+		return err
+	}
+
+	if len(response.Errors) > 0 {
+		var messages []string
+		for _, gqlErr := range response.Errors {
+			messages = append(messages, gqlErr.Message)
+		}
+
+		return fmt.Errorf("linear %s: %s", operation, strings.Join(messages, "; "))
+	}
+
+	return json.Unmarshal(response.Data, result)
+}
+
+// api names the operation in errors, as every query is sent to the same URL.
+func (backend *LinearBackend) api(operation string) restAPI {
+	return restAPI{
+		Name:    "linear " + operation,
+		BaseURL: backend.URL,
+		Header:  http.Header{"Authorization": {backend.Token}},
+		Client:  backend.Client,
+	}
+}
+
+func linearStoryType(labelName string) (tracker.StoryType, bool) {
+	switch strings.ToLower(labelName) {
+	case "feature":
+		return tracker.StoryTypeFeature, true
+	case "bug":
+		return tracker.StoryTypeBug, true
+	case "chore":
+		return tracker.StoryTypeChore, true
+	default:
+		return "", false
+	}
+}
+
+// linearNumber derives a stable number from a Linear UUID.
+func linearNumber(id string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return int(hash.Sum32() >> 1)
+}
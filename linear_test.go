@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vito/tracksuit/fakes"
+)
+
+const testLinearTeam = "ENG"
+
+// linearFixture syncs a fake GitHub organization with a fake Linear team.
+type linearFixture struct {
+	GitHub *fakes.GitHub
+	Linear *fakes.Linear
+
+	Syncer *Syncer
+}
+
+func newLinearFixture(t *testing.T) *linearFixture {
+	gh := fakes.NewGitHub(testBotLogin)
+	t.Cleanup(gh.Close)
+
+	linear := fakes.NewLinear(testLinearTeam)
+	t.Cleanup(linear.Close)
+
+	gh.AddRepo(testOrganization, testRepo)
+
+	return &linearFixture{
+		GitHub: gh,
+		Linear: linear,
+
+		Syncer: &Syncer{
+			Source:           &GitHubSource{Client: gh.Client()},
+			Backend:          NewLinearBackend(linear.URL, testLinearTeam, "some-token", nil),
+			OrganizationName: testOrganization,
+			CloseIssues:      true,
+		},
+	}
+}
+
+func (fixture *linearFixture) sync(t *testing.T) {
+	t.Helper()
+
+	if err := fixture.Syncer.SyncIssuesAndStories(); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+}
+
+// issues returns the Linear issues for the GitHub issue, failing unless there
+// are as many as expected.
+func (fixture *linearFixture) issues(t *testing.T, number int, expected int) []fakes.LinearIssue {
+	t.Helper()
+
+	label := issueLabel("", testOrganization, testRepo, number)
+
+	var issues []fakes.LinearIssue
+	for _, issue := range fixture.Linear.Issues() {
+		for _, name := range issue.LabelNames() {
+			if name == label {
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	if len(issues) != expected {
+		t.Fatalf("expected %d Linear issues for #%d, got %d: %+v", expected, number, len(issues), issues)
+	}
+
+	return issues
+}
+
+func (fixture *linearFixture) issueState(number int) string {
+	return *fixture.GitHub.Issue(testOrganization, testRepo, number).State
+}
+
+func TestLinearSyncCreatesIssuesForNewIssues(t *testing.T) {
+	fixture := newLinearFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+	if issue.Title != "something broke" || issue.State.Type != "backlog" {
+		t.Errorf("unexpected Linear issue: %+v", issue)
+	}
+
+	if labels := strings.Join(issue.LabelNames(), ","); !strings.Contains(labels, "Bug") {
+		t.Errorf("expected the Linear issue to be labelled Bug, got %s", labels)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelUnscheduled)
+
+	var comment string
+	for _, c := range fixture.GitHub.Comments(testOrganization, testRepo, 1) {
+		if *c.User.Login == testBotLogin {
+			comment = *c.Body
+		}
+	}
+
+	if !strings.Contains(comment, "We use Linear") || !strings.Contains(comment, issue.URL) {
+		t.Errorf("expected the status comment to link to the Linear issue:\n%s", comment)
+	}
+
+	fixture.sync(t)
+
+	fixture.issues(t, 1, 1)
+}
+
+func TestLinearSyncReflectsWorkflowStatesOnIssueLabels(t *testing.T) {
+	fixture := newLinearFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+
+	fixture.Linear.SetIssueState(issue.Number, "unstarted")
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelScheduled)
+
+	fixture.Linear.SetIssueState(issue.Number, "started")
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelInFlight)
+}
+
+func TestLinearSyncClosesIssuesOnceCompleted(t *testing.T) {
+	fixture := newLinearFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+	fixture.Linear.SetIssueState(issue.Number, "completed")
+
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+}
+
+func TestLinearSyncLeavesIssuesOfCanceledIssuesOpen(t *testing.T) {
+	fixture := newLinearFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	issue := fixture.issues(t, 1, 1)[0]
+
+	fixture.Linear.SetIssueState(issue.Number, "started")
+	fixture.sync(t)
+
+	fixture.Linear.SetIssueState(issue.Number, "canceled")
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected issue to be left open, got %s", state)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelUnscheduled)
+
+	// no replacement for the canceled issue
+	if issue := fixture.issues(t, 1, 1)[0]; issue.State.Type != "canceled" {
+		t.Fatalf("expected the Linear issue to stay canceled, got %s", issue.State.Type)
+	}
+}
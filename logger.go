@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "debug",
+	LogLevelInfo:  "info",
+	LogLevelWarn:  "warn",
+	LogLevelError: "error",
+}
+
+func (level LogLevel) String() string {
+	return logLevelNames[level]
+}
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level '%s'", name)
+}
+
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+// Logger writes leveled log lines, each carrying the fields attached with
+// With. A nil *Logger logs text at info level to stderr.
+type Logger struct {
+	out    io.Writer
+	format LogFormat
+	level  LogLevel
+
+	fields []logField
+
+	lock *sync.Mutex
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+var defaultLogger = NewLogger(os.Stderr, LogFormatText, LogLevelInfo)
+
+func NewLogger(out io.Writer, format LogFormat, level LogLevel) *Logger {
+	return &Logger{
+		out:    out,
+		format: format,
+		level:  level,
+
+		lock: &sync.Mutex{},
+	}
+}
+
+// With returns a logger that adds the given key/value pairs to every line.
+func (logger *Logger) With(pairs ...interface{}) *Logger {
+	logger = logger.orDefault()
+
+	child := *logger
+	child.fields = append(append([]logField{}, logger.fields...), toFields(pairs)...)
+
+	return &child
+}
+
+func (logger *Logger) Format() LogFormat {
+	return logger.orDefault().format
+}
+
+func (logger *Logger) Debug(message string, pairs ...interface{}) {
+	logger.log(LogLevelDebug, message, pairs)
+}
+
+func (logger *Logger) Info(message string, pairs ...interface{}) {
+	logger.log(LogLevelInfo, message, pairs)
+}
+
+func (logger *Logger) Warn(message string, pairs ...interface{}) {
+	logger.log(LogLevelWarn, message, pairs)
+}
+
+// Error logs the error under the "error" field.
+func (logger *Logger) Error(message string, err error, pairs ...interface{}) {
+	logger.log(LogLevelError, message, append([]interface{}{"error", err}, pairs...))
+}
+
+func (logger *Logger) orDefault() *Logger {
+	if logger == nil {
+		return defaultLogger
+	}
+
+	return logger
+}
+
+func (logger *Logger) log(level LogLevel, message string, pairs []interface{}) {
+	logger = logger.orDefault()
+
+	if level < logger.level {
+		return
+	}
+
+	fields := append(append([]logField{}, logger.fields...), toFields(pairs)...)
+	now := time.Now()
+
+	buf := new(bytes.Buffer)
+
+	switch logger.format {
+	case LogFormatJSON:
+		buf.WriteString(`{"time":`)
+		writeJSONValue(buf, now.UTC().Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSONValue(buf, level.String())
+		buf.WriteString(`,"message":`)
+		writeJSONValue(buf, message)
+
+		for _, field := range fields {
+			buf.WriteString(",")
+			writeJSONValue(buf, field.key)
+			buf.WriteString(":")
+			writeJSONValue(buf, field.value)
+		}
+
+		buf.WriteString("}\n")
+
+	default:
+		fmt.Fprintf(buf, "%s %-5s %s", now.Format("2006/01/02 15:04:05"), level, message)
+
+		for _, field := range fields {
+			fmt.Fprintf(buf, " %s=%s", field.key, textValue(field.value))
+		}
+
+		buf.WriteString("\n")
+	}
+
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	logger.out.Write(buf.Bytes())
+}
+
+func toFields(pairs []interface{}) []logField {
+	var fields []logField
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields = append(fields, logField{
+			key:   fmt.Sprint(pairs[i]),
+			value: pairs[i+1],
+		})
+	}
+
+	return fields
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	payload, err := json.Marshal(value)
+	if err != nil {
+		payload, _ = json.Marshal(fmt.Sprint(value))
+	}
+
+	buf.Write(payload)
+}
+
+// textValue quotes values that would otherwise be ambiguous in a text line.
+func textValue(value interface{}) string {
+	str := fmt.Sprint(value)
+	if str == "" || strings.ContainsAny(str, " \t\n\"=") {
+		return strconv.Quote(str)
+	}
+
+	return str
+}
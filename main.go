@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"text/template"
+	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/hashicorp/go-multierror"
 	flags "github.com/jessevdk/go-flags"
 	"github.com/vito/twentythousandtonnesofcrudeoil"
 	"github.com/xoebus/go-tracker"
@@ -14,64 +18,615 @@ import (
 )
 
 type TracksuitCommand struct {
+	ConfigFile string `long:"config" value-name:"PATH" description:"YAML file mapping many GitHub organizations, GitLab groups, or Gitea organizations to Tracker, Jira, or Linear projects. Replaces --github-organization-name, --gitlab-group, --gitea-organization, --github-repository, --github-exclude-repository, --tracker-project-id, --jira-project, and --linear-team, which can't be given with it. Other flags are defaults that each mapping can override."`
+
 	GitHub struct {
-		Token            string `long:"token"             required:"true" description:"GitHub access token"`
-		OrganizationName string `long:"organization-name" required:"true" description:"GitHub organization name"`
+		Token            string `long:"token"             description:"GitHub access token. Not needed when authenticating as a GitHub App."`
+		OrganizationName string `long:"organization-name" description:"GitHub organization name"`
+
+		Repositories        []string `long:"repository"         description:"Repository to sync, as a name, glob pattern, or topic:NAME. Can be repeated to sync many repositories. If omitted, all repositories are synced."`
+		ExcludeRepositories []string `long:"exclude-repository" description:"Repository to skip, as a name, glob pattern, or topic:NAME. Can be repeated."`
+		APIURL              string   `long:"api-url" description:"Github api url. If omitted it defaults to api.github.com"`
+
+		RetryBudget time.Duration `long:"retry-budget" default:"1h" description:"Total time to spend waiting out GitHub rate limits for a single request"`
 
-		Repositories []string `long:"repository" desciption:"Repository to sync. Can be repeated to sync many repositories. If omitted, all repositories are synced."`
-		APIURL string `long:"api-url" description:"Github api url. If omitted it defaults to api.github.com"`
+		AppID         int    `long:"app-id"          description:"GitHub App ID to authenticate as, instead of using --github-token"`
+		AppPrivateKey string `long:"app-private-key" value-name:"PATH" description:"PEM-encoded private key of the GitHub App"`
 	} `group:"GitHub Configuration" namespace:"github"`
 
+	GitLab struct {
+		URL   string `long:"url"   description:"GitLab url. If omitted it defaults to https://gitlab.com"`
+		Token string `long:"token" description:"GitLab access token"`
+		Group string `long:"group" description:"GitLab group whose projects to sync instead of a GitHub organization, including its subgroups"`
+
+		RetryBudget time.Duration `long:"retry-budget" default:"5m" description:"Total time to spend retrying a GitLab request that was rate limited, or that failed with a server error and is safe to repeat"`
+	} `group:"GitLab Configuration" namespace:"gitlab"`
+
+	Gitea struct {
+		URL          string `long:"url"          description:"Gitea or Forgejo url, e.g. https://codeberg.org"`
+		Token        string `long:"token"        description:"Gitea access token"`
+		Organization string `long:"organization" description:"Gitea organization whose repositories to sync instead of a GitHub organization"`
+
+		RetryBudget time.Duration `long:"retry-budget" default:"5m" description:"Total time to spend retrying a Gitea request that was rate limited, or that failed with a server error and is safe to repeat"`
+	} `group:"Gitea Configuration" namespace:"gitea"`
+
 	Tracker struct {
-		Token     string `long:"token"      required:"true" description:"Tracker Access token"`
-		ProjectID int    `long:"project-id" required:"true" description:"Tracker project ID"`
+		Token     string `long:"token"      description:"Tracker Access token. Required when syncing with a Tracker project."`
+		ProjectID int    `long:"project-id" description:"Tracker project ID"`
+
+		APIURL string `long:"api-url" description:"Tracker api url. If omitted it defaults to https://www.pivotaltracker.com"`
+
+		RetryBudget time.Duration `long:"retry-budget" default:"5m" description:"Total time to spend retrying a Tracker request that was rate limited, or that failed with a server error and is safe to repeat"`
 	} `group:"Pivotal Tracker Configuration" namespace:"tracker"`
 
+	Jira struct {
+		URL     string `long:"url"     description:"Jira base URL, e.g. https://example.atlassian.net"`
+		User    string `long:"user"    description:"Jira user to authenticate as with --jira-token, e.g. the email address of a Jira Cloud account. If omitted, --jira-token is sent as a bearer token."`
+		Token   string `long:"token"   description:"Jira API token, or personal access token for Jira Server"`
+		Project string `long:"project" description:"Jira project key to sync with instead of a Tracker project"`
+
+		Server bool `long:"server" description:"Jira is Jira Server or Data Center rather than Jira Cloud"`
+
+		RetryBudget time.Duration `long:"retry-budget" default:"5m" description:"Total time to spend retrying a Jira request that was rate limited, or that failed with a server error and is safe to repeat"`
+	} `group:"Jira Configuration" namespace:"jira"`
+
+	Linear struct {
+		APIURL string `long:"api-url" description:"Linear GraphQL API url. If omitted it defaults to https://api.linear.app/graphql"`
+		Token  string `long:"token"   description:"Linear API key, or an OAuth access token prefixed with 'Bearer '"`
+		Team   string `long:"team"    description:"Linear team key to sync with instead of a Tracker project"`
+
+		RetryBudget time.Duration `long:"retry-budget" default:"5m" description:"Total time to spend retrying a Linear request that was rate limited, or that failed with a server error and is safe to repeat"`
+	} `group:"Linear Configuration" namespace:"linear"`
+
+	IncludePrivate bool `long:"include-private" description:"Sync private and internal repositories, not just public ones"`
+	SkipArchived   bool `long:"skip-archived"   description:"Skip archived repositories"`
+	SkipForks      bool `long:"skip-forks"      description:"Skip forked repositories"`
+
 	AdditionalLabels map[string]string `long:"label" value-name:"NAME:COLOR" description:"Additional labels to sync up between GitHub and Tracker. They will be created on the synced GitHub repositories automatically."`
 
+	StoryTypeLabels []string `long:"story-type-label" value-name:"LABEL:TYPE" description:"Issue label that determines the story type (feature, bug, or chore). Earlier labels take priority. Defaults to enhancement:feature and bug:bug."`
+
+	StateLabels           map[string]string `long:"state-label"             value-name:"STATE:LABEL" description:"Issue label to reflect a story state with, in place of its default unscheduled, scheduled, or in-flight label. Other states keep their defaults. Colors can be set with --label."`
+	StateLabelAggregation string            `long:"state-label-aggregation" default:"any-in-progress" choice:"any-in-progress" choice:"least-advanced" description:"Which story's state to reflect on issues with many stories: the most advanced one that hasn't been accepted, or the least advanced one"`
+
 	GCLabels bool `long:"gc-labels" description:"Garbage collect labels in Tracker that no longer reference an issue"`
+
+	ClosePolicy      string        `long:"close-policy"       default:"accepted" choice:"accepted" choice:"pull-request-merged" choice:"never" description:"When to close issues: once all their stories are accepted, once a linked pull request has also merged, or never"`
+	CloseGracePeriod time.Duration `long:"close-grace-period" default:"0s" description:"How long to wait after the last story is accepted before closing an issue"`
+	KeepOpenLabel    string        `long:"keep-open-label"    default:"keep-open" description:"Issue label that keeps an issue from being closed"`
+
+	DedupePolicy     string `long:"dedupe-policy"      default:"delete" choice:"delete" choice:"label" choice:"merge" description:"What to do with duplicate stories for an issue: delete them, label them tracksuit-duplicate and leave them, or move their comments onto the original before deleting them"`
+	MaxDupeDeletions int    `long:"max-dupe-deletions" default:"25" description:"Most duplicate stories to delete in a single sync. Set to 0 for no limit."`
+
+	OrphanPolicy string `long:"orphan-policy" default:"ignore" choice:"ignore" choice:"report" choice:"label" choice:"accept" choice:"move" description:"What to do on full syncs with stories whose issue was closed by hand, moved, or deleted: nothing, log them, label them, accept them, or move them to --orphan-state"`
+	OrphanLabel  string `long:"orphan-label"  default:"issue-closed" description:"Label to give orphaned stories with --orphan-policy label"`
+	OrphanState  string `long:"orphan-state"  value-name:"STATE" description:"State to move orphaned stories to with --orphan-policy move, e.g. unscheduled"`
+
+	StatusCommentTemplate string `long:"status-comment-template" value-name:"PATH" description:"Go text/template file to render the status comment on each issue with"`
+	ClosedCommentTemplate string `long:"closed-comment-template" value-name:"PATH" description:"Go text/template file to render the comment left when closing an issue with"`
+
+	LinkPullRequests    bool          `long:"link-pull-requests"    description:"Link pull requests that reference issues ('Fixes #123') or stories ('[#12345]') and deliver their stories when they merge"`
+	PullRequestLookback time.Duration `long:"pull-request-lookback" default:"168h" description:"How far back to look for merged pull requests when linking pull requests"`
+
+	MirrorComments bool `long:"mirror-comments" description:"Mirror issue comments onto stories, and story comments tagged #public onto issues"`
+
+	Concurrency int `long:"concurrency" default:"1" description:"Number of repositories and issues to sync at once"`
+
+	StateFile string `long:"state-file" value-name:"PATH" description:"File in which to record sync progress, so that later runs only sync issues and stories that have changed"`
+	FullSync  bool   `long:"full"       description:"Sync everything, even if the state file says nothing has changed"`
+
+	LogFormat string `long:"log-format" default:"text" choice:"text" choice:"json" description:"Format to log in"`
+	LogLevel  string `long:"log-level"  default:"info" choice:"debug" choice:"info" choice:"warn" choice:"error" description:"Minimum level of log lines to write"`
+
+	MetricsFile string `long:"metrics-file" value-name:"PATH" description:"File to write metrics to after each sync, in the format read by node_exporter's textfile collector"`
+
+	DryRun     bool   `long:"dry-run"     description:"Print the changes that would be made to GitHub and Tracker without making them"`
+	PlanFormat string `long:"plan-format" default:"text" choice:"text" choice:"json" description:"Format to print the dry run plan in"`
+
+	Serve  ServeCommand  `command:"serve"  description:"Run a server that syncs issues as GitHub webhooks are received"`
+	Status StatusCommand `command:"status" description:"Show how each open issue compares with its stories, without changing anything"`
+
+	state *SyncState
+
+	metrics *Metrics
+
+	logger *Logger
+
+	// Transport, if set, makes the requests to every API in place of
+	// http.DefaultTransport.
+	Transport http.RoundTripper `no-flag:"true"`
+}
+
+// mappingSyncer pairs a Syncer with the mapping it was configured from.
+type mappingSyncer struct {
+	Mapping Mapping
+	Syncer  *Syncer
 }
 
 func (cmd *TracksuitCommand) Execute(argv []string) error {
-	ghToken := &oauth2.Token{AccessToken: cmd.GitHub.Token}
+	var plan *Plan
+	if cmd.DryRun {
+		plan = &Plan{}
+	}
+
+	syncers, err := cmd.newSyncers(plan)
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.sync(syncers); err != nil {
+		return err
+	}
+
+	if plan != nil {
+		return cmd.printPlan(plan)
+	}
+
+	return nil
+}
+
+func (cmd *TracksuitCommand) config() (Config, error) {
+	if cmd.ConfigFile != "" {
+		if flag := cmd.mappingFlag(); flag != "" {
+			return Config{}, fmt.Errorf("--%s can't be given with --config; set it in each mapping instead", flag)
+		}
+
+		return LoadConfig(cmd.ConfigFile)
+	}
+
+	if cmd.GitHub.OrganizationName == "" && cmd.GitLab.Group == "" && cmd.Gitea.Organization == "" {
+		return Config{}, errors.New("--github-organization-name, --gitlab-group, or --gitea-organization is required unless --config is given")
+	}
+
+	if cmd.Tracker.ProjectID == 0 && cmd.Jira.Project == "" && cmd.Linear.Team == "" {
+		return Config{}, errors.New("--tracker-project-id, --jira-project, or --linear-team is required unless --config is given")
+	}
+
+	config := Config{
+		Mappings: []Mapping{
+			{
+				GitHubOrganization:        cmd.GitHub.OrganizationName,
+				GitLabGroup:               cmd.GitLab.Group,
+				GiteaOrganization:         cmd.Gitea.Organization,
+				GitHubRepositories:        cmd.GitHub.Repositories,
+				GitHubExcludeRepositories: cmd.GitHub.ExcludeRepositories,
+				TrackerProjectID:          cmd.Tracker.ProjectID,
+				JiraProject:               cmd.Jira.Project,
+				LinearTeam:                cmd.Linear.Team,
+			},
+		},
+	}
+
+	return config, config.Validate()
+}
+
+// mappingFlag returns the first flag given that names what to sync, which a
+// --config file names for itself.
+func (cmd *TracksuitCommand) mappingFlag() string {
+	switch {
+	case cmd.GitHub.OrganizationName != "":
+		return "github-organization-name"
+	case len(cmd.GitHub.Repositories) > 0:
+		return "github-repository"
+	case len(cmd.GitHub.ExcludeRepositories) > 0:
+		return "github-exclude-repository"
+	case cmd.GitLab.Group != "":
+		return "gitlab-group"
+	case cmd.Gitea.Organization != "":
+		return "gitea-organization"
+	case cmd.Tracker.ProjectID != 0:
+		return "tracker-project-id"
+	case cmd.Jira.Project != "":
+		return "jira-project"
+	case cmd.Linear.Team != "":
+		return "linear-team"
+	default:
+		return ""
+	}
+}
+
+// withFlags fills in the settings the mapping leaves to flags.
+func (cmd *TracksuitCommand) withFlags(mapping Mapping) Mapping {
+	mapping.IncludePrivate = orFlag(mapping.IncludePrivate, cmd.IncludePrivate)
+	mapping.SkipArchived = orFlag(mapping.SkipArchived, cmd.SkipArchived)
+	mapping.SkipForks = orFlag(mapping.SkipForks, cmd.SkipForks)
+	mapping.GCLabels = orFlag(mapping.GCLabels, cmd.GCLabels)
+	mapping.LinkPullRequests = orFlag(mapping.LinkPullRequests, cmd.LinkPullRequests)
+	mapping.MirrorComments = orFlag(mapping.MirrorComments, cmd.MirrorComments)
+
+	if mapping.CloseGracePeriod == nil {
+		mapping.CloseGracePeriod = &cmd.CloseGracePeriod
+	}
 
-	ghAuth := oauth2.NewClient(oauth2.NoContext, oauth2.StaticTokenSource(ghToken))
+	if mapping.KeepOpenLabel == "" {
+		mapping.KeepOpenLabel = cmd.KeepOpenLabel
+	}
 
-	githubClient := github.NewClient(ghAuth)
+	if mapping.MaxDupeDeletions == nil {
+		mapping.MaxDupeDeletions = &cmd.MaxDupeDeletions
+	}
+
+	if mapping.OrphanLabel == "" {
+		mapping.OrphanLabel = cmd.OrphanLabel
+	}
+
+	if mapping.PullRequestLookback == nil {
+		mapping.PullRequestLookback = &cmd.PullRequestLookback
+	}
+
+	return mapping
+}
+
+func orFlag(setting *bool, flag bool) *bool {
+	if setting != nil {
+		return setting
+	}
+
+	return &flag
+}
+
+func (cmd *TracksuitCommand) httpTransport() http.RoundTripper {
+	if cmd.Transport != nil {
+		return cmd.Transport
+	}
+
+	return http.DefaultTransport
+}
 
+// apiTransport counts the requests made to the given API.
+func (cmd *TracksuitCommand) apiTransport(backend string) http.RoundTripper {
+	return &MetricsTransport{
+		Base:    cmd.httpTransport(),
+		Metrics: cmd.metrics,
+		Backend: backend,
+	}
+}
+
+func (cmd *TracksuitCommand) newSyncers(plan *Plan) ([]mappingSyncer, error) {
+	config, err := cmd.config()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.metrics = NewMetrics()
+
+	level, err := ParseLogLevel(cmd.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.logger = NewLogger(os.Stderr, LogFormat(cmd.LogFormat), level)
+
+	var apiURL *url.URL
 	if cmd.GitHub.APIURL != "" {
-		var url *url.URL
-		url, err := url.Parse(cmd.GitHub.APIURL)
+		apiURL, err = url.Parse(cmd.GitHub.APIURL)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		githubClient.BaseURL = url
 	}
 
-	trackerClient := tracker.NewClient(cmd.Tracker.Token)
-	projectClient := trackerClient.InProject(cmd.Tracker.ProjectID)
+	syncsGitHub := false
+	for _, mapping := range config.Mappings {
+		if mapping.GitHubOrganization != "" {
+			syncsGitHub = true
+		}
+	}
 
-	syncer := &Syncer{
-		GithubClient:  githubClient,
-		ProjectClient: projectClient,
+	var app *GitHubApp
+	if cmd.GitHub.AppID != 0 {
+		if cmd.GitHub.AppPrivateKey == "" {
+			return nil, errors.New("--github-app-private-key is required with --github-app-id")
+		}
 
-		OrganizationName: cmd.GitHub.OrganizationName,
-		Repositories:     cmd.GitHub.Repositories,
+		app, err = LoadGitHubApp(cmd.GitHub.AppID, cmd.GitHub.AppPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load GitHub App private key: %s", err)
+		}
 
-		AdditionalLabels: cmd.AdditionalLabels,
+		app.BaseURL = apiURL
+		app.Transport = cmd.apiTransport("github")
+		app.Logger = cmd.logger
+	} else if cmd.GitHub.Token == "" && syncsGitHub {
+		return nil, errors.New("--github-token is required unless authenticating with --github-app-id")
 	}
 
-	if err := syncer.SyncIssuesAndStories(); err != nil {
+	if cmd.StateFile != "" {
+		cmd.state, err = LoadSyncState(cmd.StateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load state: %s", err)
+		}
+	}
+
+	if cmd.Tracker.APIURL != "" {
+		if _, err := url.Parse(cmd.Tracker.APIURL); err != nil {
+			return nil, fmt.Errorf("invalid --tracker-api-url: %s", err)
+		}
+	}
+
+	trackerClient := &http.Client{
+		Transport: &RetryTransport{
+			Base:   cmd.apiTransport("tracker"),
+			Budget: cmd.Tracker.RetryBudget,
+			Logger: cmd.logger,
+		},
+	}
+
+	jiraClient := &http.Client{
+		Transport: &RetryTransport{
+			Base:   cmd.apiTransport("jira"),
+			Budget: cmd.Jira.RetryBudget,
+			Logger: cmd.logger,
+		},
+	}
+
+	linearClient := &http.Client{
+		Transport: &RetryTransport{
+			Base:   cmd.apiTransport("linear"),
+			Budget: cmd.Linear.RetryBudget,
+			Logger: cmd.logger,
+		},
+	}
+
+	gitlabClient := &http.Client{
+		Transport: &RetryTransport{
+			Base:   cmd.apiTransport("gitlab"),
+			Budget: cmd.GitLab.RetryBudget,
+			Logger: cmd.logger,
+		},
+	}
+
+	giteaClient := &http.Client{
+		Transport: &RetryTransport{
+			Base:   cmd.apiTransport("gitea"),
+			Budget: cmd.Gitea.RetryBudget,
+			Logger: cmd.logger,
+		},
+	}
+
+	var storyTypeLabels StoryTypeLabels
+	for _, pair := range cmd.StoryTypeLabels {
+		typeLabel, err := ParseStoryTypeLabel(pair)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --story-type-label: %s", err)
+		}
+
+		storyTypeLabels = append(storyTypeLabels, typeLabel)
+	}
+
+	stateLabels := StateLabels{
+		Labels:      map[tracker.StoryState]string{},
+		Aggregation: StateAggregation(cmd.StateLabelAggregation),
+	}
+
+	for state, label := range cmd.StateLabels {
+		stateLabels.Labels[tracker.StoryState(state)] = label
+	}
+
+	if err := ValidateStateLabels(stateLabels.Labels, stateLabels.Aggregation); err != nil {
+		return nil, fmt.Errorf("invalid --state-label: %s", err)
+	}
+
+	var syncers []mappingSyncer
+	for _, mapping := range config.Mappings {
+		mapping = cmd.withFlags(mapping)
+
+		backend, err := cmd.backend(mapping, trackerClient, jiraClient, linearClient)
+		if err != nil {
+			return nil, err
+		}
+
+		source, err := cmd.source(mapping, app, apiURL, gitlabClient, giteaClient)
+		if err != nil {
+			return nil, err
+		}
+
+		additionalLabels := map[string]string{}
+		for name, color := range cmd.AdditionalLabels {
+			additionalLabels[name] = color
+		}
+
+		for name, color := range mapping.AdditionalLabels {
+			additionalLabels[name] = color
+		}
+
+		typeLabels := mapping.StoryTypeLabels
+		if len(typeLabels) == 0 {
+			typeLabels = storyTypeLabels
+		}
+
+		mappingStateLabels := StateLabels{
+			Labels:      map[tracker.StoryState]string{},
+			Aggregation: stateLabels.Aggregation,
+		}
+
+		for state, label := range stateLabels.Labels {
+			mappingStateLabels.Labels[state] = label
+		}
+
+		for state, label := range mapping.StateLabels {
+			mappingStateLabels.Labels[state] = label
+		}
+
+		if mapping.StateLabelAggregation != "" {
+			mappingStateLabels.Aggregation = mapping.StateLabelAggregation
+		}
+
+		closePolicy := ClosePolicy(cmd.ClosePolicy)
+		if mapping.ClosePolicy != "" {
+			closePolicy = mapping.ClosePolicy
+		}
+
+		if err := ValidateClosePolicy(closePolicy, isTrue(mapping.LinkPullRequests)); err != nil {
+			return nil, fmt.Errorf("invalid close policy for %s: %s", mapping, err)
+		}
+
+		dedupePolicy := DedupePolicy(cmd.DedupePolicy)
+		if mapping.DedupePolicy != "" {
+			dedupePolicy = mapping.DedupePolicy
+		}
+
+		orphanPolicy := OrphanPolicy(cmd.OrphanPolicy)
+		if mapping.OrphanPolicy != "" {
+			orphanPolicy = mapping.OrphanPolicy
+		}
+
+		orphanState := tracker.StoryState(cmd.OrphanState)
+		if mapping.OrphanState != "" {
+			orphanState = mapping.OrphanState
+		}
+
+		if err := ValidateOrphanPolicy(orphanPolicy, orphanState); err != nil {
+			return nil, fmt.Errorf("invalid orphan policy for %s: %s", mapping, err)
+		}
+
+		if orphanPolicy == OrphanPolicyMove && orphanState == "" {
+			return nil, fmt.Errorf("invalid orphan policy for %s: moving orphaned stories requires --orphan-state", mapping)
+		}
+
+		statusTemplatePath := mapping.StatusCommentTemplate
+		if statusTemplatePath == "" {
+			statusTemplatePath = cmd.StatusCommentTemplate
+		}
+
+		statusTemplate, err := loadOptionalTemplate(statusTemplatePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status comment template: %s", err)
+		}
+
+		closedTemplatePath := mapping.ClosedCommentTemplate
+		if closedTemplatePath == "" {
+			closedTemplatePath = cmd.ClosedCommentTemplate
+		}
+
+		closedTemplate, err := loadOptionalTemplate(closedTemplatePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid closed comment template: %s", err)
+		}
+
+		syncers = append(syncers, mappingSyncer{
+			Mapping: mapping,
+			Syncer: &Syncer{
+				Source:  source,
+				Backend: backend,
+
+				OrganizationName:    mapping.Organization(),
+				Repositories:        mapping.GitHubRepositories,
+				ExcludeRepositories: mapping.GitHubExcludeRepositories,
+				IncludePrivate:      isTrue(mapping.IncludePrivate),
+				SkipArchived:        isTrue(mapping.SkipArchived),
+				SkipForks:           isTrue(mapping.SkipForks),
+
+				AdditionalLabels: additionalLabels,
+				StoryTypeLabels:  typeLabels,
+				StateLabels:      mappingStateLabels,
+
+				CloseIssues:      mapping.ShouldCloseIssues(),
+				ClosePolicy:      closePolicy,
+				CloseGracePeriod: *mapping.CloseGracePeriod,
+				KeepOpenLabel:    mapping.KeepOpenLabel,
+
+				DedupePolicy:     dedupePolicy,
+				MaxDupeDeletions: *mapping.MaxDupeDeletions,
+
+				OrphanPolicy: orphanPolicy,
+				OrphanLabel:  mapping.OrphanLabel,
+				OrphanState:  orphanState,
+
+				LinkPullRequests:    isTrue(mapping.LinkPullRequests),
+				PullRequestLookback: *mapping.PullRequestLookback,
+
+				MirrorComments: isTrue(mapping.MirrorComments),
+
+				StatusCommentTemplate: statusTemplate,
+				ClosedCommentTemplate: closedTemplate,
+
+				Concurrency: cmd.Concurrency,
+
+				Plan: plan,
+
+				State:    cmd.state,
+				FullSync: cmd.FullSync,
+
+				Metrics: cmd.metrics,
+				Logger:  cmd.logger,
+			},
+		})
+	}
+
+	return syncers, nil
+}
+
+func loadOptionalTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	return LoadCommentTemplate(path)
+}
+
+func (cmd *TracksuitCommand) sync(syncers []mappingSyncer) error {
+	var multiErr *multierror.Error
+
+	for _, ms := range syncers {
+		if len(syncers) > 1 {
+			cmd.logger.Info("syncing mapping", "mapping", ms.Mapping)
+		}
+
+		if err := ms.sync(); err != nil {
+			multiErr = multierror.Append(
+				multiErr,
+				fmt.Errorf("errors when syncing %s: %s", ms.Mapping, err),
+			)
+		}
+	}
+
+	// progress is only recorded for what synced successfully, so the state is
+	// worth saving even if some mappings failed
+	if cmd.state != nil && !cmd.DryRun {
+		if err := cmd.state.Save(cmd.StateFile); err != nil {
+			multiErr = multierror.Append(
+				multiErr,
+				fmt.Errorf("failed to save state: %s", err),
+			)
+		}
+	}
+
+	if cmd.MetricsFile != "" {
+		if err := cmd.metrics.WriteFile(cmd.MetricsFile); err != nil {
+			multiErr = multierror.Append(
+				multiErr,
+				fmt.Errorf("failed to write metrics: %s", err),
+			)
+		}
+	}
+
+	return multiErr.ErrorOrNil()
+}
+
+func (ms mappingSyncer) sync() error {
+	if err := ms.Syncer.SyncIssuesAndStories(); err != nil {
 		return err
 	}
 
-	log.Println("synced")
+	logger := ms.Syncer.logger()
+
+	logger.Info("synced")
+
+	if isTrue(ms.Mapping.GCLabels) {
+		labels, ok := ms.Syncer.Backend.(ProjectLabels)
+		if !ok {
+			logger.Warn("backend has no project labels to gc")
+			return nil
+		}
 
-	if cmd.GCLabels {
-		log.Println("gcing labels")
+		logger.Info("gcing labels")
 
 		gcer := &LabelGCer{
-			ProjectClient: projectClient,
+			Labels: labels,
+
+			Plan: ms.Syncer.Plan,
+
+			Logger: logger.With("project", ms.Syncer.Backend.Project()),
 		}
 
 		gcer.GC()
@@ -80,19 +635,142 @@ func (cmd *TracksuitCommand) Execute(argv []string) error {
 	return nil
 }
 
-func main() {
-	cmd := &TracksuitCommand{}
+// source returns the forge whose issues the mapping syncs.
+func (cmd *TracksuitCommand) source(mapping Mapping, app *GitHubApp, apiURL *url.URL, gitlabClient *http.Client, giteaClient *http.Client) (IssueSource, error) {
+	if mapping.GitLabGroup != "" {
+		if cmd.GitLab.Token == "" {
+			return nil, fmt.Errorf("--gitlab-token is required to sync %s", mapping)
+		}
+
+		gitlabURL := GitLabDefaultURL
+		if cmd.GitLab.URL != "" {
+			gitlabURL = cmd.GitLab.URL
+		}
+
+		return NewGitLabSource(gitlabURL, cmd.GitLab.Token, gitlabClient), nil
+	}
+
+	if mapping.GiteaOrganization != "" {
+		if cmd.Gitea.URL == "" || cmd.Gitea.Token == "" {
+			return nil, fmt.Errorf("--gitea-url and --gitea-token are required to sync %s", mapping)
+		}
+
+		return NewGiteaSource(cmd.Gitea.URL, cmd.Gitea.Token, giteaClient), nil
+	}
+
+	var tokenSource oauth2.TokenSource
+	var botLogin string
+	if app != nil {
+		// each organization has its own installation of the app
+		tokenSource = app.TokenSource(mapping.GitHubOrganization)
+
+		var err error
+		botLogin, err = app.BotLogin()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cmd.GitHub.Token})
+	}
+
+	githubClient := github.NewClient(&http.Client{
+		Transport: &GitHubRateLimitTransport{
+			Base: &oauth2.Transport{
+				Source: tokenSource,
+				Base:   cmd.apiTransport("github"),
+			},
+			Budget: cmd.GitHub.RetryBudget,
+			Logger: cmd.logger,
+		},
+	})
+	if apiURL != nil {
+		githubClient.BaseURL = apiURL
+	}
+
+	return &GitHubSource{
+		Client:            githubClient,
+		BotLogin:          botLogin,
+		InstallationRepos: app != nil,
+	}, nil
+}
+
+// backend returns the project that the mapping syncs with.
+func (cmd *TracksuitCommand) backend(mapping Mapping, trackerClient *http.Client, jiraClient *http.Client, linearClient *http.Client) (StoryBackend, error) {
+	if mapping.JiraProject != "" {
+		if cmd.Jira.URL == "" || cmd.Jira.Token == "" {
+			return nil, fmt.Errorf("--jira-url and --jira-token are required to sync %s", mapping)
+		}
+
+		backend := NewJiraBackend(cmd.Jira.URL, mapping.JiraProject, cmd.Jira.User, cmd.Jira.Token, jiraClient)
+		backend.Server = cmd.Jira.Server
+
+		return backend, nil
+	}
+
+	if mapping.LinearTeam != "" {
+		if cmd.Linear.Token == "" {
+			return nil, fmt.Errorf("--linear-token is required to sync %s", mapping)
+		}
+
+		linearURL := LinearDefaultURL
+		if cmd.Linear.APIURL != "" {
+			linearURL = cmd.Linear.APIURL
+		}
+
+		return NewLinearBackend(linearURL, mapping.LinearTeam, cmd.Linear.Token, linearClient), nil
+	}
+
+	if cmd.Tracker.Token == "" {
+		return nil, fmt.Errorf("--tracker-token is required to sync %s", mapping)
+	}
+
+	trackerURL := TrackerDefaultURL
+	if cmd.Tracker.APIURL != "" {
+		trackerURL = cmd.Tracker.APIURL
+	}
+
+	return NewTrackerBackend(trackerURL, mapping.TrackerProjectID, cmd.Tracker.Token, trackerClient), nil
+}
+
+func (cmd *TracksuitCommand) printPlan(plan *Plan) error {
+	switch cmd.PlanFormat {
+	case "json":
+		return plan.WriteJSON(os.Stdout)
+	default:
+		return plan.WriteText(os.Stdout)
+	}
+}
+
+// newParser returns the parser for the command line and TRACKSUIT_
+// environment variables, which runs subcommands as it parses them.
+func newParser(cmd *TracksuitCommand) *flags.Parser {
+	cmd.Serve.tracksuit = cmd
+	cmd.Status.tracksuit = cmd
 
 	parser := flags.NewParser(cmd, flags.Default)
 	parser.NamespaceDelimiter = "-"
+	parser.SubcommandsOptional = true
 
 	twentythousandtonnesofcrudeoil.TheEnvironmentIsPerfectlySafe(parser, "TRACKSUIT_")
 
+	return parser
+}
+
+func main() {
+	cmd := &TracksuitCommand{}
+
+	parser := newParser(cmd)
+
 	args, err := parser.Parse()
 	if err != nil {
 		os.Exit(1)
 	}
 
+	if parser.Active != nil {
+		// subcommand has already been executed by the parser
+		return
+	}
+
 	err = cmd.Execute(args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
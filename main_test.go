@@ -0,0 +1,223 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vito/tracksuit/fakes"
+)
+
+// routingTransport sends requests to the fake standing in for their host,
+// counting them by host.
+type routingTransport struct {
+	Fakes map[string]string
+
+	requests map[string]int
+	lock     sync.Mutex
+}
+
+func (transport *routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.lock.Lock()
+	if transport.requests == nil {
+		transport.requests = map[string]int{}
+	}
+	transport.requests[req.URL.Host]++
+	transport.lock.Unlock()
+
+	fake, found := transport.Fakes[req.URL.Host]
+	if !found {
+		return nil, &url.Error{Op: req.Method, URL: req.URL.String(), Err: http.ErrNotSupported}
+	}
+
+	target, err := url.Parse(fake)
+	if err != nil {
+		return nil, err
+	}
+
+	redirected := new(http.Request)
+	*redirected = *req
+
+	u := *req.URL
+	u.Scheme = target.Scheme
+	u.Host = target.Host
+	redirected.URL = &u
+	redirected.Host = target.Host
+
+	return http.DefaultTransport.RoundTrip(redirected)
+}
+
+func (transport *routingTransport) Requests(host string) int {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	return transport.requests[host]
+}
+
+func runCommand(t *testing.T, transport http.RoundTripper, args ...string) {
+	t.Helper()
+
+	cmd := &TracksuitCommand{Transport: transport}
+
+	rest, err := newParser(cmd).ParseArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Execute(rest); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+}
+
+func TestCommandSyncsThroughTheInjectedTransport(t *testing.T) {
+	gh := fakes.NewGitHub(testBotLogin)
+	defer gh.Close()
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	defer fakeTracker.Close()
+
+	gh.AddRepo(testOrganization, testRepo)
+	gh.AddIssue(testOrganization, testRepo, "something broke")
+
+	transport := &routingTransport{
+		Fakes: map[string]string{
+			"api.github.com":         gh.URL,
+			"www.pivotaltracker.com": fakeTracker.URL,
+		},
+	}
+
+	runCommand(t, transport,
+		"--github-token", "some-token",
+		"--github-organization-name", testOrganization,
+		"--tracker-token", "some-token",
+		"--tracker-project-id", "1234",
+	)
+
+	if stories := fakeTracker.Stories(); len(stories) != 1 {
+		t.Fatalf("expected a story to be created, got %d", len(stories))
+	}
+
+	for _, host := range []string{"api.github.com", "www.pivotaltracker.com"} {
+		if transport.Requests(host) == 0 {
+			t.Errorf("expected requests to %s to go through the transport", host)
+		}
+	}
+}
+
+func TestCommandSyncsWithTheTrackerAPIURL(t *testing.T) {
+	gh := fakes.NewGitHub(testBotLogin)
+	defer gh.Close()
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	defer fakeTracker.Close()
+
+	gh.AddRepo(testOrganization, testRepo)
+	gh.AddIssue(testOrganization, testRepo, "something broke")
+
+	transport := &routingTransport{
+		Fakes: map[string]string{
+			"api.github.com": gh.URL,
+		},
+	}
+
+	trackerURL, err := url.Parse(fakeTracker.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake is only reached through --tracker-api-url
+	transport.Fakes[trackerURL.Host] = fakeTracker.URL
+
+	runCommand(t, transport,
+		"--github-token", "some-token",
+		"--github-organization-name", testOrganization,
+		"--tracker-token", "some-token",
+		"--tracker-project-id", "1234",
+		"--tracker-api-url", fakeTracker.URL,
+	)
+
+	if stories := fakeTracker.Stories(); len(stories) != 1 {
+		t.Fatalf("expected a story to be created, got %d", len(stories))
+	}
+
+	if transport.Requests("www.pivotaltracker.com") != 0 {
+		t.Error("expected no requests to the default Tracker API")
+	}
+}
+
+// rateLimitedTransport responds to the first request to Host with a secondary
+// rate limit, sending the rest on to Base.
+type rateLimitedTransport struct {
+	Base http.RoundTripper
+	Host string
+
+	limited bool
+	lock    sync.Mutex
+}
+
+func (transport *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.lock.Lock()
+	limit := !transport.limited && req.URL.Host == transport.Host
+	transport.limited = transport.limited || limit
+	transport.lock.Unlock()
+
+	if limit {
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "429 Too Many Requests",
+			Header:     http.Header{"Retry-After": {"1"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"message":"slow down"}`)),
+			Request:    req,
+		}, nil
+	}
+
+	return transport.Base.RoundTrip(req)
+}
+
+func TestCommandWaitsOutGitHubRateLimits(t *testing.T) {
+	gh := fakes.NewGitHub(testBotLogin)
+	defer gh.Close()
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	defer fakeTracker.Close()
+
+	gh.AddRepo(testOrganization, testRepo)
+	gh.AddIssue(testOrganization, testRepo, "something broke")
+
+	routing := &routingTransport{
+		Fakes: map[string]string{
+			"api.github.com":         gh.URL,
+			"www.pivotaltracker.com": fakeTracker.URL,
+		},
+	}
+
+	transport := &rateLimitedTransport{
+		Base: routing,
+		Host: "api.github.com",
+	}
+
+	start := time.Now()
+
+	runCommand(t, transport,
+		"--github-token", "some-token",
+		"--github-organization-name", testOrganization,
+		"--github-retry-budget", "10s",
+		"--tracker-token", "some-token",
+		"--tracker-project-id", "1234",
+	)
+
+	if !transport.limited {
+		t.Fatal("expected a GitHub request to be rate limited")
+	}
+
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("expected the sync to wait out the rate limit, took %s", waited)
+	}
+
+	if stories := fakeTracker.Stories(); len(stories) != 1 {
+		t.Fatalf("expected a story to be created, got %d", len(stories))
+	}
+}
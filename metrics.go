@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	MetricStoriesCreated     = "tracksuit_stories_created_total"
+	MetricDupesDeleted       = "tracksuit_dupes_deleted_total"
+	MetricDupesFlagged       = "tracksuit_dupes_flagged_total"
+	MetricCommentsCreated    = "tracksuit_comments_created_total"
+	MetricCommentsUpdated    = "tracksuit_comments_updated_total"
+	MetricIssueLabelsAdded   = "tracksuit_issue_labels_added_total"
+	MetricIssueLabelsRemoved = "tracksuit_issue_labels_removed_total"
+	MetricIssuesClosed       = "tracksuit_issues_closed_total"
+	MetricOrphansFound       = "tracksuit_orphans_found_total"
+	MetricAPIRequests        = "tracksuit_api_requests_total"
+	MetricAPIErrors          = "tracksuit_api_errors_total"
+	MetricRepoSyncDuration   = "tracksuit_repo_sync_duration_seconds"
+)
+
+type metricInfo struct {
+	kind    string
+	help    string
+	summary string
+}
+
+var metricInfos = map[string]metricInfo{
+	MetricStoriesCreated:     {"counter", "Stories created for issues.", "stories created"},
+	MetricDupesDeleted:       {"counter", "Duplicate stories deleted.", "dupes deleted"},
+	MetricDupesFlagged:       {"counter", "Duplicate stories labelled for someone to clean up.", "dupes flagged"},
+	MetricCommentsCreated:    {"counter", "Comments created on issues.", "comments created"},
+	MetricCommentsUpdated:    {"counter", "Comments updated on issues.", "comments updated"},
+	MetricIssueLabelsAdded:   {"counter", "Labels added to issues.", "labels added"},
+	MetricIssueLabelsRemoved: {"counter", "Labels removed from issues.", "labels removed"},
+	MetricIssuesClosed:       {"counter", "Issues closed once all their stories were accepted.", "issues closed"},
+	MetricOrphansFound:       {"counter", "Stories found whose issue was closed by hand, moved, or deleted.", "orphans found"},
+	MetricAPIRequests:        {"counter", "Requests made to each API.", ""},
+	MetricAPIErrors:          {"counter", "Requests to each API that failed or returned an error status.", ""},
+	MetricRepoSyncDuration:   {"gauge", "How long the last sync of each repository took.", ""},
+}
+
+// summaryMetrics are listed in the summary printed after each sync, in order.
+var summaryMetrics = []string{
+	MetricStoriesCreated,
+	MetricDupesDeleted,
+	MetricDupesFlagged,
+	MetricCommentsCreated,
+	MetricCommentsUpdated,
+	MetricIssueLabelsAdded,
+	MetricIssueLabelsRemoved,
+	MetricIssuesClosed,
+	MetricOrphansFound,
+}
+
+type series struct {
+	name   string
+	labels string
+}
+
+// Metrics collects counters and gauges describing what syncing has done,
+// rendered in the Prometheus text format. A nil *Metrics discards
+// everything.
+type Metrics struct {
+	values map[series]float64
+	lock   sync.Mutex
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		values: map[series]float64{},
+	}
+}
+
+// Add increases a counter. Labels are given as name/value pairs.
+func (metrics *Metrics) Add(name string, delta float64, labels ...string) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	metrics.values[series{name, renderLabels(labels)}] += delta
+}
+
+// Set sets a gauge. Labels are given as name/value pairs.
+func (metrics *Metrics) Set(name string, value float64, labels ...string) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	metrics.values[series{name, renderLabels(labels)}] = value
+}
+
+func (metrics *Metrics) snapshot() map[series]float64 {
+	if metrics == nil {
+		return nil
+	}
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	values := map[series]float64{}
+	for s, v := range metrics.values {
+		values[s] = v
+	}
+
+	return values
+}
+
+// WriteTo writes every series in the Prometheus text format.
+func (metrics *Metrics) WriteTo(w io.Writer) (int64, error) {
+	values := metrics.snapshot()
+
+	var all []series
+	for s := range values {
+		all = append(all, s)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+
+		return all[i].labels < all[j].labels
+	})
+
+	buf := new(bytes.Buffer)
+
+	var last string
+	for _, s := range all {
+		if s.name != last {
+			info := metricInfos[s.name]
+			fmt.Fprintf(buf, "# HELP %s %s\n", s.name, info.help)
+			fmt.Fprintf(buf, "# TYPE %s %s\n", s.name, info.kind)
+			last = s.name
+		}
+
+		if s.labels == "" {
+			fmt.Fprintf(buf, "%s %g\n", s.name, values[s])
+		} else {
+			fmt.Fprintf(buf, "%s{%s} %g\n", s.name, s.labels, values[s])
+		}
+	}
+
+	return buf.WriteTo(w)
+}
+
+// WriteFile atomically writes the metrics to path, for node_exporter's
+// textfile collector.
+func (metrics *Metrics) WriteFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := metrics.WriteTo(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteTo(w)
+}
+
+// logSummary logs what changed for the given labels since the snapshot was
+// taken, as a table when logging text or as fields when logging JSON.
+func (metrics *Metrics) logSummary(logger *Logger, since map[series]float64, elapsed time.Duration, labels ...string) {
+	if metrics == nil {
+		return
+	}
+
+	values := metrics.snapshot()
+	rendered := renderLabels(labels)
+
+	elapsed = elapsed.Round(time.Millisecond)
+
+	if logger.Format() == LogFormatJSON {
+		fields := []interface{}{"duration", elapsed}
+		for _, name := range summaryMetrics {
+			s := series{name, rendered}
+			fields = append(fields, strings.Replace(metricInfos[name].summary, " ", "_", -1), values[s]-since[s])
+		}
+
+		logger.Info("sync summary", fields...)
+
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	table := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+
+	for _, name := range summaryMetrics {
+		s := series{name, rendered}
+		fmt.Fprintf(table, "  %s\t%g\n", metricInfos[name].summary, values[s]-since[s])
+	}
+
+	table.Flush()
+
+	logger.Info("sync summary", "duration", elapsed)
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		logger.Info(line)
+	}
+}
+
+func renderLabels(pairs []string) string {
+	var rendered []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		rendered = append(rendered, fmt.Sprintf(`%s="%s"`, pairs[i], value))
+	}
+
+	return strings.Join(rendered, ",")
+}
+
+// MetricsTransport counts the requests made to an API and how many of them
+// failed.
+type MetricsTransport struct {
+	Base http.RoundTripper
+
+	Metrics *Metrics
+	Backend string
+}
+
+func (transport *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.Metrics.Add(MetricAPIRequests, 1, "backend", transport.Backend)
+
+	resp, err := transport.Base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= 400 {
+		transport.Metrics.Add(MetricAPIErrors, 1, "backend", transport.Backend)
+	}
+
+	return resp, err
+}
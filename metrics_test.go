@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	metrics := NewMetrics()
+
+	metrics.Add(MetricStoriesCreated, 1, "organization", "some-org", "project", "1234")
+	metrics.Add(MetricStoriesCreated, 2, "organization", "some-org", "project", "1234")
+	metrics.Add(MetricStoriesCreated, 1, "organization", "other-org", "project", "1234")
+	metrics.Set(MetricRepoSyncDuration, 3, "repo", `some-org/"quoted"\repo`)
+	metrics.Set(MetricRepoSyncDuration, 1.5, "repo", `some-org/"quoted"\repo`)
+	metrics.Add(MetricAPIRequests, 1)
+
+	buf := new(bytes.Buffer)
+	if _, err := metrics.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP tracksuit_api_requests_total Requests made to each API.
+# TYPE tracksuit_api_requests_total counter
+tracksuit_api_requests_total 1
+# HELP tracksuit_repo_sync_duration_seconds How long the last sync of each repository took.
+# TYPE tracksuit_repo_sync_duration_seconds gauge
+tracksuit_repo_sync_duration_seconds{repo="some-org/\"quoted\"\\repo"} 1.5
+# HELP tracksuit_stories_created_total Stories created for issues.
+# TYPE tracksuit_stories_created_total counter
+tracksuit_stories_created_total{organization="other-org",project="1234"} 1
+tracksuit_stories_created_total{organization="some-org",project="1234"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestNilMetricsDiscardEverything(t *testing.T) {
+	var metrics *Metrics
+
+	metrics.Add(MetricStoriesCreated, 1)
+	metrics.Set(MetricRepoSyncDuration, 1)
+
+	buf := new(bytes.Buffer)
+	if _, err := metrics.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %q", buf.String())
+	}
+}
+
+func TestMetricsWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tracksuit.prom")
+
+	metrics := NewMetrics()
+	metrics.Add(MetricIssuesClosed, 1)
+
+	for i := 0; i < 2; i++ {
+		if err := metrics.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(contents), "\ntracksuit_issues_closed_total 1\n") {
+		t.Errorf("expected the counter to be written, got:\n%s", contents)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected writing to leave only the metrics file behind, got %d files", len(entries))
+	}
+}
+
+func TestMetricsTransportCountsRequestsAndErrors(t *testing.T) {
+	server := newFlakyServer(t, failFirst(http.StatusInternalServerError, nil))
+
+	metrics := NewMetrics()
+	transport := &MetricsTransport{
+		Base:    http.DefaultTransport,
+		Metrics: metrics,
+		Backend: "github",
+	}
+
+	for i := 0; i < 3; i++ {
+		roundTrip(t, transport, "GET", server.URL, nil)
+	}
+
+	values := metrics.snapshot()
+
+	if requests := values[series{MetricAPIRequests, `backend="github"`}]; requests != 3 {
+		t.Errorf("expected 3 requests to be counted, got %g", requests)
+	}
+
+	if errors := values[series{MetricAPIErrors, `backend="github"`}]; errors != 1 {
+		t.Errorf("expected 1 error to be counted, got %g", errors)
+	}
+}
+
+func TestSyncCountsChangesAndLogsASummary(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.Metrics = NewMetrics()
+
+	logs := new(bytes.Buffer)
+	fixture.Syncer.Logger = NewLogger(logs, LogFormatText, LogLevelInfo)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	labels := renderLabels(fixture.Syncer.metricLabels())
+	values := fixture.Syncer.Metrics.snapshot()
+
+	for name, expected := range map[string]float64{
+		MetricStoriesCreated:   1,
+		MetricCommentsCreated:  1,
+		MetricIssueLabelsAdded: 1,
+		MetricIssuesClosed:     0,
+	} {
+		if value := values[series{name, labels}]; value != expected {
+			t.Errorf("expected %s to be %g, got %g", name, expected, value)
+		}
+	}
+
+	if values[series{MetricRepoSyncDuration, `repo="` + testOrganization + "/" + testRepo + `"`}] <= 0 {
+		t.Error("expected the repository's sync duration to be recorded")
+	}
+
+	for _, line := range []string{"sync summary", "  stories created   1", "  comments created  1", "  labels added      1"} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("expected the summary to include %q, got:\n%s", line, logs.String())
+		}
+	}
+
+	// later summaries only cover what that sync changed
+	logs.Reset()
+	fixture.Syncer.Logger = NewLogger(logs, LogFormatJSON, LogLevelInfo)
+
+	fixture.sync(t)
+
+	var summary map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to decode %s: %s", line, err)
+		}
+
+		if entry["message"] == "sync summary" {
+			summary = entry
+		}
+	}
+
+	if summary == nil {
+		t.Fatalf("expected a summary to be logged, got:\n%s", logs.String())
+	}
+
+	if summary["stories_created"] != 0.0 || summary["comments_created"] != 0.0 || summary["duration"] == nil {
+		t.Errorf("expected an empty summary, got %+v", summary)
+	}
+}
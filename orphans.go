@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// OrphanPolicy determines what happens to stories whose issue was closed by
+// hand, transferred, or deleted. Syncing only walks open issues, so these
+// stories are otherwise never touched again.
+type OrphanPolicy string
+
+const (
+	// OrphanPolicyIgnore leaves orphaned stories alone without looking for
+	// them.
+	OrphanPolicyIgnore OrphanPolicy = "ignore"
+
+	// OrphanPolicyReport logs orphaned stories without changing them.
+	OrphanPolicyReport OrphanPolicy = "report"
+
+	// OrphanPolicyLabel labels orphaned stories with OrphanLabel.
+	OrphanPolicyLabel OrphanPolicy = "label"
+
+	// OrphanPolicyAccept accepts orphaned stories.
+	OrphanPolicyAccept OrphanPolicy = "accept"
+
+	// OrphanPolicyMove moves orphaned stories to OrphanState.
+	OrphanPolicyMove OrphanPolicy = "move"
+)
+
+const defaultOrphanLabel = "issue-closed"
+
+// reasons a story is orphaned, logged alongside it
+const (
+	orphanReasonClosed  = "closed"
+	orphanReasonMoved   = "moved"
+	orphanReasonDeleted = "deleted"
+)
+
+// ValidateOrphanPolicy checks the policy and, if given, the state orphaned
+// stories are moved to. Whether the move policy has a state to move to is
+// left to the caller, as it may come from elsewhere.
+func ValidateOrphanPolicy(policy OrphanPolicy, state tracker.StoryState) error {
+	switch policy {
+	case "", OrphanPolicyIgnore, OrphanPolicyReport, OrphanPolicyLabel, OrphanPolicyAccept, OrphanPolicyMove:
+	default:
+		return fmt.Errorf("unknown orphan policy '%s'", policy)
+	}
+
+	if state != "" && stateRank(state) == -1 {
+		return fmt.Errorf("unknown orphan state '%s'", state)
+	}
+
+	return nil
+}
+
+func (syncer *Syncer) orphanPolicy() OrphanPolicy {
+	if syncer.OrphanPolicy == "" {
+		return OrphanPolicyIgnore
+	}
+
+	return syncer.OrphanPolicy
+}
+
+func (syncer *Syncer) orphanLabel() string {
+	if syncer.OrphanLabel == "" {
+		return defaultOrphanLabel
+	}
+
+	return syncer.OrphanLabel
+}
+
+// reconcileOrphans looks up the issue behind every label linking a story to
+// an issue in the organization, and deals with the stories of those that were
+// closed, moved, or deleted according to the orphan policy. Stories linked to
+// another issue that's still open are left alone, as are accepted stories.
+//
+// Failures to look up an issue or handle a story are logged rather than
+// returned so that the rest still get handled; stories linked to an issue that
+// couldn't be looked up are left alone until the next full sync.
+func (syncer *Syncer) reconcileOrphans() {
+	if syncer.orphanPolicy() == OrphanPolicyIgnore {
+		return
+	}
+
+	syncer.allStoriesLock.RLock()
+	allStories := syncer.allStories
+	syncer.allStoriesLock.RUnlock()
+
+	storyLabels := map[int][]string{}
+	labelSet := map[string]bool{}
+
+	for _, story := range allStories {
+		if story.State == tracker.StoryStateAccepted {
+			continue
+		}
+
+		for _, label := range story.Labels {
+			host, owner, _, _, ok := parseIssueLabel(label.Name)
+			if !ok || host != syncer.Source.Host() || !inOrganization(owner, syncer.OrganizationName) {
+				continue
+			}
+
+			storyLabels[story.ID] = append(storyLabels[story.ID], label.Name)
+			labelSet[label.Name] = true
+		}
+	}
+
+	var labels []string
+	for label := range labelSet {
+		labels = append(labels, label)
+	}
+
+	sort.Strings(labels)
+
+	workers := newPool(syncer.Concurrency)
+
+	repos := &orphanRepos{source: syncer.Source, repos: map[string]*orphanRepo{}}
+
+	reasons := make([]string, len(labels))
+	workers.Each(len(labels), func(i int) error {
+		return workers.Run(func() error {
+			var err error
+			reasons[i], err = syncer.orphanReason(repos, labels[i])
+			if err != nil {
+				syncer.logger().Error("failed to look up issue; skipping its stories", err, "tracker_label", labels[i])
+			}
+
+			return nil
+		})
+	})
+
+	labelReasons := map[string]string{}
+	for i, label := range labels {
+		labelReasons[label] = reasons[i]
+	}
+
+	for _, story := range allStories {
+		issueLabels, found := storyLabels[story.ID]
+		if !found {
+			continue
+		}
+
+		orphaned := true
+		for _, label := range issueLabels {
+			if labelReasons[label] == "" {
+				orphaned = false
+				break
+			}
+		}
+
+		if !orphaned {
+			continue
+		}
+
+		syncer.handleOrphan(story, issueLabels[0], labelReasons[issueLabels[0]])
+	}
+}
+
+// orphanReason returns why the issue behind the label no longer has stories,
+// or nothing if it's still open. Issues in repositories that aren't synced
+// are never considered orphaned.
+func (syncer *Syncer) orphanReason(repos *orphanRepos, label string) (string, error) {
+	_, owner, name, number, _ := parseIssueLabel(label)
+
+	repo, reason, err := repos.get(owner, name)
+	if err != nil {
+		return "", err
+	}
+
+	if reason != "" {
+		return reason, nil
+	}
+
+	if !syncer.shouldSync(repo) {
+		return "", nil
+	}
+
+	issue, err := syncer.Source.Issue(repo, number)
+	if err != nil {
+		if isGone(err) {
+			return orphanReasonDeleted, nil
+		}
+
+		return "", err
+	}
+
+	if issue.HTMLURL != nil && !strings.Contains(strings.ToLower(*issue.HTMLURL), strings.ToLower("/"+owner+"/"+name+"/")) {
+		// transferred issues redirect to their new repository
+		return orphanReasonMoved, nil
+	}
+
+	if issue.State != nil && *issue.State == "closed" {
+		return orphanReasonClosed, nil
+	}
+
+	return "", nil
+}
+
+func (syncer *Syncer) handleOrphan(story Story, label string, reason string) {
+	logger := syncer.logger().With("story", story.ID, "tracker_label", label, "reason", reason)
+
+	switch syncer.orphanPolicy() {
+	case OrphanPolicyLabel:
+		if len((StorySet{story}).WithLabel(syncer.orphanLabel())) > 0 {
+			return
+		}
+
+		syncer.count(MetricOrphansFound)
+
+		logger.Info("labelling orphaned story", "label", syncer.orphanLabel())
+
+		if err := syncer.addStoryLabel(story, syncer.orphanLabel()); err != nil {
+			logger.Error("failed to label orphaned story", err)
+		}
+
+	case OrphanPolicyAccept:
+		syncer.count(MetricOrphansFound)
+		syncer.moveOrphan(logger, story, tracker.StoryStateAccepted)
+
+	case OrphanPolicyMove:
+		if story.State == syncer.OrphanState {
+			return
+		}
+
+		syncer.count(MetricOrphansFound)
+		syncer.moveOrphan(logger, story, syncer.OrphanState)
+
+	default:
+		syncer.count(MetricOrphansFound)
+
+		logger.Warn("orphaned story")
+	}
+}
+
+func (syncer *Syncer) moveOrphan(logger *Logger, story Story, state tracker.StoryState) {
+	logger.Info("moving orphaned story", "from", story.State, "to", state)
+
+	if _, err := syncer.setStoryState(story, state); err != nil {
+		logger.Error("failed to move orphaned story", err)
+	}
+}
+
+// orphanRepos looks up each repository once, however many of its issues have
+// stories.
+type orphanRepos struct {
+	source IssueSource
+
+	repos map[string]*orphanRepo
+	lock  sync.Mutex
+}
+
+type orphanRepo struct {
+	once sync.Once
+
+	repo   *Repository
+	reason string
+	err    error
+}
+
+// get returns the repository, or why its issues are orphaned if it was moved
+// or deleted.
+func (repos *orphanRepos) get(owner string, name string) (*Repository, string, error) {
+	key := strings.ToLower(owner + "/" + name)
+
+	repos.lock.Lock()
+	entry, found := repos.repos[key]
+	if !found {
+		entry = &orphanRepo{}
+		repos.repos[key] = entry
+	}
+	repos.lock.Unlock()
+
+	entry.once.Do(func() {
+		entry.repo, entry.err = repos.source.Repo(owner, name)
+		if entry.err != nil && isGone(entry.err) {
+			entry.reason, entry.err = orphanReasonDeleted, nil
+			return
+		}
+
+		if entry.err == nil && !strings.EqualFold(*entry.repo.Owner.Login+"/"+*entry.repo.Name, owner+"/"+name) {
+			// renamed and transferred repositories redirect to their new name
+			entry.reason = orphanReasonMoved
+		}
+	})
+
+	return entry.repo, entry.reason, entry.err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+// failingTransport responds with a server error to requests with the given
+// method and path, as a forge having trouble would.
+type failingTransport struct {
+	Method string
+	Path   string
+}
+
+func (transport failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == transport.Method && req.URL.Path == transport.Path {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Status:     "500 Internal Server Error",
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"message":"oops"}`)),
+			Request:    req,
+		}, nil
+	}
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSyncLabelsStoriesOfIssuesClosedByHand(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.OrphanPolicy = OrphanPolicyLabel
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	fixture.sync(t)
+
+	fixture.GitHub.SetIssueState(testOrganization, testRepo, 1, "closed")
+
+	fixture.sync(t)
+
+	if stories := fixture.Tracker.StoriesWithLabel(defaultOrphanLabel); len(stories) != 1 || stories[0].ID != fixture.stories(t, 1, 1)[0].ID {
+		t.Fatalf("expected only the story for #1 to be labelled, got %+v", stories)
+	}
+}
+
+func TestSyncAcceptsStoriesOfDeletedIssues(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.OrphanPolicy = OrphanPolicyAccept
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	fixture.GitHub.DeleteIssue(testOrganization, testRepo, 1)
+
+	fixture.sync(t)
+
+	if story := fixture.stories(t, 1, 1)[0]; story.State != tracker.StoryStateAccepted {
+		t.Fatalf("expected story to be accepted, got %s", story.State)
+	}
+}
+
+func TestSyncSkipsOrphansWhoseIssueCannotBeLookedUp(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.OrphanPolicy = OrphanPolicyAccept
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	fixture.GitHub.SetIssueState(testOrganization, testRepo, 1, "closed")
+
+	client := github.NewClient(&http.Client{
+		Transport: failingTransport{Method: "GET", Path: "/repos/" + testOrganization + "/" + testRepo + "/issues/1"},
+	})
+	client.BaseURL, _ = url.Parse(fixture.GitHub.URL + "/")
+
+	fixture.Syncer.Source = &GitHubSource{Client: client}
+	fixture.Syncer.State = &SyncState{Mappings: map[string]*MappingState{}}
+
+	fixture.sync(t)
+
+	if story := fixture.stories(t, 1, 1)[0]; story.State == tracker.StoryStateAccepted {
+		t.Fatal("expected story to be left alone")
+	}
+
+	if _, found := fixture.Syncer.State.ProjectVersion(fixture.Syncer.stateKey()); !found {
+		t.Fatal("expected the sync to be recorded")
+	}
+}
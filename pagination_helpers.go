@@ -2,23 +2,43 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/google/go-querystring/query"
 )
 
 var publicReposFilter = github.RepositoryListByOrgOptions{Type: "public"}
+var allReposFilter = github.RepositoryListByOrgOptions{Type: "all"}
 var openIssuesFilter = github.IssueListByRepoOptions{State: "open"}
+var openPullRequestsFilter = github.PullRequestListOptions{State: "open"}
+var closedPullRequestsFilter = github.PullRequestListOptions{State: "closed", Sort: "updated", Direction: "desc"}
+
+// githubInstallationPreview is the media type the installation API is served
+// under while in preview.
+const githubInstallationPreview = "application/vnd.github.machine-man-preview+json"
+
+func (source *GitHubSource) Repos(organization string, includePrivate bool) ([]*Repository, error) {
+	if source.InstallationRepos {
+		return source.installationRepos()
+	}
 
-func (syncer *Syncer) reposToSync() ([]*github.Repository, error) {
 	options := publicReposFilter
+	if includePrivate {
+		options = allReposFilter
+	}
 
-	var repos []*github.Repository
+	var repos []*Repository
 
 	for {
-		resources, resp, err := syncer.GithubClient.Repositories.ListByOrg(
-			context.TODO(),
-			syncer.OrganizationName,
+		// listed by hand to decode what go-github's Repository leaves out
+		var resources []*Repository
+		resp, err := source.get(
+			fmt.Sprintf("orgs/%s/repos", organization),
 			&options,
+			"",
+			&resources,
 		)
 		if err != nil {
 			return nil, err
@@ -28,11 +48,7 @@ func (syncer *Syncer) reposToSync() ([]*github.Repository, error) {
 			break
 		}
 
-		for _, repo := range resources {
-			if syncer.shouldSync(repo) {
-				repos = append(repos, repo)
-			}
-		}
+		repos = append(repos, resources...)
 
 		if resp.NextPage == 0 {
 			break
@@ -44,27 +60,49 @@ func (syncer *Syncer) reposToSync() ([]*github.Repository, error) {
 	return repos, nil
 }
 
-func (syncer *Syncer) shouldSync(repository *github.Repository) bool {
-	if len(syncer.Repositories) == 0 {
-		return true
-	}
+func (source *GitHubSource) installationRepos() ([]*Repository, error) {
+	options := &github.ListOptions{}
+
+	var repos []*Repository
 
-	for _, name := range syncer.Repositories {
-		if name == *repository.Name {
-			return true
+	for {
+		var resources struct {
+			Repositories []*Repository `json:"repositories"`
 		}
+		resp, err := source.get(
+			"installation/repositories",
+			options,
+			githubInstallationPreview,
+			&resources,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(resources.Repositories) == 0 {
+			break
+		}
+
+		repos = append(repos, resources.Repositories...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
 	}
 
-	return false
+	return repos, nil
 }
 
-func (syncer *Syncer) allIssues(repo *github.Repository) ([]*github.Issue, error) {
+func (source *GitHubSource) Issues(repo *Repository, since time.Time) ([]*github.Issue, error) {
 	options := openIssuesFilter
+	options.Since = since
 
 	var all []*github.Issue
 
 	for {
-		resources, resp, err := syncer.GithubClient.Issues.ListByRepo(
+		resources, resp, err := source.Client.Issues.ListByRepo(
 			context.TODO(),
 			*repo.Owner.Login,
 			*repo.Name,
@@ -90,20 +128,49 @@ func (syncer *Syncer) allIssues(repo *github.Repository) ([]*github.Issue, error
 	return all, nil
 }
 
-func (syncer *Syncer) allCommentsForIssue(
-	repo *github.Repository,
-	issue *github.Issue,
-) ([]*github.IssueComment, error) {
+func (source *GitHubSource) Labels(repo *Repository) ([]*github.Label, error) {
+	options := &github.ListOptions{}
+
+	var all []*github.Label
+
+	for {
+		resources, resp, err := source.Client.Issues.ListLabels(
+			context.TODO(),
+			*repo.Owner.Login,
+			*repo.Name,
+			options,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(resources) == 0 {
+			break
+		}
+
+		all = append(all, resources...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	return all, nil
+}
+
+func (source *GitHubSource) Comments(repo *Repository, number int) ([]*github.IssueComment, error) {
 	options := &github.IssueListCommentsOptions{}
 
 	var all []*github.IssueComment
 
 	for {
-		resources, resp, err := syncer.GithubClient.Issues.ListComments(
+		resources, resp, err := source.Client.Issues.ListComments(
 			context.TODO(),
 			*repo.Owner.Login,
 			*repo.Name,
-			*issue.Number,
+			number,
 			options,
 		)
 		if err != nil {
@@ -125,3 +192,105 @@ func (syncer *Syncer) allCommentsForIssue(
 
 	return all, nil
 }
+
+// PullRequests returns all open pull requests, along with any closed
+// since the given time.
+func (source *GitHubSource) PullRequests(repo *Repository, closedSince time.Time) ([]*PullRequest, error) {
+	var all []*PullRequest
+
+	for _, filter := range []github.PullRequestListOptions{openPullRequestsFilter, closedPullRequestsFilter} {
+		options := filter
+
+	pages:
+		for {
+			// listed by hand to decode what go-github's PullRequest leaves out
+			var resources []*PullRequest
+			resp, err := source.get(
+				fmt.Sprintf("repos/%s/%s/pulls", *repo.Owner.Login, *repo.Name),
+				&options,
+				"",
+				&resources,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, pr := range resources {
+				if *pr.State == "closed" && pr.UpdatedAt.Before(closedSince) {
+					// sorted by most recently updated, so the rest are older
+					break pages
+				}
+
+				all = append(all, pr)
+			}
+
+			if len(resources) == 0 || resp.NextPage == 0 {
+				break
+			}
+
+			options.ListOptions.Page = resp.NextPage
+		}
+	}
+
+	return all, nil
+}
+
+func (source *GitHubSource) PullRequestCommits(repo *Repository, number int) ([]*github.RepositoryCommit, error) {
+	options := &github.ListOptions{}
+
+	var all []*github.RepositoryCommit
+
+	for {
+		resources, resp, err := source.Client.PullRequests.ListCommits(
+			context.TODO(),
+			*repo.Owner.Login,
+			*repo.Name,
+			number,
+			options,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(resources) == 0 {
+			break
+		}
+
+		all = append(all, resources...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	return all, nil
+}
+
+// get fetches the resource at the given path, for types with fields
+// go-github leaves out. The options are encoded into the query, and accept
+// overrides the media type requested, if given.
+func (source *GitHubSource) get(path string, options interface{}, accept string, resource interface{}) (*github.Response, error) {
+	if options != nil {
+		values, err := query.Values(options)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(values) > 0 {
+			path += "?" + values.Encode()
+		}
+	}
+
+	req, err := source.Client.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	return source.Client.Do(context.TODO(), req, resource)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type ActionKind string
+
+const (
+	ActionCreateStory        ActionKind = "create-story"
+	ActionDeleteStory        ActionKind = "delete-story"
+	ActionUnscheduleStory    ActionKind = "unschedule-story"
+	ActionSetStoryType       ActionKind = "set-story-type"
+	ActionSetStoryName       ActionKind = "set-story-name"
+	ActionSetStoryState      ActionKind = "set-story-state"
+	ActionAddStoryLabel      ActionKind = "add-story-label"
+	ActionRemoveStoryLabel   ActionKind = "remove-story-label"
+	ActionDeliverStory       ActionKind = "deliver-story"
+	ActionCreateStoryComment ActionKind = "create-story-comment"
+	ActionDeleteTrackerLabel ActionKind = "delete-tracker-label"
+	ActionCreateRepoLabel    ActionKind = "create-repo-label"
+	ActionUpdateRepoLabel    ActionKind = "update-repo-label"
+	ActionCreateComment      ActionKind = "create-comment"
+	ActionEditComment        ActionKind = "edit-comment"
+	ActionAddIssueLabels     ActionKind = "add-issue-labels"
+	ActionRemoveIssueLabel   ActionKind = "remove-issue-label"
+	ActionCloseIssue         ActionKind = "close-issue"
+)
+
+// Action is a single mutation that would have been made against GitHub or
+// Tracker.
+type Action struct {
+	Kind   ActionKind `json:"kind"`
+	Target string     `json:"target"`
+	Detail string     `json:"detail,omitempty"`
+}
+
+// Plan collects the actions a dry run would have taken, in the order they
+// would have been taken.
+type Plan struct {
+	Actions []Action `json:"actions"`
+
+	lock sync.Mutex
+}
+
+func (plan *Plan) Record(kind ActionKind, target string, detail string) {
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+
+	plan.Actions = append(plan.Actions, Action{
+		Kind:   kind,
+		Target: target,
+		Detail: detail,
+	})
+}
+
+func (plan *Plan) WriteText(w io.Writer) error {
+	if len(plan.Actions) == 0 {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+
+	for _, action := range plan.Actions {
+		line := fmt.Sprintf("%-20s %s", action.Kind, action.Target)
+		if action.Detail != "" {
+			line += ": " + action.Detail
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (plan *Plan) WriteJSON(w io.Writer) error {
+	if plan.Actions == nil {
+		plan.Actions = []Action{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// recorded returns the plan's actions of the given kind.
+func recorded(plan *Plan, kind ActionKind) []Action {
+	var actions []Action
+	for _, action := range plan.Actions {
+		if action.Kind == kind {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions
+}
+
+func TestDryRunRecordsChangesWithoutMakingThem(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.Plan = &Plan{}
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	if stories := fixture.Tracker.Stories(); len(stories) != 0 {
+		t.Fatalf("expected no stories to be created, got %+v", stories)
+	}
+
+	if comments := fixture.botComments(1); len(comments) != 0 {
+		t.Fatalf("expected no comments to be created, got %+v", comments)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug)
+
+	label := issueLabel("", testOrganization, testRepo, 1)
+
+	// stories start out as chores, and are then given the issue's type
+	created := recorded(fixture.Syncer.Plan, ActionCreateStory)
+	if len(created) != 1 || created[0].Target != label || created[0].Detail != "chore 'something broke'" {
+		t.Errorf("expected the story to be planned, got %+v", created)
+	}
+
+	typed := recorded(fixture.Syncer.Plan, ActionSetStoryType)
+	if len(typed) != 1 || typed[0].Detail != string(tracker.StoryTypeBug) {
+		t.Errorf("expected the story type to be planned, got %+v", typed)
+	}
+
+	commented := recorded(fixture.Syncer.Plan, ActionCreateComment)
+	if len(commented) != 1 || commented[0].Target != label {
+		t.Errorf("expected the status comment to be planned, got %+v", commented)
+	}
+
+	labelled := recorded(fixture.Syncer.Plan, ActionAddIssueLabels)
+	if len(labelled) != 1 || labelled[0].Target != label || labelled[0].Detail != IssueLabelUnscheduled {
+		t.Errorf("expected the state label to be planned, got %+v", labelled)
+	}
+}
+
+func TestDryRunRecordsChangesToExistingStories(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+
+	fixture.Syncer.Plan = &Plan{}
+
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected the issue to be left open, got %s", state)
+	}
+
+	closed := recorded(fixture.Syncer.Plan, ActionCloseIssue)
+	if len(closed) != 1 || closed[0].Target != issueLabel("", testOrganization, testRepo, 1) {
+		t.Errorf("expected closing the issue to be planned, got %+v", closed)
+	}
+
+	if created := recorded(fixture.Syncer.Plan, ActionCreateStory); len(created) != 0 {
+		t.Errorf("expected no stories to be planned, got %+v", created)
+	}
+}
+
+func TestPlanWriteText(t *testing.T) {
+	plan := &Plan{}
+
+	buf := new(bytes.Buffer)
+	if err := plan.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "no changes\n" {
+		t.Errorf("unexpected output for an empty plan: %q", buf.String())
+	}
+
+	plan.Record(ActionCreateStory, "some-org/some-repo#1", "bug 'something broke'")
+	plan.Record(ActionCloseIssue, "some-org/some-repo#2", "")
+
+	buf.Reset()
+	if err := plan.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "create-story         some-org/some-repo#1: bug 'something broke'\n" +
+		"close-issue          some-org/some-repo#2\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPlanWriteJSON(t *testing.T) {
+	for _, actions := range [][]Action{
+		nil,
+		{{Kind: ActionDeleteStory, Target: "#1234", Detail: "duplicate of some-org/some-repo#1"}},
+	} {
+		plan := &Plan{}
+		for _, action := range actions {
+			plan.Record(action.Kind, action.Target, action.Detail)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := plan.WriteJSON(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded struct {
+			Actions []Action `json:"actions"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("failed to decode %s: %s", buf.String(), err)
+		}
+
+		if decoded.Actions == nil {
+			t.Errorf("expected actions to be a list, got %s", buf.String())
+		}
+
+		if len(decoded.Actions) != len(actions) || (len(actions) > 0 && decoded.Actions[0] != actions[0]) {
+			t.Errorf("expected %+v, got %+v", actions, decoded.Actions)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "sync"
+
+// pool bounds the number of goroutines making API calls at once.
+type pool struct {
+	slots chan struct{}
+}
+
+func newPool(size int) *pool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &pool{slots: make(chan struct{}, size)}
+}
+
+// Each calls fn for every index in [0, count) concurrently, blocking until
+// all have returned. Errors are returned in index order; nil errors are
+// omitted.
+//
+// Each does not occupy a slot itself; fn should wrap its API calls in Run.
+// This way fn may call Each again without starving the pool.
+func (p *pool) Each(count int, fn func(int) error) []error {
+	errs := make([]error, count)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	return failed
+}
+
+// Run calls fn once a slot is free.
+func (p *pool) Run(fn func() error) error {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	return fn()
+}
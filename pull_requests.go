@@ -0,0 +1,420 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+// matches GitHub's closing keywords, e.g. "Fixes #123" or "closes org/repo#123"
+var issueReferencePattern = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+(?:([\w.-]+)/([\w.-]+))?#(\d+)\b`)
+
+// matches Tracker's commit syntax, e.g. "[#12345]" or "[Finishes #12345 #67890]",
+// though not when it's the text of a markdown link; see parseReferences
+var storyReferencePattern = regexp.MustCompile(`\[(?:\w+\s+)?(#\d+(?:[\s,]+#\d+)*)\s*\]`)
+
+var storyIDPattern = regexp.MustCompile(`#(\d+)`)
+
+// LinkedPullRequest is a pull request that references issues or stories in
+// its title, body, or commit messages.
+type LinkedPullRequest struct {
+	Number int
+	Title  string
+	URL    string
+
+	Merged         bool
+	MergedAt       *time.Time
+	MergeCommitSHA string
+	MergeCommitURL string
+
+	Issues  []int
+	Stories []int
+}
+
+// PullRequestIndex is the set of linked pull requests in a repository.
+type PullRequestIndex []LinkedPullRequest
+
+// AnyMerged returns whether any of the pull requests have been merged.
+func (index PullRequestIndex) AnyMerged() bool {
+	for _, pr := range index {
+		if pr.Merged {
+			return true
+		}
+	}
+
+	return false
+}
+
+// For returns the pull requests that reference the issue or any of its
+// stories.
+func (index PullRequestIndex) For(issueNumber int, stories StorySet) PullRequestIndex {
+	var linked PullRequestIndex
+
+	for _, pr := range index {
+		if pr.references(issueNumber, stories) {
+			linked = append(linked, pr)
+		}
+	}
+
+	return linked
+}
+
+func (pr LinkedPullRequest) references(issueNumber int, stories StorySet) bool {
+	for _, number := range pr.Issues {
+		if number == issueNumber {
+			return true
+		}
+	}
+
+	for _, id := range pr.Stories {
+		for _, story := range stories {
+			if story.ID == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parseReferences finds the issues in the given repo and the stories that
+// some text refers to.
+func parseReferences(repo *Repository, text string) ([]int, []int) {
+	var issues []int
+	for _, match := range issueReferencePattern.FindAllStringSubmatch(text, -1) {
+		owner, name := match[1], match[2]
+		if owner != "" && !(strings.EqualFold(owner, *repo.Owner.Login) && strings.EqualFold(name, *repo.Name)) {
+			continue
+		}
+
+		number, err := strconv.Atoi(match[3])
+		if err != nil {
+			continue
+		}
+
+		issues = append(issues, number)
+	}
+
+	var stories []int
+	for _, match := range storyReferencePattern.FindAllStringSubmatchIndex(text, -1) {
+		// "[#12](https://...)" is a link, not a story reference
+		if end := match[1]; end < len(text) && text[end] == '(' {
+			continue
+		}
+
+		for _, idMatch := range storyIDPattern.FindAllStringSubmatch(text[match[2]:match[3]], -1) {
+			id, err := strconv.Atoi(idMatch[1])
+			if err != nil {
+				continue
+			}
+
+			stories = append(stories, id)
+		}
+	}
+
+	return issues, stories
+}
+
+// pullRequestCommits is the commit messages of a pull request as of when it
+// was last updated, which pushing to it changes.
+type pullRequestCommits struct {
+	UpdatedAt time.Time
+	Messages  []string
+}
+
+func (syncer *Syncer) indexPullRequests(repo *Repository) (PullRequestIndex, error) {
+	pulls, err := syncer.Source.PullRequests(repo, time.Now().Add(-syncer.PullRequestLookback))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %s", err)
+	}
+
+	key := *repo.Owner.Login + "/" + *repo.Name
+
+	syncer.pullRequestsLock.Lock()
+	cached := syncer.pullRequestCommits[key]
+	syncer.pullRequestsLock.Unlock()
+
+	// only the pull requests still listed are remembered
+	commits := map[int]pullRequestCommits{}
+
+	var index PullRequestIndex
+	for _, pr := range pulls {
+		prCommits, err := syncer.commitMessages(repo, pr, cached)
+		if err != nil {
+			return nil, err
+		}
+
+		commits[*pr.Number] = prCommits
+
+		linked := syncer.linkPullRequest(repo, pr, prCommits.Messages)
+		if len(linked.Issues) > 0 || len(linked.Stories) > 0 {
+			index = append(index, linked)
+		}
+	}
+
+	syncer.pullRequestsLock.Lock()
+	if syncer.pullRequestCommits == nil {
+		syncer.pullRequestCommits = map[string]map[int]pullRequestCommits{}
+	}
+	syncer.pullRequestCommits[key] = commits
+	syncer.pullRequestsLock.Unlock()
+
+	return index, nil
+}
+
+// commitMessages lists the messages of a pull request's commits, unless
+// they're cached and the pull request hasn't been updated since.
+func (syncer *Syncer) commitMessages(repo *Repository, pr *PullRequest, cached map[int]pullRequestCommits) (pullRequestCommits, error) {
+	if prCommits, found := cached[*pr.Number]; found && pr.UpdatedAt != nil && prCommits.UpdatedAt.Equal(*pr.UpdatedAt) {
+		return prCommits, nil
+	}
+
+	commits, err := syncer.Source.PullRequestCommits(repo, *pr.Number)
+	if err != nil {
+		return pullRequestCommits{}, fmt.Errorf("failed to list commits for #%d: %s", *pr.Number, err)
+	}
+
+	var prCommits pullRequestCommits
+	if pr.UpdatedAt != nil {
+		prCommits.UpdatedAt = *pr.UpdatedAt
+	}
+
+	for _, commit := range commits {
+		if commit.Commit != nil && commit.Commit.Message != nil {
+			prCommits.Messages = append(prCommits.Messages, *commit.Commit.Message)
+		}
+	}
+
+	return prCommits, nil
+}
+
+func (syncer *Syncer) linkPullRequest(repo *Repository, pr *PullRequest, commitMessages []string) LinkedPullRequest {
+	texts := []string{*pr.Title}
+	if pr.Body != nil {
+		texts = append(texts, *pr.Body)
+	}
+
+	texts = append(texts, commitMessages...)
+
+	linked := LinkedPullRequest{
+		Number:   *pr.Number,
+		Title:    *pr.Title,
+		URL:      *pr.HTMLURL,
+		MergedAt: pr.MergedAt,
+		Merged:   pr.MergedAt != nil,
+	}
+
+	if pr.MergeCommitSHA != nil && linked.Merged {
+		linked.MergeCommitSHA = *pr.MergeCommitSHA
+
+		repoURL := strings.TrimSuffix(*pr.HTMLURL, fmt.Sprintf("/pull/%d", *pr.Number))
+		if repo.HTMLURL != nil {
+			repoURL = *repo.HTMLURL
+		}
+
+		linked.MergeCommitURL = repoURL + "/commit/" + linked.MergeCommitSHA
+	}
+
+	seenIssues := map[int]bool{}
+	seenStories := map[int]bool{}
+	for _, text := range texts {
+		issues, stories := parseReferences(repo, text)
+
+		for _, number := range issues {
+			if !seenIssues[number] {
+				seenIssues[number] = true
+				linked.Issues = append(linked.Issues, number)
+			}
+		}
+
+		for _, id := range stories {
+			if !seenStories[id] {
+				seenStories[id] = true
+				linked.Stories = append(linked.Stories, id)
+			}
+		}
+	}
+
+	return linked
+}
+
+// syncPullRequests indexes the repo's pull requests and delivers the stories
+// of any that have merged.
+func (syncer *Syncer) syncPullRequests(repo *Repository) error {
+	index, err := syncer.loadPullRequests(repo)
+	if err != nil {
+		return err
+	}
+
+	return syncer.deliverMergedStories(repo, index)
+}
+
+// loadPullRequests indexes the repo's pull requests, remembering them for
+// linkedPullRequests.
+func (syncer *Syncer) loadPullRequests(repo *Repository) (PullRequestIndex, error) {
+	index, err := syncer.indexPullRequests(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	syncer.pullRequestsLock.Lock()
+	if syncer.pullRequests == nil {
+		syncer.pullRequests = map[string]PullRequestIndex{}
+	}
+	syncer.pullRequests[*repo.Owner.Login+"/"+*repo.Name] = index
+	syncer.pullRequestsLock.Unlock()
+
+	return index, nil
+}
+
+func (syncer *Syncer) linkedPullRequests(repo *Repository, issue *github.Issue, stories StorySet) PullRequestIndex {
+	if !syncer.LinkPullRequests {
+		return nil
+	}
+
+	syncer.pullRequestsLock.Lock()
+	defer syncer.pullRequestsLock.Unlock()
+
+	return syncer.pullRequests[*repo.Owner.Login+"/"+*repo.Name].For(*issue.Number, stories)
+}
+
+// deliverMergedStories delivers finished stories that are referenced by a
+// merged pull request, either directly or through an issue.
+//
+// Only stories that were last updated before the merge are delivered, so
+// that stories restarted after being rejected are left alone.
+func (syncer *Syncer) deliverMergedStories(repo *Repository, index PullRequestIndex) error {
+	for _, pr := range index {
+		if !pr.Merged {
+			continue
+		}
+
+		seen := map[int]bool{}
+		var storyIDs []int
+		for _, id := range pr.Stories {
+			if !seen[id] {
+				seen[id] = true
+				storyIDs = append(storyIDs, id)
+			}
+		}
+
+		stories := syncer.referencedStories(repo, pr, storyIDs)
+
+		for _, number := range pr.Issues {
+			label := issueLabel(syncer.Source.Host(), *repo.Owner.Login, *repo.Name, number)
+
+			issueStories, err := syncer.Backend.StoriesWithLabel(label)
+			if err != nil {
+				return fmt.Errorf("failed to fetch stories for %s: %s", label, err)
+			}
+
+			stories = append(stories, issueStories...)
+		}
+
+		for _, story := range stories {
+			if story.State != tracker.StoryStateFinished {
+				continue
+			}
+
+			if story.UpdatedAt != nil && story.UpdatedAt.After(*pr.MergedAt) {
+				continue
+			}
+
+			if err := syncer.deliverStory(repo, story, pr); err != nil {
+				return fmt.Errorf("failed to deliver #%d: %s", story.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// referencedStories fetches the stories a pull request refers to. References
+// to stories that can't be found, e.g. ones that were deleted or belong to
+// another project, are logged and skipped.
+func (syncer *Syncer) referencedStories(repo *Repository, pr LinkedPullRequest, ids []int) StorySet {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	logger := syncer.repoLogger(repo)
+
+	failed := map[int]bool{}
+
+	stories, err := syncer.Backend.StoriesByID(ids)
+	if err != nil {
+		// some backends fail the whole lookup if any of the stories are
+		// missing, so fall back to fetching them one at a time
+		stories = nil
+		for _, id := range ids {
+			story, err := syncer.Backend.StoriesByID([]int{id})
+			if err != nil {
+				logger.Warn("failed to fetch referenced story", "pull_request", pr.Number, "story", id, "error", err)
+				failed[id] = true
+				continue
+			}
+
+			stories = append(stories, story...)
+		}
+	}
+
+	found := map[int]bool{}
+	for _, story := range stories {
+		found[story.ID] = true
+	}
+
+	for _, id := range ids {
+		if !found[id] && !failed[id] {
+			logger.Info("skipping referenced story that does not exist", "pull_request", pr.Number, "story", id)
+		}
+	}
+
+	return stories
+}
+
+func (syncer *Syncer) deliverStory(repo *Repository, story Story, pr LinkedPullRequest) error {
+	comment := fmt.Sprintf(
+		"Delivered by merging [%s/%s#%d](%s)",
+		*repo.Owner.Login,
+		*repo.Name,
+		pr.Number,
+		pr.URL,
+	)
+
+	if pr.MergeCommitSHA != "" {
+		comment += fmt.Sprintf(" in [%.7s](%s)", pr.MergeCommitSHA, pr.MergeCommitURL)
+	}
+
+	syncer.repoLogger(repo).Info("delivering story for merged pull request", "story", story.ID, "pull_request", pr.Number)
+
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionDeliverStory, fmt.Sprintf("#%d", story.ID), comment)
+		return nil
+	}
+
+	delivered, err := syncer.Backend.DeliverStoryWithComment(story.ID, comment)
+	if err != nil {
+		return err
+	}
+
+	syncer.replaceStory(delivered)
+
+	return nil
+}
+
+// replaceStory updates the cached copy of a story after changing it.
+func (syncer *Syncer) replaceStory(updated Story) {
+	syncer.allStoriesLock.Lock()
+	defer syncer.allStoriesLock.Unlock()
+
+	for i, story := range syncer.allStories {
+		if story.ID == updated.ID {
+			syncer.allStories[i] = updated
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+func TestParseReferencesFindsIssuesAndStories(t *testing.T) {
+	owner, name := testOrganization, testRepo
+	repo := &Repository{Repository: github.Repository{
+		Owner: &github.User{Login: &owner},
+		Name:  &name,
+	}}
+
+	issues, stories := parseReferences(repo, strings.Join([]string{
+		"Fixes #1, closes some-org/some-repo#2, and resolves other-org/other-repo#3.",
+		"[#12] [Finishes #34 #56] [#78, #90]",
+		"See [#100](https://example.com/100) and [Delivers #200](https://example.com/200).",
+	}, "\n"))
+
+	if !intsEqual(issues, []int{1, 2}) {
+		t.Errorf("expected issues [1 2], got %v", issues)
+	}
+
+	if !intsEqual(stories, []int{12, 34, 56, 78, 90}) {
+		t.Errorf("expected stories [12 34 56 78 90] without the links, got %v", stories)
+	}
+}
+
+func TestSyncDeliversStoriesOfMergedPullRequests(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.LinkPullRequests = true
+	fixture.Syncer.PullRequestLookback = time.Hour
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	fixture.sync(t)
+
+	byIssue := fixture.stories(t, 1, 1)[0]
+	byStory := fixture.stories(t, 2, 1)[0]
+
+	fixture.Tracker.SetStoryState(byIssue.ID, tracker.StoryStateFinished)
+	fixture.Tracker.SetStoryState(byStory.ID, tracker.StoryStateFinished)
+
+	// #1's story is delivered through the issue, and #2's is referenced directly
+	pr := fixture.GitHub.AddPullRequest(testOrganization, testRepo, "fix it", "Fixes #1", "fix the other thing\n\n[Finishes #"+strconv.Itoa(byStory.ID)+"]")
+
+	time.Sleep(10 * time.Millisecond)
+	fixture.GitHub.MergePullRequest(testOrganization, testRepo, *pr.Number, "0123456789abcdef")
+
+	fixture.sync(t)
+
+	for number := 1; number <= 2; number++ {
+		story := fixture.stories(t, number, 1)[0]
+		if story.State != tracker.StoryStateDelivered {
+			t.Fatalf("expected the story for #%d to be delivered, got %s", number, story.State)
+		}
+
+		comments := fixture.Tracker.Comments(story.ID)
+		if len(comments) != 1 {
+			t.Fatalf("expected a delivery comment on #%d, got %+v", story.ID, comments)
+		}
+
+		expected := "in [0123456](https://github.com/some-org/some-repo/commit/0123456789abcdef)"
+		if !strings.Contains(comments[0].Text, expected) {
+			t.Errorf("expected the delivery comment to link to the merge commit, got:\n%s", comments[0].Text)
+		}
+	}
+}
+
+func TestSyncSkipsStoriesThatCannotBeFound(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.LinkPullRequests = true
+	fixture.Syncer.PullRequestLookback = time.Hour
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateFinished)
+
+	pr := fixture.GitHub.AddPullRequest(testOrganization, testRepo, "fix it", "[Finishes #99999 #"+strconv.Itoa(story.ID)+"]")
+
+	time.Sleep(10 * time.Millisecond)
+	fixture.GitHub.MergePullRequest(testOrganization, testRepo, *pr.Number, "0123456789abcdef")
+
+	fixture.sync(t)
+
+	if delivered := fixture.stories(t, 1, 1)[0]; delivered.State != tracker.StoryStateDelivered {
+		t.Errorf("expected the story that exists to be delivered, got %s", delivered.State)
+	}
+}
+
+func TestJiraSyncSkipsIssuesThatCannotBeFound(t *testing.T) {
+	fixture := newJiraFixture(t)
+	fixture.Syncer.LinkPullRequests = true
+	fixture.Syncer.PullRequestLookback = time.Hour
+
+	issue := fixture.Jira.AddIssue("something broke", "Bug")
+
+	pr := fixture.GitHub.AddPullRequest(testOrganization, testRepo, "fix it", "[Finishes #99999 #"+issue.ID+"]")
+	fixture.GitHub.MergePullRequest(testOrganization, testRepo, *pr.Number, "0123456789abcdef")
+
+	// Jira fails searches for IDs that don't exist
+	fixture.sync(t)
+}
+
+func TestSyncListsPullRequestCommitsOnlyOnceUpdated(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.LinkPullRequests = true
+	fixture.Syncer.PullRequestLookback = time.Hour
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	pr := fixture.GitHub.AddPullRequest(testOrganization, testRepo, "fix it", "", "Fixes #1")
+
+	fixture.sync(t)
+	fixture.sync(t)
+
+	if listings := fixture.GitHub.CommitListings(testOrganization, testRepo, *pr.Number); listings != 1 {
+		t.Fatalf("expected the commits to be listed once until the pull request changes, got %d", listings)
+	}
+
+	fixture.GitHub.PushCommits(testOrganization, testRepo, *pr.Number, "Fixes #2")
+
+	fixture.sync(t)
+
+	if listings := fixture.GitHub.CommitListings(testOrganization, testRepo, *pr.Number); listings != 2 {
+		t.Fatalf("expected the commits to be listed again once pushed to, got %d", listings)
+	}
+
+	index := fixture.Syncer.pullRequests[testOrganization+"/"+testRepo]
+	if len(index) != 1 || !intsEqual(index[0].Issues, []int{1, 2}) {
+		t.Errorf("expected the pull request to reference both issues, got %+v", index)
+	}
+}
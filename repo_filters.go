@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const topicPatternPrefix = "topic:"
+
+// ValidateRepoPatterns checks that each pattern is either a valid glob or a
+// topic.
+func ValidateRepoPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, topicPatternPrefix) {
+			if pattern == topicPatternPrefix {
+				return fmt.Errorf("missing topic in repository pattern '%s'", pattern)
+			}
+
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern '%s': %s", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func (syncer *Syncer) shouldSync(repository *Repository) bool {
+	if !inOrganization(*repository.Owner.Login, syncer.OrganizationName) {
+		return false
+	}
+
+	if isTrue(repository.Private) && !syncer.IncludePrivate {
+		return false
+	}
+
+	if isTrue(repository.Archived) && syncer.SkipArchived {
+		return false
+	}
+
+	if isTrue(repository.Fork) && syncer.SkipForks {
+		return false
+	}
+
+	if repoMatches(repository, syncer.ExcludeRepositories) {
+		return false
+	}
+
+	return len(syncer.Repositories) == 0 || repoMatches(repository, syncer.Repositories)
+}
+
+// inOrganization returns whether the owner is the organization or, as with
+// GitLab subgroups, is nested under it.
+func inOrganization(owner string, organization string) bool {
+	return strings.EqualFold(owner, organization) ||
+		strings.HasPrefix(strings.ToLower(owner), strings.ToLower(organization)+"/")
+}
+
+// repoMatches returns whether the repository matches any of the patterns,
+// which are either globs matched against its name (e.g. "concourse-*") or
+// topics it is tagged with (e.g. "topic:tracksuit").
+func repoMatches(repo *Repository, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, topicPatternPrefix) {
+			topic := strings.TrimPrefix(pattern, topicPatternPrefix)
+
+			for _, repoTopic := range repo.Topics {
+				if strings.EqualFold(repoTopic, topic) {
+					return true
+				}
+			}
+
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, *repo.Name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
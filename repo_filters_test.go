@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vito/tracksuit/fakes"
+)
+
+func TestValidateRepoPatterns(t *testing.T) {
+	if err := ValidateRepoPatterns([]string{"concourse-*", "some-repo", "topic:tracksuit"}); err != nil {
+		t.Errorf("expected globs and topics to be valid, got %s", err)
+	}
+
+	for _, pattern := range []string{"concourse-[", "topic:"} {
+		if err := ValidateRepoPatterns([]string{"some-repo", pattern}); err == nil {
+			t.Errorf("expected %q to be rejected", pattern)
+		}
+	}
+}
+
+func TestSyncFiltersRepositories(t *testing.T) {
+	filteredRepos := []string{"concourse-web", "concourse-archived", "concourse-fork", "tagged", "private"}
+
+	for _, example := range []struct {
+		name   string
+		syncer func(*Syncer)
+		synced []string
+	}{
+		{
+			name:   "defaults",
+			syncer: func(*Syncer) {},
+			synced: []string{"concourse-web", "concourse-archived", "concourse-fork", "tagged"},
+		},
+		{
+			name: "skipping archived repositories and forks",
+			syncer: func(syncer *Syncer) {
+				syncer.SkipArchived = true
+				syncer.SkipForks = true
+			},
+			synced: []string{"concourse-web", "tagged"},
+		},
+		{
+			name: "including private repositories",
+			syncer: func(syncer *Syncer) {
+				syncer.IncludePrivate = true
+			},
+			synced: []string{"concourse-web", "concourse-archived", "concourse-fork", "tagged", "private"},
+		},
+		{
+			name: "including patterns and topics",
+			syncer: func(syncer *Syncer) {
+				syncer.Repositories = []string{"concourse-*", "topic:TRACKSUIT"}
+				syncer.ExcludeRepositories = []string{"concourse-fork"}
+			},
+			synced: []string{"concourse-web", "concourse-archived", "tagged"},
+		},
+		{
+			name: "excluding topics",
+			syncer: func(syncer *Syncer) {
+				syncer.ExcludeRepositories = []string{"topic:tracksuit"}
+			},
+			synced: []string{"concourse-web", "concourse-archived", "concourse-fork"},
+		},
+	} {
+		t.Run(example.name, func(t *testing.T) {
+			fixture := newSyncFixture(t)
+
+			for _, name := range filteredRepos {
+				fixture.GitHub.AddRepo(testOrganization, name)
+				fixture.GitHub.AddIssue(testOrganization, name, "something broke")
+			}
+
+			fixture.GitHub.UpdateRepo(testOrganization, "concourse-archived", func(repo *fakes.GitHubRepository) {
+				archived := true
+				repo.Archived = &archived
+			})
+
+			fixture.GitHub.UpdateRepo(testOrganization, "concourse-fork", func(repo *fakes.GitHubRepository) {
+				fork := true
+				repo.Fork = &fork
+			})
+
+			fixture.GitHub.UpdateRepo(testOrganization, "tagged", func(repo *fakes.GitHubRepository) {
+				repo.Topics = []string{"ci", "tracksuit"}
+			})
+
+			fixture.GitHub.UpdateRepo(testOrganization, "private", func(repo *fakes.GitHubRepository) {
+				private := true
+				repo.Private = &private
+			})
+
+			example.syncer(fixture.Syncer)
+
+			fixture.sync(t)
+
+			synced := map[string]bool{}
+			for _, name := range example.synced {
+				synced[name] = true
+			}
+
+			// the fixture's own repository has no issues, so it's left out
+			for _, name := range filteredRepos {
+				stories := fixture.Tracker.StoriesWithLabel(issueLabel("", testOrganization, name, 1))
+
+				if synced[name] && len(stories) != 1 {
+					t.Errorf("expected %s to be synced, got %d stories", name, len(stories))
+				}
+
+				if !synced[name] && len(stories) != 0 {
+					t.Errorf("expected %s to be skipped, got %d stories", name, len(stories))
+				}
+			}
+		})
+	}
+}
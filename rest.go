@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// StatusError is a response other than 2xx.
+type StatusError struct {
+	// API names the API that responded, if known.
+	API string
+
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (err *StatusError) Error() string {
+	message := fmt.Sprintf("%s %s: %s: %s", err.Method, err.Path, err.Status, err.Body)
+	if err.API != "" {
+		message = err.API + ": " + message
+	}
+
+	return message
+}
+
+// requestJSON sends a request with an optional JSON body and decodes the JSON
+// response into result, if given. Responses other than 2xx are returned as a
+// *StatusError.
+func requestJSON(
+	client *http.Client,
+	method string,
+	url string,
+	header http.Header,
+	body interface{},
+	result interface{},
+) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		payload, _ := ioutil.ReadAll(resp.Body)
+		return resp, &StatusError{
+			Method:     method,
+			Path:       req.URL.Path,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(payload)),
+		}
+	}
+
+	if result == nil {
+		return resp, nil
+	}
+
+	return resp, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// restAPI is a JSON API served under a base URL, shared by the sources and
+// backends that talk to one.
+type restAPI struct {
+	// Name prefixes errors, e.g. "gitlab".
+	Name string
+
+	BaseURL string
+
+	// Header is sent with every request, e.g. to authenticate.
+	Header http.Header
+
+	Client *http.Client
+}
+
+// request sends a request to the path under the base URL. Errors are prefixed
+// with the API's name; responses other than 2xx are still a *StatusError.
+func (api restAPI) request(method string, path string, query url.Values, body interface{}, result interface{}) error {
+	reqURL := api.BaseURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	_, err := requestJSON(api.Client, method, reqURL, api.Header, body, result)
+	if err != nil {
+		if statusErr, ok := err.(*StatusError); ok {
+			statusErr.API = api.Name
+			return statusErr
+		}
+
+		return fmt.Errorf("%s: %s", api.Name, err)
+	}
+
+	return nil
+}
+
+// paginate fetches every page at the given path, numbering pages from 1 and
+// asking for pageSize results with the sizeParam query parameter. Each page
+// is decoded into a value returned by newPage and handed to collect, which
+// returns the number of results on the page; a short page is the last.
+func (api restAPI) paginate(
+	path string,
+	query url.Values,
+	sizeParam string,
+	pageSize int,
+	newPage func() interface{},
+	collect func(interface{}) int,
+) error {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+
+	pageQuery.Set(sizeParam, strconv.Itoa(pageSize))
+
+	for page := 1; ; page++ {
+		pageQuery.Set("page", strconv.Itoa(page))
+
+		result := newPage()
+		if err := api.request("GET", path, pageQuery, nil, result); err != nil {
+			return err
+		}
+
+		if collect(result) < pageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ServeCommand struct {
+	ListenAddress string `long:"listen-address" default:":8080" description:"Address to listen on for webhook deliveries"`
+
+	GitHubWebhookSecret string `long:"github-webhook-secret" required:"true" description:"Secret configured on the GitHub webhook, used to verify deliveries"`
+
+	TrackerWebhookToken string `long:"tracker-webhook-token" description:"Token that Tracker webhook deliveries must pass as the 'token' query parameter. Tracker webhooks are not accepted without it."`
+
+	ReconcileInterval time.Duration `long:"reconcile-interval" default:"1h" description:"Interval at which to run a full sync to catch anything missed by webhooks. Set to 0 to disable."`
+
+	tracksuit *TracksuitCommand
+}
+
+func (cmd *ServeCommand) Execute(argv []string) error {
+	if cmd.tracksuit.DryRun {
+		return errors.New("--dry-run is not supported when serving")
+	}
+
+	mappingSyncers, err := cmd.tracksuit.newSyncers(nil)
+	if err != nil {
+		return err
+	}
+
+	var syncers, githubSyncers []*Syncer
+	for _, ms := range mappingSyncers {
+		syncers = append(syncers, ms.Syncer)
+
+		if ms.Mapping.GitHubOrganization != "" {
+			githubSyncers = append(githubSyncers, ms.Syncer)
+		}
+	}
+
+	// webhook work and reconciliation take turns so that they don't race to
+	// create stories for the same issue
+	lock := &sync.Mutex{}
+
+	if cmd.ReconcileInterval != 0 {
+		go cmd.reconcile(mappingSyncers, lock)
+	}
+
+	queue := NewWorkQueue(lock, cmd.tracksuit.logger)
+	go queue.Run()
+
+	http.Handle("/github", &GitHubWebhookHandler{
+		Syncers: githubSyncers,
+		Secret:  []byte(cmd.GitHubWebhookSecret),
+		Queue:   queue,
+		Logger:  cmd.tracksuit.logger,
+	})
+
+	// Tracker doesn't sign its deliveries, so they're only accepted with a
+	// token to check them against
+	if cmd.TrackerWebhookToken != "" {
+		http.Handle("/tracker", &TrackerWebhookHandler{
+			Syncers: syncers,
+			Token:   cmd.TrackerWebhookToken,
+			Queue:   queue,
+			Logger:  cmd.tracksuit.logger,
+		})
+	} else {
+		cmd.tracksuit.logger.Info("not accepting tracker webhooks without --tracker-webhook-token")
+	}
+
+	http.Handle("/metrics", cmd.tracksuit.metrics)
+
+	cmd.tracksuit.logger.Info("listening", "address", cmd.ListenAddress)
+
+	return http.ListenAndServe(cmd.ListenAddress, nil)
+}
+
+func (cmd *ServeCommand) reconcile(syncers []mappingSyncer, lock *sync.Mutex) {
+	for {
+		lock.Lock()
+
+		cmd.tracksuit.logger.Info("reconciling")
+
+		if err := cmd.tracksuit.sync(syncers); err != nil {
+			cmd.tracksuit.logger.Error("reconciling failed", err)
+		}
+
+		lock.Unlock()
+
+		time.Sleep(cmd.ReconcileInterval)
+	}
+}
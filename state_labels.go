@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// StateAggregation decides which story's state is reflected on an issue with
+// more than one story.
+type StateAggregation string
+
+const (
+	// AggregateAnyInProgress reflects the most advanced story that has not
+	// been accepted, so an issue is in-flight if any of its stories are.
+	AggregateAnyInProgress StateAggregation = "any-in-progress"
+
+	// AggregateLeastAdvanced reflects the least advanced story that has not
+	// been accepted, so an issue only moves along once all its stories do.
+	AggregateLeastAdvanced StateAggregation = "least-advanced"
+)
+
+// StoryStateUnstarted is the state of stories in the backlog, which
+// go-tracker doesn't name.
+const StoryStateUnstarted tracker.StoryState = "unstarted"
+
+// storyStateOrder lists the story states from least to most advanced.
+var storyStateOrder = []tracker.StoryState{
+	tracker.StoryStateUnscheduled,
+	StoryStateUnstarted,
+	tracker.StoryStatePlanned,
+	tracker.StoryStateStarted,
+	tracker.StoryStateRejected,
+	tracker.StoryStateFinished,
+	tracker.StoryStateDelivered,
+	tracker.StoryStateAccepted,
+}
+
+// defaultStateLabelColor is used for state labels that aren't given a color
+// with --label.
+const defaultStateLabelColor = "ededed"
+
+// StateLabels maps story states to the label put on their issues. States
+// without a label (by default, only accepted) leave the issue unlabelled.
+type StateLabels struct {
+	Labels map[tracker.StoryState]string
+
+	Aggregation StateAggregation
+}
+
+var defaultStateLabels = StateLabels{
+	Labels: map[tracker.StoryState]string{
+		tracker.StoryStateUnscheduled: IssueLabelUnscheduled,
+		StoryStateUnstarted:           IssueLabelScheduled,
+		tracker.StoryStatePlanned:     IssueLabelScheduled,
+		tracker.StoryStateStarted:     IssueLabelInFlight,
+		tracker.StoryStateFinished:    IssueLabelInFlight,
+		tracker.StoryStateDelivered:   IssueLabelInFlight,
+		tracker.StoryStateRejected:    IssueLabelInFlight,
+	},
+
+	Aggregation: AggregateAnyInProgress,
+}
+
+// ValidateStateLabels checks that each state and the aggregation are known.
+func ValidateStateLabels(labels map[tracker.StoryState]string, aggregation StateAggregation) error {
+	for state, label := range labels {
+		if stateRank(state) == -1 {
+			return fmt.Errorf("unknown story state '%s'", state)
+		}
+
+		if label == "" {
+			return fmt.Errorf("missing label for story state '%s'", state)
+		}
+	}
+
+	switch aggregation {
+	case "", AggregateAnyInProgress, AggregateLeastAdvanced:
+		return nil
+	default:
+		return fmt.Errorf("unknown state label aggregation '%s'", aggregation)
+	}
+}
+
+func stateRank(state tracker.StoryState) int {
+	for i, s := range storyStateOrder {
+		if s == state {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Colors returns each state label along with its color.
+func (labels StateLabels) Colors() map[string]string {
+	colors := map[string]string{}
+	for _, label := range labels.Labels {
+		color, found := storyStateLabels[label]
+		if !found {
+			color = defaultStateLabelColor
+		}
+
+		colors[label] = color
+	}
+
+	return colors
+}
+
+func (labels StateLabels) IsStateLabel(name string) bool {
+	for _, label := range labels.Labels {
+		if label == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IssueLabel returns the label reflecting the state of the stories.
+//
+// Accepted stories are ignored unless all of them are accepted, in which case
+// the label for the accepted state is used, if any.
+func (labels StateLabels) IssueLabel(set StorySet) (string, bool, error) {
+	if len(set) == 0 {
+		return "", false, nil
+	}
+
+	if set.AllAccepted() {
+		label, found := labels.Labels[tracker.StoryStateAccepted]
+		return label, found, nil
+	}
+
+	chosen := -1
+	for _, story := range set {
+		rank := stateRank(story.State)
+		if rank == -1 {
+			return "", false, fmt.Errorf("unknown state '%s' of story %d", story.State, story.ID)
+		}
+
+		if story.State == tracker.StoryStateAccepted {
+			continue
+		}
+
+		switch {
+		case chosen == -1:
+			chosen = rank
+		case labels.Aggregation == AggregateLeastAdvanced && rank < chosen:
+			chosen = rank
+		case labels.Aggregation != AggregateLeastAdvanced && rank > chosen:
+			chosen = rank
+		}
+	}
+
+	if chosen == -1 {
+		return "", false, nil
+	}
+
+	label, found := labels.Labels[storyStateOrder[chosen]]
+	return label, found, nil
+}
+
+// stateLabels returns the configured state labels over the defaults, so that
+// labelling one state doesn't unlabel the others.
+func (syncer *Syncer) stateLabels() StateLabels {
+	labels := StateLabels{
+		Labels:      map[tracker.StoryState]string{},
+		Aggregation: defaultStateLabels.Aggregation,
+	}
+
+	for state, label := range defaultStateLabels.Labels {
+		labels.Labels[state] = label
+	}
+
+	for state, label := range syncer.StateLabels.Labels {
+		labels.Labels[state] = label
+	}
+
+	if syncer.StateLabels.Aggregation != "" {
+		labels.Aggregation = syncer.StateLabels.Aggregation
+	}
+
+	return labels
+}
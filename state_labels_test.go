@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xoebus/go-tracker"
+)
+
+func TestStateLabelsKeepDefaultsForUnconfiguredStates(t *testing.T) {
+	syncer := &Syncer{
+		StateLabels: StateLabels{
+			Labels: map[tracker.StoryState]string{
+				tracker.StoryStateStarted: "status/started",
+			},
+		},
+	}
+
+	labels := syncer.stateLabels()
+
+	for state, expected := range map[tracker.StoryState]string{
+		tracker.StoryStateStarted:     "status/started",
+		tracker.StoryStateUnscheduled: IssueLabelUnscheduled,
+		tracker.StoryStateFinished:    IssueLabelInFlight,
+	} {
+		label, found, err := labels.IssueLabel(StorySet{{ID: 1, State: state}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !found || label != expected {
+			t.Errorf("expected %s to be labelled %s, got %q", state, expected, label)
+		}
+	}
+
+	if labels.Aggregation != AggregateAnyInProgress {
+		t.Errorf("expected the default aggregation, got %s", labels.Aggregation)
+	}
+
+	if defaultStateLabels.Labels[tracker.StoryStateStarted] != IssueLabelInFlight {
+		t.Error("expected the defaults to be left alone")
+	}
+}
+
+func TestStateLabelsRejectUnknownStates(t *testing.T) {
+	_, _, err := defaultStateLabels.IssueLabel(StorySet{
+		{ID: 1, State: tracker.StoryStateStarted},
+		{ID: 2, State: "archived"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unknown story state")
+	}
+}
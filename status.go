@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/hashicorp/go-multierror"
+	"github.com/xoebus/go-tracker"
+)
+
+type StatusCommand struct {
+	Repositories  []string `long:"repo"             value-name:"PATTERN" description:"Only show repositories matching the name, glob pattern, or topic:NAME. Can be repeated."`
+	OutOfSyncOnly bool     `long:"out-of-sync-only" description:"Only show issues that the next sync would change"`
+	Format        string   `long:"format"           default:"text" choice:"text" choice:"json" description:"Format to print the status in"`
+
+	tracksuit *TracksuitCommand
+}
+
+func (cmd *StatusCommand) Execute(argv []string) error {
+	if err := ValidateRepoPatterns(cmd.Repositories); err != nil {
+		return fmt.Errorf("invalid --repo: %s", err)
+	}
+
+	mappingSyncers, err := cmd.tracksuit.newSyncers(nil)
+	if err != nil {
+		return err
+	}
+
+	report := &StatusReport{}
+
+	var multiErr *multierror.Error
+	for _, ms := range mappingSyncers {
+		repos, err := ms.Syncer.Status(cmd.Repositories)
+		if err != nil {
+			multiErr = multierror.Append(
+				multiErr,
+				fmt.Errorf("errors when checking %s: %s", ms.Mapping, err),
+			)
+		}
+
+		report.Repos = append(report.Repos, repos...)
+	}
+
+	if cmd.OutOfSyncOnly {
+		report = report.OutOfSync()
+	}
+
+	switch cmd.Format {
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	default:
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	return multiErr.ErrorOrNil()
+}
+
+// StatusReport describes how the open issues of each repository compare with
+// their stories, as of when it was made.
+type StatusReport struct {
+	Repos []RepoStatus `json:"repos"`
+}
+
+type RepoStatus struct {
+	Repo   string        `json:"repo"`
+	Issues []IssueStatus `json:"issues"`
+}
+
+// IssueStatus is what a sync would find for an issue: the stories linked to
+// it, the labels they call for, and whether the issue reflects them yet.
+type IssueStatus struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+
+	Stories []StoryStatus `json:"stories"`
+
+	// Labels are the labels the issue's stories call for.
+	Labels []string `json:"labels"`
+
+	// MissingLabels and ExtraLabels are what a sync would add to and remove
+	// from the issue.
+	MissingLabels []string `json:"missing_labels,omitempty"`
+	ExtraLabels   []string `json:"extra_labels,omitempty"`
+
+	LabelsInSync bool `json:"labels_in_sync"`
+
+	// CommentExists and CommentInSync describe the comment listing the
+	// issue's stories.
+	CommentExists bool `json:"comment_exists"`
+	CommentInSync bool `json:"comment_in_sync"`
+
+	// ShouldClose is set for open issues that a sync would close.
+	// PendingClose is set for those waiting out the close grace period.
+	ShouldClose  bool `json:"should_close"`
+	PendingClose bool `json:"pending_close"`
+	StateInSync  bool `json:"state_in_sync"`
+
+	InSync bool `json:"in_sync"`
+}
+
+type StoryStatus struct {
+	ID    int                `json:"id"`
+	State tracker.StoryState `json:"state"`
+}
+
+// Status reports on the open issues of each repository that would be
+// synced, fetching issues and stories as a full sync does but changing
+// nothing. Only repositories matching the given patterns are reported on, if
+// any are given.
+func (syncer *Syncer) Status(repoPatterns []string) ([]RepoStatus, error) {
+	allStories, err := syncer.Backend.AllStories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stories: %s", err)
+	}
+
+	syncer.allStoriesLock.Lock()
+	syncer.allStories = allStories
+	syncer.allStoriesLock.Unlock()
+
+	allRepos, err := syncer.Source.Repos(syncer.OrganizationName, syncer.IncludePrivate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repos: %s", err)
+	}
+
+	var repos []*Repository
+	for _, repo := range allRepos {
+		if !syncer.shouldSync(repo) {
+			continue
+		}
+
+		if len(repoPatterns) > 0 && !repoMatches(repo, repoPatterns) {
+			continue
+		}
+
+		repos = append(repos, repo)
+	}
+
+	workers := newPool(syncer.Concurrency)
+
+	statuses := make([]RepoStatus, len(repos))
+	failed := make([]bool, len(repos))
+
+	errs := workers.Each(len(repos), func(i int) error {
+		status, err := syncer.repoStatus(repos[i], workers)
+		if err != nil {
+			failed[i] = true
+			return fmt.Errorf("errors when processing %s/%s: %s", *repos[i].Owner.Login, *repos[i].Name, err)
+		}
+
+		statuses[i] = status
+
+		return nil
+	})
+
+	var repoStatuses []RepoStatus
+	for i, status := range statuses {
+		if !failed[i] {
+			repoStatuses = append(repoStatuses, status)
+		}
+	}
+
+	var multiErr *multierror.Error
+	for _, err := range errs {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	return repoStatuses, multiErr.ErrorOrNil()
+}
+
+func (syncer *Syncer) repoStatus(repo *Repository, workers *pool) (RepoStatus, error) {
+	name := *repo.Owner.Login + "/" + *repo.Name
+	if host := syncer.Source.Host(); host != "" {
+		name = host + "/" + name
+	}
+
+	status := RepoStatus{Repo: name}
+
+	if syncer.LinkPullRequests {
+		err := workers.Run(func() error {
+			_, err := syncer.loadPullRequests(repo)
+			return err
+		})
+		if err != nil {
+			return status, fmt.Errorf("failed to index pull requests: %s", err)
+		}
+	}
+
+	var issues []*github.Issue
+	err := workers.Run(func() error {
+		var err error
+		issues, err = syncer.Source.Issues(repo, time.Time{})
+		return err
+	})
+	if err != nil {
+		return status, fmt.Errorf("failed to fetch issues: %s", err)
+	}
+
+	status.Issues = make([]IssueStatus, len(issues))
+
+	errs := workers.Each(len(issues), func(i int) error {
+		return workers.Run(func() error {
+			var err error
+			status.Issues[i], err = syncer.issueStatus(repo, issues[i])
+			return err
+		})
+	})
+
+	var multiErr *multierror.Error
+	for _, err := range errs {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	if multiErr.ErrorOrNil() != nil {
+		return status, multiErr
+	}
+
+	sort.Slice(status.Issues, func(i, j int) bool {
+		return status.Issues[i].Number < status.Issues[j].Number
+	})
+
+	return status, nil
+}
+
+func (syncer *Syncer) issueStatus(repo *Repository, issue *github.Issue) (IssueStatus, error) {
+	label := syncer.trackerLabelForIssue(repo, issue)
+
+	issueStories, _ := syncer.storiesWithLabel(label).WithoutLabel(duplicateStoryLabel).Dedupe()
+
+	labels, err := issueStories.IssueLabels(syncer.storyTypeLabels(), syncer.stateLabels())
+	if err != nil {
+		return IssueStatus{}, err
+	}
+
+	status := IssueStatus{
+		Number:  *issue.Number,
+		Title:   *issue.Title,
+		URL:     *issue.HTMLURL,
+		Stories: []StoryStatus{},
+		Labels:  labels,
+	}
+
+	if status.Labels == nil {
+		status.Labels = []string{}
+	}
+
+	for _, story := range issueStories {
+		status.Stories = append(status.Stories, StoryStatus{
+			ID:    story.ID,
+			State: story.State,
+		})
+	}
+
+	status.MissingLabels, status.ExtraLabels = syncer.issueLabelChanges(issue, status.Labels)
+	status.LabelsInSync = len(status.MissingLabels) == 0 && len(status.ExtraLabels) == 0
+
+	comments, err := syncer.Source.Comments(repo, *issue.Number)
+	if err != nil {
+		return status, fmt.Errorf("failed to fetch comments on %s: %s", label, err)
+	}
+
+	comment, err := syncer.statusComment(comments)
+	if err != nil {
+		return status, fmt.Errorf("failed to check comment on %s: %s", label, err)
+	}
+
+	commentBody, err := syncer.renderComment(syncer.statusCommentTemplate(), repo, issue, issueStories)
+	if err != nil {
+		return status, fmt.Errorf("error building comment body for %s: %s", label, err)
+	}
+
+	status.CommentExists = comment != nil
+	status.CommentInSync = comment != nil && *comment.Body == commentBody
+
+	decision, err := syncer.decideClose(repo, issue, issueStories, comments)
+	if err != nil {
+		return status, fmt.Errorf("failed to check whether to close %s: %s", label, err)
+	}
+
+	status.ShouldClose = decision == closeNow
+	status.PendingClose = decision == closeAwaitingGracePeriod
+	status.StateInSync = !status.ShouldClose
+
+	status.InSync = len(issueStories) > 0 &&
+		status.LabelsInSync &&
+		status.CommentInSync &&
+		status.StateInSync
+
+	return status, nil
+}
+
+// OutOfSync returns the report without the issues that are in sync, leaving
+// out repositories with none left.
+func (report *StatusReport) OutOfSync() *StatusReport {
+	filtered := &StatusReport{}
+
+	for _, repo := range report.Repos {
+		var issues []IssueStatus
+		for _, issue := range repo.Issues {
+			if !issue.InSync {
+				issues = append(issues, issue)
+			}
+		}
+
+		if len(issues) > 0 {
+			filtered.Repos = append(filtered.Repos, RepoStatus{
+				Repo:   repo.Repo,
+				Issues: issues,
+			})
+		}
+	}
+
+	return filtered
+}
+
+func (report *StatusReport) WriteText(w io.Writer) error {
+	if len(report.Repos) == 0 {
+		_, err := fmt.Fprintln(w, "no issues")
+		return err
+	}
+
+	for i, repo := range report.Repos {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintln(w, repo.Repo)
+
+		if len(repo.Issues) == 0 {
+			fmt.Fprintln(w, "  no open issues")
+			continue
+		}
+
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(table, "  ISSUE\tTITLE\tSTORIES\tWANTED LABELS\tLABELS\tCOMMENT\tSTATE")
+
+		for _, issue := range repo.Issues {
+			fmt.Fprintf(
+				table,
+				"  #%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				issue.Number,
+				truncate(issue.Title, 40),
+				issue.storiesSummary(),
+				orNone(strings.Join(issue.Labels, ", ")),
+				issue.labelsSummary(),
+				issue.commentSummary(),
+				issue.stateSummary(),
+			)
+		}
+
+		if err := table.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (report *StatusReport) WriteJSON(w io.Writer) error {
+	if report.Repos == nil {
+		report.Repos = []RepoStatus{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func (status IssueStatus) storiesSummary() string {
+	var stories []string
+	for _, story := range status.Stories {
+		stories = append(stories, fmt.Sprintf("#%d %s", story.ID, story.State))
+	}
+
+	return orNone(strings.Join(stories, ", "))
+}
+
+func (status IssueStatus) labelsSummary() string {
+	if status.LabelsInSync {
+		return "ok"
+	}
+
+	var changes []string
+	for _, label := range status.MissingLabels {
+		changes = append(changes, "+"+label)
+	}
+
+	for _, label := range status.ExtraLabels {
+		changes = append(changes, "-"+label)
+	}
+
+	return strings.Join(changes, " ")
+}
+
+func (status IssueStatus) commentSummary() string {
+	switch {
+	case !status.CommentExists:
+		return "missing"
+	case !status.CommentInSync:
+		return "stale"
+	default:
+		return "ok"
+	}
+}
+
+func (status IssueStatus) stateSummary() string {
+	switch {
+	case status.ShouldClose:
+		return "should close"
+	case status.PendingClose:
+		return "closing"
+	default:
+		return "open"
+	}
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+
+	return string(runes[:length-3]) + "..."
+}
+
+func orNone(text string) string {
+	if text == "" {
+		return "-"
+	}
+
+	return text
+}
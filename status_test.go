@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vito/tracksuit/fakes"
+	"github.com/xoebus/go-tracker"
+)
+
+// issueStatuses returns the statuses reported for the fixture's repository,
+// keyed by issue number.
+func issueStatuses(t *testing.T, repos []RepoStatus) map[int]IssueStatus {
+	t.Helper()
+
+	if len(repos) != 1 || repos[0].Repo != testOrganization+"/"+testRepo {
+		t.Fatalf("expected only %s/%s to be reported on, got %+v", testOrganization, testRepo, repos)
+	}
+
+	statuses := map[int]IssueStatus{}
+	for _, issue := range repos[0].Issues {
+		statuses[issue.Number] = issue
+	}
+
+	return statuses
+}
+
+// captureStdout returns what the function printed to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		buf := new(bytes.Buffer)
+		io.Copy(buf, r)
+		output <- buf.String()
+	}()
+
+	fn()
+
+	w.Close()
+
+	return <-output
+}
+
+func TestStatusComparesIssuesWithTheirStories(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "in sync")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "started")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "accepted")
+
+	fixture.sync(t)
+
+	started := fixture.stories(t, 2, 1)[0]
+	fixture.Tracker.SetStoryState(started.ID, tracker.StoryStateStarted)
+
+	followUp := fixture.Tracker.AddStory(tracker.Story{
+		Name:   "follow up",
+		Type:   tracker.StoryTypeChore,
+		Labels: []tracker.Label{{Name: issueLabel("", testOrganization, testRepo, 2)}},
+	})
+
+	accepted := fixture.stories(t, 3, 1)[0]
+	fixture.Tracker.SetStoryState(accepted.ID, tracker.StoryStateAccepted)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "not synced yet")
+
+	repos, err := fixture.Syncer.Status(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := issueStatuses(t, repos)
+
+	if status := statuses[1]; !status.InSync || !status.LabelsInSync || !status.CommentInSync || !status.StateInSync {
+		t.Errorf("expected #1 to be in sync, got %+v", status)
+	}
+
+	if status := statuses[2]; status.InSync ||
+		len(status.MissingLabels) != 1 || status.MissingLabels[0] != IssueLabelInFlight ||
+		len(status.ExtraLabels) != 1 || status.ExtraLabels[0] != IssueLabelUnscheduled ||
+		!status.CommentExists || status.CommentInSync {
+		t.Errorf("expected #2 to need its labels and comment updated, got %+v", status)
+	}
+
+	if status := statuses[2]; len(status.Stories) != 2 ||
+		status.Stories[0] != (StoryStatus{ID: started.ID, State: tracker.StoryStateStarted}) ||
+		status.Stories[1].ID != followUp.ID {
+		t.Errorf("expected #2's stories to be listed, got %+v", status.Stories)
+	}
+
+	if status := statuses[3]; status.InSync || !status.ShouldClose || status.StateInSync {
+		t.Errorf("expected #3 to need closing, got %+v", status)
+	}
+
+	if status := statuses[4]; status.InSync || len(status.Stories) != 0 || status.CommentExists {
+		t.Errorf("expected #4 to have no story or comment yet, got %+v", status)
+	}
+
+	// checking changes nothing
+	fixture.stories(t, 4, 0)
+
+	if state := fixture.issueState(3); state != "open" {
+		t.Errorf("expected #3 to be left open, got %s", state)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 2), IssueLabelUnscheduled)
+}
+
+func TestStatusOnlyReportsMatchingRepositories(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddRepo(testOrganization, "other-repo")
+	fixture.GitHub.AddIssue(testOrganization, "other-repo", "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	repos, err := fixture.Syncer.Status([]string{"some-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if statuses := issueStatuses(t, repos); len(statuses) != 1 {
+		t.Errorf("expected one issue to be reported on, got %+v", statuses)
+	}
+}
+
+func TestStatusReportWriteText(t *testing.T) {
+	report := &StatusReport{}
+
+	buf := new(bytes.Buffer)
+	if err := report.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "no issues\n" {
+		t.Errorf("unexpected output for an empty report: %q", buf.String())
+	}
+
+	report.Repos = []RepoStatus{
+		{
+			Repo: "some-org/some-repo",
+			Issues: []IssueStatus{
+				{
+					Number:        1,
+					Title:         "in sync",
+					Stories:       []StoryStatus{{ID: 1234, State: tracker.StoryStateStarted}},
+					Labels:        []string{IssueLabelInFlight},
+					LabelsInSync:  true,
+					CommentExists: true,
+					CommentInSync: true,
+					StateInSync:   true,
+					InSync:        true,
+				},
+				{
+					Number:        2,
+					Title:         "a title long enough that it has to be cut short",
+					Stories:       []StoryStatus{{ID: 5678, State: tracker.StoryStateAccepted}},
+					MissingLabels: []string{IssueLabelScheduled},
+					ExtraLabels:   []string{IssueLabelUnscheduled},
+					CommentExists: true,
+					ShouldClose:   true,
+				},
+			},
+		},
+		{Repo: "some-org/other-repo"},
+	}
+
+	buf.Reset()
+	if err := report.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "some-org/some-repo\n" +
+		"  ISSUE  TITLE                                     STORIES         WANTED LABELS  LABELS                   COMMENT  STATE\n" +
+		"  #1     in sync                                   #1234 started   in-flight      ok                       ok       open\n" +
+		"  #2     a title long enough that it has to be...  #5678 accepted  -              +scheduled -unscheduled  stale    should close\n" +
+		"\n" +
+		"some-org/other-repo\n" +
+		"  no open issues\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	outOfSync := report.OutOfSync()
+	if len(outOfSync.Repos) != 1 || len(outOfSync.Repos[0].Issues) != 1 || outOfSync.Repos[0].Issues[0].Number != 2 {
+		t.Errorf("expected only #2 to be out of sync, got %+v", outOfSync.Repos)
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	gh := fakes.NewGitHub(testBotLogin)
+	defer gh.Close()
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	defer fakeTracker.Close()
+
+	gh.AddRepo(testOrganization, testRepo)
+	gh.AddIssue(testOrganization, testRepo, "something broke")
+
+	transport := &routingTransport{
+		Fakes: map[string]string{
+			"api.github.com":         gh.URL,
+			"www.pivotaltracker.com": fakeTracker.URL,
+		},
+	}
+
+	args := []string{
+		"--github-token", "some-token",
+		"--github-organization-name", testOrganization,
+		"--tracker-token", "some-token",
+		"--tracker-project-id", "1234",
+	}
+
+	runCommand(t, transport, args...)
+
+	gh.AddIssue(testOrganization, testRepo, "something else broke")
+
+	for _, example := range []struct {
+		args   []string
+		issues []int
+	}{
+		{[]string{"status", "--format", "json"}, []int{1, 2}},
+		{[]string{"status", "--format", "json", "--out-of-sync-only"}, []int{2}},
+		{[]string{"status", "--format", "json", "--repo", "other-*"}, nil},
+	} {
+		cmd := &TracksuitCommand{Transport: transport}
+		parser := newParser(cmd)
+
+		output := captureStdout(t, func() {
+			if _, err := parser.ParseArgs(append(args, example.args...)); err != nil {
+				t.Errorf("%v failed: %s", example.args, err)
+			}
+		})
+
+		if parser.Active == nil || parser.Active.Name != "status" {
+			t.Fatalf("expected the status command to run, got %+v", parser.Active)
+		}
+
+		var report StatusReport
+		if err := json.Unmarshal([]byte(output), &report); err != nil {
+			t.Fatalf("failed to decode %q: %s", output, err)
+		}
+
+		var issues []int
+		for _, repo := range report.Repos {
+			for _, issue := range repo.Issues {
+				issues = append(issues, issue.Number)
+			}
+		}
+
+		if !intsEqual(issues, example.issues) {
+			t.Errorf("expected %v to report on %v, got %v", example.args, example.issues, issues)
+		}
+	}
+
+	if stories := fakeTracker.Stories(); len(stories) != 1 {
+		t.Errorf("expected status to create no stories, got %d", len(stories))
+	}
+
+	cmd := &TracksuitCommand{Transport: transport}
+	if _, err := newParser(cmd).ParseArgs(append(args, "status", "--repo", "topic:")); err == nil || !strings.Contains(err.Error(), "invalid --repo") {
+		t.Errorf("expected an invalid pattern to be rejected, got %v", err)
+	}
+}
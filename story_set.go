@@ -1,7 +1,6 @@
 package main
 
 import (
-	"log"
 	"sort"
 	"strings"
 	"time"
@@ -15,21 +14,18 @@ const IssueLabelInFlight = "in-flight"
 const IssueLabelBug = "bug"
 const IssueLabelEnhancement = "enhancement"
 
+// storyStateLabels are the colors of the default state labels.
 var storyStateLabels = map[string]string{
 	IssueLabelUnscheduled: "e4eff7",
 	IssueLabelScheduled:   "f4f4f4",
 	IssueLabelInFlight:    "f3f3d1",
-
-	// respect original github colors
-	IssueLabelBug:         "",
-	IssueLabelEnhancement: "",
 }
 
 var issueOnlyLabels = map[string]string{
 	"discuss": "c2e0c6",
 }
 
-type StorySet []tracker.Story
+type StorySet []Story
 
 func (set StorySet) WithLabel(label string) StorySet {
 	var withLabel StorySet
@@ -51,23 +47,37 @@ type dupeEquivalence struct {
 	labels      string
 }
 
-func (set StorySet) Dedupe() (StorySet, StorySet) {
-	byEquivalence := map[dupeEquivalence]StorySet{}
+func equivalenceOf(story Story) dupeEquivalence {
+	labelNames := []string{}
+	for _, label := range story.Labels {
+		labelNames = append(labelNames, label.Name)
+	}
+
+	sort.Strings(labelNames)
 
+	return dupeEquivalence{
+		name:        story.Name,
+		description: story.Description,
+		labels:      strings.Join(labelNames, ","),
+	}
+}
+
+func (set StorySet) WithoutLabel(label string) StorySet {
+	var withoutLabel StorySet
 	for _, story := range set {
-		labelNames := []string{}
-		for _, label := range story.Labels {
-			labelNames = append(labelNames, label.Name)
+		if len(StorySet{story}.WithLabel(label)) == 0 {
+			withoutLabel = append(withoutLabel, story)
 		}
+	}
 
-		sort.Strings(labelNames)
+	return withoutLabel
+}
 
-		eq := dupeEquivalence{
-			name:        story.Name,
-			description: story.Description,
-			labels:      strings.Join(labelNames, ","),
-		}
+func (set StorySet) Dedupe() (StorySet, StorySet) {
+	byEquivalence := map[dupeEquivalence]StorySet{}
 
+	for _, story := range set {
+		eq := equivalenceOf(story)
 		byEquivalence[eq] = append(byEquivalence[eq], story)
 	}
 
@@ -80,7 +90,7 @@ func (set StorySet) Dedupe() (StorySet, StorySet) {
 			continue
 		}
 
-		var oldestStory tracker.Story
+		var oldestStory Story
 		for _, story := range stories {
 			if oldestStory.ID == 0 || story.ID < oldestStory.ID {
 				oldestStory = story
@@ -98,6 +108,19 @@ func (set StorySet) Dedupe() (StorySet, StorySet) {
 	return deduped, dupes
 }
 
+// OriginalOf returns the story in the set that the dupe duplicates.
+func (set StorySet) OriginalOf(dupe Story) (Story, bool) {
+	eq := equivalenceOf(dupe)
+
+	for _, story := range set {
+		if story.ID != dupe.ID && equivalenceOf(story) == eq {
+			return story, true
+		}
+	}
+
+	return Story{}, false
+}
+
 func (set StorySet) AllAccepted() bool {
 	allAccepted := true
 	for _, story := range set {
@@ -154,59 +177,21 @@ func (set StorySet) LastAccepted() time.Time {
 	return lastAccepted
 }
 
-func (set StorySet) IssueLabels() []string {
+func (set StorySet) IssueLabels(typeLabels StoryTypeLabels, stateLabels StateLabels) ([]string, error) {
 	var labels []string
 
-	var hasBugs bool
-	var hasFeatures bool
-	for _, story := range set {
-		if story.Type == "feature" {
-			hasFeatures = true
-		} else if story.Type == "bug" {
-			hasBugs = true
-		}
-	}
-
-	if hasFeatures {
-		labels = append(labels, IssueLabelEnhancement)
-	} else if hasBugs {
-		labels = append(labels, IssueLabelBug)
+	if typeLabel, found := typeLabels.IssueLabel(set); found {
+		labels = append(labels, typeLabel)
 	}
 
-	if set.AllAccepted() {
-		// everything is accepted; only set labels for types of stories, not status
-		return labels
-	}
-
-	allUnscheduled := true
-	for _, story := range set {
-		switch story.State {
-		case "accepted":
-			// ignore accepted stories; if some are accepted but the rest are
-			// unscheduled, it's still unscheduled
-
-		case "unscheduled":
-			// only mark if all are unscheduled
-
-		case "started", "finished", "delivered", "rejected":
-			// a story is in-progress; report as in-flight
-			labels = append(labels, IssueLabelInFlight)
-			return labels
-
-		case "unstarted", "planned":
-			// something is scheduled
-			allUnscheduled = false
-
-		default:
-			log.Fatalln("unknown story state:", story.State)
-		}
+	stateLabel, found, err := stateLabels.IssueLabel(set)
+	if err != nil {
+		return nil, err
 	}
 
-	if allUnscheduled {
-		labels = append(labels, IssueLabelUnscheduled)
-	} else {
-		labels = append(labels, IssueLabelScheduled)
+	if found {
+		labels = append(labels, stateLabel)
 	}
 
-	return labels
+	return labels, nil
 }
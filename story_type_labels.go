@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+// StoryTypeLabel maps a GitHub issue label to the type of story it implies.
+type StoryTypeLabel struct {
+	Label string            `yaml:"label"`
+	Type  tracker.StoryType `yaml:"type"`
+}
+
+// StoryTypeLabels are checked in order, so earlier labels take priority when
+// an issue has more than one of them.
+type StoryTypeLabels []StoryTypeLabel
+
+var defaultStoryTypeLabels = StoryTypeLabels{
+	{Label: IssueLabelEnhancement, Type: tracker.StoryTypeFeature},
+	{Label: IssueLabelBug, Type: tracker.StoryTypeBug},
+}
+
+// ParseStoryTypeLabel parses a LABEL:TYPE pair. The label may itself contain
+// colons, e.g. "type: feature:feature".
+func ParseStoryTypeLabel(pair string) (StoryTypeLabel, error) {
+	i := strings.LastIndex(pair, ":")
+	if i == -1 {
+		return StoryTypeLabel{}, fmt.Errorf("expected LABEL:TYPE, got '%s'", pair)
+	}
+
+	typeLabel := StoryTypeLabel{
+		Label: pair[:i],
+		Type:  tracker.StoryType(strings.TrimSpace(pair[i+1:])),
+	}
+
+	if err := typeLabel.Validate(); err != nil {
+		return StoryTypeLabel{}, err
+	}
+
+	return typeLabel, nil
+}
+
+func (typeLabel StoryTypeLabel) Validate() error {
+	if typeLabel.Label == "" {
+		return fmt.Errorf("missing label for story type '%s'", typeLabel.Type)
+	}
+
+	switch typeLabel.Type {
+	case tracker.StoryTypeFeature, tracker.StoryTypeBug, tracker.StoryTypeChore:
+		return nil
+	default:
+		return fmt.Errorf("unknown story type '%s' for label '%s'", typeLabel.Type, typeLabel.Label)
+	}
+}
+
+// StoryType returns the type of story for the issue, based on the first of
+// its labels to match. Issues without any matching labels are chores.
+func (labels StoryTypeLabels) StoryType(issue *github.Issue) tracker.StoryType {
+	for _, typeLabel := range labels {
+		if issueHasLabel(issue, typeLabel.Label) {
+			return typeLabel.Type
+		}
+	}
+
+	return tracker.StoryTypeChore
+}
+
+// IssueLabel returns the label to put on an issue for the types of its
+// stories, preferring labels that come first.
+func (labels StoryTypeLabels) IssueLabel(set StorySet) (string, bool) {
+	for _, typeLabel := range labels {
+		for _, story := range set {
+			if story.Type == typeLabel.Type {
+				return typeLabel.Label, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// TypeOf returns the story type that a label implies, if any.
+func (labels StoryTypeLabels) TypeOf(label string) (tracker.StoryType, bool) {
+	for _, typeLabel := range labels {
+		if typeLabel.Label == label {
+			return typeLabel.Type, true
+		}
+	}
+
+	return "", false
+}
+
+func (syncer *Syncer) storyTypeLabels() StoryTypeLabels {
+	if len(syncer.StoryTypeLabels) == 0 {
+		return defaultStoryTypeLabels
+	}
+
+	return syncer.StoryTypeLabels
+}
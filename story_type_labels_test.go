@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/xoebus/go-tracker"
+)
+
+func labelledIssue(names ...string) *github.Issue {
+	issue := &github.Issue{}
+	for _, name := range names {
+		name := name
+		issue.Labels = append(issue.Labels, github.Label{Name: &name})
+	}
+
+	return issue
+}
+
+func TestParseStoryTypeLabel(t *testing.T) {
+	for pair, expected := range map[string]StoryTypeLabel{
+		"kind/bug:bug":          {Label: "kind/bug", Type: tracker.StoryTypeBug},
+		"type: feature:feature": {Label: "type: feature", Type: tracker.StoryTypeFeature},
+		"cleanup: chore":        {Label: "cleanup", Type: tracker.StoryTypeChore},
+	} {
+		typeLabel, err := ParseStoryTypeLabel(pair)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", pair, err)
+			continue
+		}
+
+		if typeLabel != expected {
+			t.Errorf("expected %q to parse as %+v, got %+v", pair, expected, typeLabel)
+		}
+	}
+
+	for _, pair := range []string{"bug", ":bug", "kind/epic:epic"} {
+		if _, err := ParseStoryTypeLabel(pair); err == nil {
+			t.Errorf("expected %q to be rejected", pair)
+		}
+	}
+}
+
+func TestStoryTypeLabelsPreferEarlierLabels(t *testing.T) {
+	labels := StoryTypeLabels{
+		{Label: "kind/bug", Type: tracker.StoryTypeBug},
+		{Label: "kind/feature", Type: tracker.StoryTypeFeature},
+	}
+
+	for _, example := range []struct {
+		labels   []string
+		expected tracker.StoryType
+	}{
+		{[]string{"kind/feature"}, tracker.StoryTypeFeature},
+		{[]string{"kind/feature", "kind/bug"}, tracker.StoryTypeBug},
+		{[]string{IssueLabelBug}, tracker.StoryTypeChore},
+		{nil, tracker.StoryTypeChore},
+	} {
+		if storyType := labels.StoryType(labelledIssue(example.labels...)); storyType != example.expected {
+			t.Errorf("expected an issue labelled %v to be a %s, got %s", example.labels, example.expected, storyType)
+		}
+	}
+
+	label, found := labels.IssueLabel(StorySet{
+		{Story: tracker.Story{ID: 1, Type: tracker.StoryTypeFeature}},
+		{Story: tracker.Story{ID: 2, Type: tracker.StoryTypeBug}},
+	})
+	if !found || label != "kind/bug" {
+		t.Errorf("expected the bug label to win, got %q", label)
+	}
+
+	if _, found := labels.IssueLabel(StorySet{{Story: tracker.Story{ID: 1, Type: tracker.StoryTypeChore}}}); found {
+		t.Error("expected no label for a chore")
+	}
+
+	if storyType, found := labels.TypeOf("kind/feature"); !found || storyType != tracker.StoryTypeFeature {
+		t.Errorf("expected kind/feature to imply a feature, got %q", storyType)
+	}
+}
+
+func TestSyncUsesConfiguredStoryTypeLabels(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.StoryTypeLabels = StoryTypeLabels{
+		{Label: "kind/bug", Type: tracker.StoryTypeBug},
+		{Label: "kind/feature", Type: tracker.StoryTypeFeature},
+	}
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "make it better", "kind/feature")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	if feature := fixture.stories(t, 1, 1)[0]; feature.Type != tracker.StoryTypeFeature {
+		t.Errorf("expected #1 to become a feature, got %s", feature.Type)
+	}
+
+	// the default labels no longer apply
+	if chore := fixture.stories(t, 2, 1)[0]; chore.Type != tracker.StoryTypeChore {
+		t.Errorf("expected #2 to become a chore, got %s", chore.Type)
+	}
+
+	story := fixture.stories(t, 2, 1)[0]
+	if _, err := fixture.Syncer.Backend.SetStoryType(story.ID, tracker.StoryTypeBug); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateStarted)
+
+	fixture.sync(t)
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 2), IssueLabelBug, IssueLabelInFlight, "kind/bug")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncState records how far each mapping has been synced, so that later runs
+// only need to look at what has changed since.
+type SyncState struct {
+	Mappings map[string]*MappingState `json:"mappings"`
+
+	lock sync.Mutex
+}
+
+type MappingState struct {
+	// TrackerProjectVersion is the Tracker project version as of the last
+	// successful sync.
+	TrackerProjectVersion int `json:"tracker_project_version"`
+
+	// RepositoryUpdatedAt is the most recent 'updated_at' of the issues synced
+	// for each repository.
+	RepositoryUpdatedAt map[string]time.Time `json:"repository_updated_at"`
+
+	// PendingCloses are the tracker labels of issues waiting out the grace
+	// period before being closed.
+	PendingCloses map[string]bool `json:"pending_closes,omitempty"`
+}
+
+// LoadSyncState reads the state from path, returning an empty state if the
+// file does not exist yet.
+func LoadSyncState(path string) (*SyncState, error) {
+	state := &SyncState{
+		Mappings: map[string]*MappingState{},
+	}
+
+	payload, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(payload, state); err != nil {
+		return nil, err
+	}
+
+	if state.Mappings == nil {
+		state.Mappings = map[string]*MappingState{}
+	}
+
+	return state, nil
+}
+
+// Save atomically writes the state to path.
+func (state *SyncState) Save(path string) error {
+	state.lock.Lock()
+	payload, err := json.MarshalIndent(state, "", "  ")
+	state.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (state *SyncState) ProjectVersion(key string) (int, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	mapping, found := state.Mappings[key]
+	if !found {
+		return 0, false
+	}
+
+	return mapping.TrackerProjectVersion, true
+}
+
+func (state *SyncState) SetProjectVersion(key string, version int) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.mapping(key).TrackerProjectVersion = version
+}
+
+func (state *SyncState) RepositoryUpdatedAt(key string, repo string) time.Time {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	mapping, found := state.Mappings[key]
+	if !found {
+		return time.Time{}
+	}
+
+	return mapping.RepositoryUpdatedAt[repo]
+}
+
+func (state *SyncState) SetRepositoryUpdatedAt(key string, repo string, updatedAt time.Time) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.mapping(key).RepositoryUpdatedAt[repo] = updatedAt
+}
+
+func (state *SyncState) PendingCloses(key string) []string {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	mapping, found := state.Mappings[key]
+	if !found {
+		return nil
+	}
+
+	var labels []string
+	for label := range mapping.PendingCloses {
+		labels = append(labels, label)
+	}
+
+	return labels
+}
+
+func (state *SyncState) SetPendingClose(key string, label string, pending bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	mapping := state.mapping(key)
+
+	if !pending {
+		delete(mapping.PendingCloses, label)
+		return
+	}
+
+	if mapping.PendingCloses == nil {
+		mapping.PendingCloses = map[string]bool{}
+	}
+
+	mapping.PendingCloses[label] = true
+}
+
+func (state *SyncState) mapping(key string) *MappingState {
+	mapping, found := state.Mappings[key]
+	if !found {
+		mapping = &MappingState{}
+		state.Mappings[key] = mapping
+	}
+
+	if mapping.RepositoryUpdatedAt == nil {
+		mapping.RepositoryUpdatedAt = map[string]time.Time{}
+	}
+
+	return mapping
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xoebus/go-tracker"
+)
+
+func TestSyncStateRoundTrips(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	state, err := LoadSyncState(path)
+	if err != nil {
+		t.Fatalf("failed to load missing state: %s", err)
+	}
+
+	if _, found := state.ProjectVersion("some-org"); found {
+		t.Fatal("expected a missing state file to load as an empty state")
+	}
+
+	updatedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	state.SetProjectVersion("some-org", 42)
+	state.SetRepositoryUpdatedAt("some-org", "some-org/some-repo", updatedAt)
+	state.SetPendingClose("some-org", "some-org/some-repo#1", true)
+	state.SetPendingClose("some-org", "some-org/some-repo#2", true)
+	state.SetPendingClose("some-org", "some-org/some-repo#2", false)
+
+	if err := state.Save(path); err != nil {
+		t.Fatalf("failed to save state: %s", err)
+	}
+
+	loaded, err := LoadSyncState(path)
+	if err != nil {
+		t.Fatalf("failed to load state: %s", err)
+	}
+
+	if version, found := loaded.ProjectVersion("some-org"); !found || version != 42 {
+		t.Errorf("expected project version 42, got %d (found: %t)", version, found)
+	}
+
+	if loadedAt := loaded.RepositoryUpdatedAt("some-org", "some-org/some-repo"); !loadedAt.Equal(updatedAt) {
+		t.Errorf("expected the repository to have been updated at %s, got %s", updatedAt, loadedAt)
+	}
+
+	if pending := loaded.PendingCloses("some-org"); len(pending) != 1 || pending[0] != "some-org/some-repo#1" {
+		t.Errorf("expected only #1 to be pending close, got %v", pending)
+	}
+
+	if _, found := loaded.ProjectVersion("other-org"); found {
+		t.Error("expected other mappings to be unaffected")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected saving to leave only the state file behind, got %d files", len(entries))
+	}
+}
+
+func TestLoadSyncStateFailsOnCorruptState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	if err := ioutil.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadSyncState(path); err == nil {
+		t.Fatal("expected loading a corrupt state file to fail")
+	}
+}
+
+func TestSyncResumesFromSavedState(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := LoadSyncState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.Syncer.State = state
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	if err := state.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	version, found := state.ProjectVersion(fixture.Syncer.stateKey())
+	if !found {
+		t.Fatal("expected the project version to be recorded")
+	}
+
+	if state.RepositoryUpdatedAt(fixture.Syncer.stateKey(), testOrganization+"/"+testRepo).IsZero() {
+		t.Fatal("expected the repository's progress to be recorded")
+	}
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateStarted)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	// a later run picks up where the last one left off
+	fixture.Syncer.State, err = LoadSyncState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.sync(t)
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelInFlight)
+
+	fixture.stories(t, 2, 1)
+
+	if latest, _ := fixture.Syncer.State.ProjectVersion(fixture.Syncer.stateKey()); latest <= version {
+		t.Errorf("expected the project version to advance past %d, got %d", version, latest)
+	}
+}
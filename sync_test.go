@@ -0,0 +1,442 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/vito/tracksuit/fakes"
+	"github.com/xoebus/go-tracker"
+)
+
+const (
+	testOrganization = "some-org"
+	testRepo         = "some-repo"
+	testProjectID    = 1234
+	testBotLogin     = "tracksuit-bot"
+)
+
+// syncFixture syncs a fake GitHub organization with a fake Tracker project.
+type syncFixture struct {
+	GitHub  *fakes.GitHub
+	Tracker *fakes.Tracker
+
+	Syncer *Syncer
+}
+
+func newSyncFixture(t *testing.T) *syncFixture {
+	gh := fakes.NewGitHub(testBotLogin)
+	t.Cleanup(gh.Close)
+
+	fakeTracker := fakes.NewTracker(testProjectID)
+	t.Cleanup(fakeTracker.Close)
+
+	gh.AddRepo(testOrganization, testRepo)
+
+	return &syncFixture{
+		GitHub:  gh,
+		Tracker: fakeTracker,
+
+		Syncer: &Syncer{
+			Source:           &GitHubSource{Client: gh.Client()},
+			Backend:          NewTrackerBackend(fakeTracker.URL, testProjectID, "some-token", nil),
+			OrganizationName: testOrganization,
+			CloseIssues:      true,
+		},
+	}
+}
+
+func (fixture *syncFixture) sync(t *testing.T) {
+	t.Helper()
+
+	if err := fixture.Syncer.SyncIssuesAndStories(); err != nil {
+		t.Fatalf("sync failed: %s", err)
+	}
+}
+
+// stories returns the stories for the issue, failing unless there are as
+// many as expected.
+func (fixture *syncFixture) stories(t *testing.T, number int, expected int) []tracker.Story {
+	t.Helper()
+
+	stories := fixture.Tracker.StoriesWithLabel(issueLabel("", testOrganization, testRepo, number))
+	if len(stories) != expected {
+		t.Fatalf("expected %d stories for #%d, got %d: %+v", expected, number, len(stories), stories)
+	}
+
+	return stories
+}
+
+// botComments returns the comments the syncer left on the issue.
+func (fixture *syncFixture) botComments(number int) []github.IssueComment {
+	var comments []github.IssueComment
+	for _, comment := range fixture.GitHub.Comments(testOrganization, testRepo, number) {
+		if *comment.User.Login == testBotLogin {
+			comments = append(comments, comment)
+		}
+	}
+
+	return comments
+}
+
+func (fixture *syncFixture) issueState(number int) string {
+	return *fixture.GitHub.Issue(testOrganization, testRepo, number).State
+}
+
+func assertLabels(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected labels %v, got %v", expected, actual)
+	}
+}
+
+func TestSyncCreatesStoriesForNewIssues(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "make it better")
+
+	fixture.sync(t)
+
+	bug := fixture.stories(t, 1, 1)[0]
+	if bug.Name != "something broke" || bug.Type != tracker.StoryTypeBug || bug.State != tracker.StoryStateUnscheduled {
+		t.Errorf("unexpected story for #1: %+v", bug)
+	}
+
+	chore := fixture.stories(t, 2, 1)[0]
+	if chore.Name != "make it better" || chore.Type != tracker.StoryTypeChore {
+		t.Errorf("unexpected story for #2: %+v", chore)
+	}
+
+	comments := fixture.botComments(1)
+	if len(comments) != 1 {
+		t.Fatalf("expected a status comment, got %d comments", len(comments))
+	}
+
+	if !strings.Contains(*comments[0].Body, bug.URL) {
+		t.Errorf("status comment does not link to the story:\n%s", *comments[0].Body)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelUnscheduled)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 2), IssueLabelUnscheduled)
+
+	for _, label := range []string{IssueLabelUnscheduled, IssueLabelScheduled, IssueLabelInFlight} {
+		found := false
+		for _, repoLabel := range fixture.GitHub.Labels(testOrganization, testRepo) {
+			found = found || *repoLabel.Name == label
+		}
+
+		if !found {
+			t.Errorf("expected repository label '%s' to be created", label)
+		}
+	}
+
+	fixture.sync(t)
+
+	fixture.stories(t, 1, 1)
+	fixture.stories(t, 2, 1)
+
+	if comments := fixture.botComments(1); len(comments) != 1 {
+		t.Errorf("expected the status comment to be reused, got %d comments", len(comments))
+	}
+}
+
+func TestSyncCreatesStoriesForPullRequestsWithoutLinks(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	// as listed by older Gitea versions, which leave out the links
+	pr := fixture.GitHub.AddIssue(testOrganization, testRepo, "fix something")
+	pr.PullRequestLinks = &github.PullRequestLinks{}
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	if !StorySet([]Story{{Story: story}}).HasPR() {
+		t.Errorf("expected the story to be labelled has-pr, got %+v", story.Labels)
+	}
+}
+
+func TestSyncPaginates(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.PerPage = 2
+	fixture.Tracker.PageSize = 2
+
+	for i := 0; i < 5; i++ {
+		fixture.GitHub.AddIssue(testOrganization, testRepo, "some issue")
+	}
+
+	fixture.sync(t)
+	fixture.sync(t)
+
+	for number := 1; number <= 5; number++ {
+		fixture.stories(t, number, 1)
+	}
+}
+
+func TestSyncReflectsStoryStateOnIssueLabels(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	fixture.Tracker.SetStoryState(story.ID, StoryStateUnstarted)
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelScheduled)
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateStarted)
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelInFlight)
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateUnscheduled)
+	fixture.sync(t)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelBug, IssueLabelUnscheduled)
+}
+
+func TestSyncClosesIssuesOnceAllStoriesAreAccepted(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	extra := fixture.Tracker.AddStory(tracker.Story{
+		Name:   "follow up",
+		Type:   tracker.StoryTypeChore,
+		Labels: []tracker.Label{{Name: issueLabel("", testOrganization, testRepo, 1)}},
+	})
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected issue to stay open while a story is unaccepted, got %s", state)
+	}
+
+	fixture.Tracker.SetStoryState(extra.ID, tracker.StoryStateAccepted)
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+
+	comments := fixture.botComments(1)
+	if len(comments) != 2 || !isClosedComment(*comments[1].Body) {
+		t.Fatalf("expected a status comment and a closed comment, got %+v", comments)
+	}
+
+	if !strings.Contains(*comments[0].Body, "* [x]") {
+		t.Errorf("status comment does not show the stories as accepted:\n%s", *comments[0].Body)
+	}
+}
+
+func TestSyncLeavesIssuesOpenWhenNotClosing(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.CloseIssues = false
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected issue to stay open, got %s", state)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1))
+}
+
+func TestSyncCreatesChoreForReopenedIssues(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke", IssueLabelBug)
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateAccepted)
+	fixture.sync(t)
+
+	if state := fixture.issueState(1); state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+
+	fixture.GitHub.SetIssueState(testOrganization, testRepo, 1, "open")
+	fixture.sync(t)
+
+	stories := fixture.stories(t, 1, 2)
+	if stories[1].Name != "reopened: something broke" || stories[1].Type != tracker.StoryTypeChore {
+		t.Errorf("unexpected story for reopened issue: %+v", stories[1])
+	}
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected reopened issue to stay open, got %s", state)
+	}
+
+	fixture.sync(t)
+
+	fixture.stories(t, 1, 2)
+
+	if state := fixture.issueState(1); state != "open" {
+		t.Fatalf("expected reopened issue to stay open, got %s", state)
+	}
+}
+
+func TestSyncDeletesDuplicateStories(t *testing.T) {
+	fixture := newSyncFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	original := fixture.stories(t, 1, 1)[0]
+
+	fixture.Tracker.AddStory(tracker.Story{
+		Name:        original.Name,
+		Description: original.Description,
+		Type:        original.Type,
+		Labels:      original.Labels,
+	})
+
+	fixture.sync(t)
+
+	stories := fixture.stories(t, 1, 1)
+	if stories[0].ID != original.ID {
+		t.Errorf("expected the original story %d to be kept, got %d", original.ID, stories[0].ID)
+	}
+}
+
+func TestSyncFlagsDuplicateStories(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.DedupePolicy = DedupePolicyLabel
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	original := fixture.stories(t, 1, 1)[0]
+
+	dupe := fixture.Tracker.AddStory(tracker.Story{
+		Name:        original.Name,
+		Description: original.Description,
+		Type:        original.Type,
+		Labels:      original.Labels,
+	})
+
+	fixture.sync(t)
+
+	flagged := fixture.Tracker.StoriesWithLabel(duplicateStoryLabel)
+	if len(flagged) != 1 || flagged[0].ID != dupe.ID {
+		t.Fatalf("expected only the dupe %d to be flagged, got %+v", dupe.ID, flagged)
+	}
+
+	fixture.stories(t, 1, 2)
+}
+
+func TestSyncMergesDuplicateStoriesOnce(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.DedupePolicy = DedupePolicyMerge
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	original := fixture.stories(t, 1, 1)[0]
+
+	dupe := fixture.Tracker.AddStory(tracker.Story{
+		Name:        original.Name,
+		Description: original.Description,
+		Type:        original.Type,
+		Labels:      original.Labels,
+	})
+
+	if _, err := fixture.Syncer.Backend.CreateStoryComment(dupe.ID, "it broke again"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a merge that copied the comment, but failed to delete the dupe
+	if err := fixture.Syncer.mergeStory(Story{Story: original}, Story{Story: dupe}); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.sync(t)
+
+	if stories := fixture.stories(t, 1, 1); stories[0].ID != original.ID {
+		t.Fatalf("expected the original story %d to be kept, got %d", original.ID, stories[0].ID)
+	}
+
+	moved := 0
+	for _, comment := range fixture.Tracker.Comments(original.ID) {
+		if strings.Contains(comment.Text, "it broke again") {
+			moved++
+		}
+	}
+
+	if moved != 1 {
+		t.Fatalf("expected the dupe's comment to be moved once, got %d copies", moved)
+	}
+}
+
+func TestSyncCapsDupeDeletionsPerSync(t *testing.T) {
+	fixture := newSyncFixture(t)
+	fixture.Syncer.MaxDupeDeletions = 1
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	fixture.sync(t)
+
+	for number := 1; number <= 2; number++ {
+		original := fixture.stories(t, number, 1)[0]
+
+		for i := 0; i < 2; i++ {
+			fixture.Tracker.AddStory(tracker.Story{
+				Name:        original.Name,
+				Description: original.Description,
+				Type:        original.Type,
+				Labels:      original.Labels,
+			})
+		}
+	}
+
+	count := func(number int) int {
+		return len(fixture.Tracker.StoriesWithLabel(issueLabel("", testOrganization, testRepo, number)))
+	}
+
+	fixture.sync(t)
+
+	if remaining := count(1) + count(2); remaining != 5 {
+		t.Fatalf("expected only one dupe to be deleted in a sync, got %d stories", remaining)
+	}
+
+	repo, err := fixture.Syncer.Source.Repo(testOrganization, testRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each webhook sync gets a cap of its own
+	for number := 1; number <= 2; number++ {
+		for count(number) > 1 {
+			before := count(number)
+
+			if err := fixture.Syncer.SyncIssue(repo, number); err != nil {
+				t.Fatalf("failed to sync issue: %s", err)
+			}
+
+			if after := count(number); after != before-1 {
+				t.Fatalf("expected a webhook sync of #%d to delete one dupe, went from %d to %d stories", number, before, after)
+			}
+		}
+	}
+}
@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"net/http"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/hashicorp/go-multierror"
@@ -18,14 +17,18 @@ var storyStateCommentTemplate = template.Must(
 	template.New("story-state").Parse(
 		`Hi there!
 
-We use Pivotal Tracker to provide visibility into what our team is working on. A story for this issue has been automatically created.
+We use {{.Tool}} to provide visibility into what our team is working on. A story for this issue has been automatically created.
 
 The current status is as follows:
 
-{{range .}}* [{{if eq .State "accepted"}}x{{else}} {{end}}] [#{{.ID}}]({{.URL}}) {{.Name}}
-{{end}}
+{{range .Stories}}* [{{if eq .State "accepted"}}x{{else}} {{end}}] [#{{.ID}}]({{.URL}}) {{.Name}}
+{{end}}{{with .PullRequests}}
+The following pull requests are related:
+
+{{range .}}* #{{.Number}}{{if .Merged}} (merged){{end}}
+{{end}}{{end}}
 
-This comment, as well as the labels on the issue, will be automatically updated as the status in Tracker changes.`,
+This comment, as well as the labels on the issue, will be automatically updated as the status in {{.Tool}} changes.`,
 	),
 )
 
@@ -37,128 +40,637 @@ All stories related to this issue have been accepted, so I'm going to automatica
 
 At the time of writing, the following stories have been accepted:
 
-{{range .}}* [#{{.ID}}]({{.URL}}) {{.Name}}
+{{range .Stories}}* [#{{.ID}}]({{.URL}}) {{.Name}}
 {{end}}
 
 If you feel there is still more to be done, or if you have any questions, leave a comment and we'll reopen if necessary!`),
 )
 
 type Syncer struct {
-	GithubClient  *github.Client
-	ProjectClient tracker.ProjectClient
+	Source  IssueSource
+	Backend StoryBackend
 
 	OrganizationName string
-	Repositories     []string
+
+	// Repositories and ExcludeRepositories are glob patterns or
+	// "topic:NAME" filters choosing which repositories to sync. All
+	// repositories are included if Repositories is empty.
+	Repositories        []string
+	ExcludeRepositories []string
+
+	// IncludePrivate syncs private and internal repositories too.
+	IncludePrivate bool
+
+	SkipArchived bool
+	SkipForks    bool
 
 	AdditionalLabels map[string]string
 
-	cachedUser *github.User
+	// StoryTypeLabels determine the type of each issue's stories, and the
+	// label written back to the issue. Defaults to defaultStoryTypeLabels.
+	StoryTypeLabels StoryTypeLabels
+
+	// StateLabels override the labels reflecting the state of each issue's
+	// stories. Unset states and fields default to those of
+	// defaultStateLabels.
+	StateLabels StateLabels
+
+	CloseIssues bool
+
+	// ClosePolicy determines when issues are closed, if CloseIssues is set.
+	// Defaults to ClosePolicyAccepted.
+	ClosePolicy ClosePolicy
+
+	// CloseGracePeriod is how long to wait after the last story was accepted
+	// before closing an issue.
+	CloseGracePeriod time.Duration
+
+	// KeepOpenLabel, if set, keeps issues with the label from being closed.
+	KeepOpenLabel string
+
+	// DedupePolicy determines what happens to duplicate stories. Defaults to
+	// DedupePolicyDelete.
+	DedupePolicy DedupePolicy
+
+	// OrphanPolicy determines what happens to stories whose issue was closed
+	// by hand, moved, or deleted, on full syncs. Defaults to
+	// OrphanPolicyIgnore.
+	OrphanPolicy OrphanPolicy
+
+	// OrphanLabel is the label given to orphaned stories by OrphanPolicyLabel.
+	// Defaults to "issue-closed".
+	OrphanLabel string
+
+	// OrphanState is the state OrphanPolicyMove moves orphaned stories to.
+	OrphanState tracker.StoryState
+
+	// MaxDupeDeletions caps the number of duplicate stories deleted in a
+	// single sync. Values below 1 mean no limit.
+	MaxDupeDeletions int
+
+	// StatusCommentTemplate and ClosedCommentTemplate override the default
+	// comments, and are rendered with CommentData.
+	StatusCommentTemplate *template.Template
+	ClosedCommentTemplate *template.Template
+
+	// LinkPullRequests scans pull requests for references to issues and
+	// stories, listing them on the issue and delivering stories once they
+	// merge. Closed pull requests are only scanned for PullRequestLookback.
+	LinkPullRequests    bool
+	PullRequestLookback time.Duration
+
+	// MirrorComments copies comments on issues onto their stories, and
+	// comments on stories tagged #public back onto their issues.
+	MirrorComments bool
+
+	// Concurrency is the number of repositories and issues to process at
+	// once. Values below 1 process them one at a time.
+	Concurrency int
+
+	// Plan, if set, causes mutations to be recorded rather than performed.
+	Plan *Plan
+
+	// State, if set, limits syncing to what has changed since the last sync,
+	// and is updated as the sync progresses.
+	State *SyncState
+
+	// FullSync syncs everything regardless of State, updating it afterwards.
+	FullSync bool
+
+	// Metrics, if set, counts the changes made while syncing.
+	Metrics *Metrics
+
+	// Logger, if set, receives everything logged while syncing. Lines about a
+	// repository, issue, or story carry fields identifying it.
+	Logger *Logger
+
+	cachedUser     *github.User
+	cachedUserLock sync.Mutex
 
-	allStories StorySet
+	cachedMembers     map[int]tracker.Person
+	nonMembers        map[int]bool
+	cachedMembersLock sync.Mutex
+
+	allStories     StorySet
+	allStoriesLock sync.RWMutex
+
+	pullRequests       map[string]PullRequestIndex
+	pullRequestCommits map[string]map[int]pullRequestCommits
+	pullRequestsLock   sync.Mutex
+
+	dupeDeletions     int
+	dupeDeletionsLock sync.Mutex
+
+	mirroredStories     map[int]mirroredStory
+	mirroredStoriesLock sync.Mutex
 }
 
 func (syncer *Syncer) SyncIssuesAndStories() error {
-	allStories, err := syncer.fetchAllStories()
+	started := time.Now()
+	before := syncer.Metrics.snapshot()
+
+	syncer.resetDupeDeletions()
+
+	defer func() {
+		syncer.Metrics.logSummary(
+			syncer.logger(),
+			before,
+			time.Since(started),
+			syncer.metricLabels()...,
+		)
+	}()
+
+	if syncer.State != nil && !syncer.FullSync {
+		version, found := syncer.State.ProjectVersion(syncer.stateKey())
+		if found {
+			return syncer.syncChangesSince(version)
+		}
+	}
+
+	return syncer.syncEverything()
+}
+
+func (syncer *Syncer) metricLabels() []string {
+	return []string{
+		"organization", syncer.OrganizationName,
+		"project", syncer.Backend.Project(),
+	}
+}
+
+func (syncer *Syncer) count(name string) {
+	syncer.Metrics.Add(name, 1, syncer.metricLabels()...)
+}
+
+func (syncer *Syncer) logger() *Logger {
+	return syncer.Logger.With("organization", syncer.OrganizationName)
+}
+
+func (syncer *Syncer) repoLogger(repo *Repository) *Logger {
+	return syncer.logger().With("repo", *repo.Owner.Login+"/"+*repo.Name)
+}
+
+func (syncer *Syncer) issueLogger(repo *Repository, issue *github.Issue) *Logger {
+	return syncer.repoLogger(repo).With(
+		"issue", *issue.Number,
+		"tracker_label", syncer.trackerLabelForIssue(repo, issue),
+	)
+}
+
+func (syncer *Syncer) syncEverything() error {
+	var latestVersion int
+	if syncer.State != nil {
+		var err error
+		latestVersion, err = syncer.Backend.LatestVersion()
+		if err != nil {
+			return fmt.Errorf("failed to fetch project version: %s", err)
+		}
+	}
+
+	allStories, err := syncer.Backend.AllStories()
 	if err != nil {
 		return fmt.Errorf("failed to fetch stories: %s", err)
 	}
 
+	syncer.allStoriesLock.Lock()
 	syncer.allStories = allStories
+	syncer.allStoriesLock.Unlock()
+
+	err = syncer.syncRepos(func(repo *Repository, workers *pool) error {
+		var issues []*github.Issue
+		err := workers.Run(func() error {
+			var err error
+			issues, err = syncer.Source.Issues(repo, time.Time{})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch issues for %s: %s", *repo.Name, err)
+		}
+
+		return syncer.processRepoIssues(repo, issues, workers, func(label string) (StorySet, error) {
+			return syncer.storiesWithLabel(label), nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	syncer.reconcileOrphans()
+
+	if syncer.State != nil {
+		syncer.State.SetProjectVersion(syncer.stateKey(), latestVersion)
+	}
+
+	return nil
+}
+
+// syncChangesSince only syncs issues that have been updated since the last
+// sync, along with issues whose stories have changed since the given project
+// version.
+func (syncer *Syncer) syncChangesSince(version int) error {
+	changedStoryIDs, latestVersion, err := syncer.Backend.ChangedSince(version)
+	if err != nil {
+		syncer.logger().Error("failed to fetch activity; syncing everything", err, "version", version)
+		return syncer.syncEverything()
+	}
+
+	syncer.logger().Info("fetched changed stories", "count", len(changedStoryIDs), "version", version)
+
+	changedStories, err := syncer.Backend.StoriesByID(changedStoryIDs)
+	if err != nil {
+		return fmt.Errorf("failed to fetch changed stories: %s", err)
+	}
+
+	var issueLabels []string
+	for _, story := range changedStories {
+		for _, storyLabel := range story.Labels {
+			issueLabels = append(issueLabels, storyLabel.Name)
+		}
+	}
+
+	// issues waiting to be closed need revisiting even if nothing changed
+	issueLabels = append(issueLabels, syncer.State.PendingCloses(syncer.stateKey())...)
+
+	changedIssues := map[string][]int{}
+	for _, issueLabel := range issueLabels {
+		host, owner, repoName, number, ok := parseIssueLabel(issueLabel)
+		if ok && host == syncer.Source.Host() {
+			changedIssues[owner+"/"+repoName] = append(changedIssues[owner+"/"+repoName], number)
+		}
+	}
 
-	repos, err := syncer.reposToSync()
+	err = syncer.syncRepos(func(repo *Repository, workers *pool) error {
+		repoName := *repo.Owner.Login + "/" + *repo.Name
+
+		var issues []*github.Issue
+		err := workers.Run(func() error {
+			var err error
+			issues, err = syncer.Source.Issues(repo, syncer.State.RepositoryUpdatedAt(syncer.stateKey(), repoName))
+			if err != nil {
+				return err
+			}
+
+			issues, err = syncer.withIssues(repo, issues, changedIssues[repoName])
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch issues for %s: %s", *repo.Name, err)
+		}
+
+		return syncer.processRepoIssues(repo, issues, workers, func(label string) (StorySet, error) {
+			return syncer.Backend.StoriesWithLabel(label)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	syncer.State.SetProjectVersion(syncer.stateKey(), latestVersion)
+
+	return nil
+}
+
+// syncRepos calls processRepo for each repository to sync, after making sure
+// the repository has the stock labels.
+func (syncer *Syncer) syncRepos(processRepo func(*Repository, *pool) error) error {
+	allRepos, err := syncer.Source.Repos(syncer.OrganizationName, syncer.IncludePrivate)
 	if err != nil {
 		return fmt.Errorf("failed to fetch repos: %s", err)
 	}
 
-	var multiErr *multierror.Error
+	var repos []*Repository
+	for _, repo := range allRepos {
+		if syncer.shouldSync(repo) {
+			repos = append(repos, repo)
+		}
+	}
 
-	for _, repo := range repos {
+	workers := newPool(syncer.Concurrency)
+
+	errs := workers.Each(len(repos), func(i int) error {
+		repo := repos[i]
 		repoName := *repo.Owner.Login + "/" + *repo.Name
 
-		log.Println("syncing", repoName)
+		logger := syncer.repoLogger(repo)
 
-		if err := syncer.syncRepoStockLabels(repo); err != nil {
-			log.Printf("failed setting up labels; skipping %s: %s\n", repoName, err)
-			continue
+		logger.Info("syncing repo")
+
+		started := time.Now()
+		defer func() {
+			syncer.Metrics.Set(MetricRepoSyncDuration, time.Since(started).Seconds(), "repo", repoName)
+		}()
+
+		err := workers.Run(func() error {
+			return syncer.syncRepoStockLabels(repo)
+		})
+		if err != nil {
+			logger.Error("failed setting up labels; skipping repo", err)
+			return nil
 		}
 
-		if err := syncer.processRepoIssues(repo); err != nil {
-			log.Println("syncing failed:", err.Error())
+		var repoErr *multierror.Error
 
-			multiErr = multierror.Append(
-				multiErr,
-				fmt.Errorf("errors when processing %s: %s", repoName, err),
-			)
+		if syncer.LinkPullRequests {
+			err := workers.Run(func() error {
+				return syncer.syncPullRequests(repo)
+			})
+			if err != nil {
+				logger.Error("failed to sync pull requests", err)
+				repoErr = multierror.Append(repoErr, fmt.Errorf("failed to sync pull requests: %s", err))
+			}
 		}
+
+		if err := processRepo(repo, workers); err != nil {
+			logger.Error("syncing failed", err)
+			repoErr = multierror.Append(repoErr, err)
+		}
+
+		if repoErr.ErrorOrNil() != nil {
+			return fmt.Errorf("errors when processing %s: %s", repoName, repoErr)
+		}
+
+		return nil
+	})
+
+	var multiErr *multierror.Error
+	for _, err := range errs {
+		multiErr = multierror.Append(multiErr, err)
 	}
 
 	return multiErr.ErrorOrNil()
 }
 
-func (syncer *Syncer) fetchAllStories() ([]tracker.Story, error) {
-	var allStories StorySet
+// withIssues adds the given open issues to the set of issues, fetching any
+// that aren't already present.
+func (syncer *Syncer) withIssues(repo *Repository, issues []*github.Issue, numbers []int) ([]*github.Issue, error) {
+	present := map[int]bool{}
+	for _, issue := range issues {
+		present[*issue.Number] = true
+	}
 
-	query := tracker.StoriesQuery{}
+	for _, number := range numbers {
+		if present[number] {
+			continue
+		}
 
-	for {
-		stories, _, err := syncer.ProjectClient.Stories(query)
+		issue, err := syncer.Source.Issue(repo, number)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to fetch issue #%d: %s", number, err)
 		}
 
-		if len(stories) == 0 {
-			break
+		present[number] = true
+
+		if *issue.State == "open" {
+			issues = append(issues, issue)
+		} else {
+			// closed by someone else while waiting to be closed
+			syncer.setPendingClose(repo, issue, false)
 		}
+	}
 
-		allStories = append(allStories, stories...)
+	return issues, nil
+}
 
-		query.Offset = len(allStories)
-	}
+// SyncIssue syncs a single issue with the stories currently labelled for it,
+// without walking the rest of the organization.
+func (syncer *Syncer) SyncIssue(repo *Repository, number int) error {
+	syncer.resetDupeDeletions()
 
-	return allStories, nil
+	return syncer.syncIssue(repo, number)
 }
 
-func (syncer *Syncer) processRepoIssues(repo *github.Repository) error {
-	issues, err := syncer.allIssues(repo)
+func (syncer *Syncer) syncIssue(repo *Repository, number int) error {
+	if !syncer.shouldSync(repo) {
+		return nil
+	}
+
+	issue, err := syncer.Source.Issue(repo, number)
 	if err != nil {
-		return fmt.Errorf("failed to fetch issues for %s: %s", *repo.Name, err)
+		if isGone(err) {
+			syncer.repoLogger(repo).Info("skipping issue that is gone", "issue", number)
+			return nil
+		}
+
+		return fmt.Errorf("failed to fetch issue: %s", err)
 	}
 
-	var multiErr *multierror.Error
+	label := syncer.trackerLabelForIssue(repo, issue)
+
+	if *issue.State != "open" {
+		syncer.issueLogger(repo, issue).Info("skipping issue", "state", *issue.State)
+		return nil
+	}
+
+	issueStories, err := syncer.Backend.StoriesWithLabel(label)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stories for %s: %s", label, err)
+	}
+
+	return syncer.ensureStoryExistsForIssue(repo, issue, label, issueStories)
+}
+
+// SyncPullRequest re-indexes the repository's pull requests after one has
+// changed, and syncs the issues that it references.
+func (syncer *Syncer) SyncPullRequest(repo *Repository, number int) error {
+	if !syncer.shouldSync(repo) {
+		return nil
+	}
+
+	syncer.resetDupeDeletions()
+
+	issues := []int{number}
+
+	if syncer.LinkPullRequests {
+		if err := syncer.syncPullRequests(repo); err != nil {
+			return fmt.Errorf("failed to sync pull requests: %s", err)
+		}
+
+		syncer.pullRequestsLock.Lock()
+		for _, pr := range syncer.pullRequests[*repo.Owner.Login+"/"+*repo.Name] {
+			if pr.Number == number {
+				issues = append(issues, pr.Issues...)
+			}
+		}
+		syncer.pullRequestsLock.Unlock()
+	}
 
 	for _, issue := range issues {
-		label := trackerLabelForIssue(repo, issue)
+		if err := syncer.syncIssue(repo, issue); err != nil {
+			return err
+		}
+	}
 
-		err := syncer.ensureStoryExistsForIssue(repo, issue, label)
-		if err != nil {
-			multiErr = multierror.Append(
-				multiErr,
-				fmt.Errorf("failed to create story for issue %s: %s", label, err),
-			)
+	return nil
+}
+
+// SyncStoryChange reflects a change to a story in Tracker onto the issue it is
+// labelled for, without creating or modifying any stories.
+func (syncer *Syncer) SyncStoryChange(storyID int) error {
+	stories, err := syncer.Backend.StoriesByID([]int{storyID})
+	if err != nil {
+		return fmt.Errorf("failed to fetch story %d: %s", storyID, err)
+	}
+
+	for _, story := range stories {
+		for _, storyLabel := range story.Labels {
+			host, owner, repoName, number, ok := parseIssueLabel(storyLabel.Name)
+			if !ok || host != syncer.Source.Host() {
+				continue
+			}
+
+			if !inOrganization(owner, syncer.OrganizationName) {
+				continue
+			}
+
+			// the label only names the repository; fetch the rest to see
+			// whether it should be synced
+			repo, err := syncer.Source.Repo(owner, repoName)
+			if err != nil {
+				return fmt.Errorf("failed to fetch repository %s/%s: %s", owner, repoName, err)
+			}
+
+			if !syncer.shouldSync(repo) {
+				continue
+			}
+
+			if err := syncer.syncIssueFromTracker(repo, number); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (syncer *Syncer) syncIssueFromTracker(repo *Repository, number int) error {
+	issue, err := syncer.Source.Issue(repo, number)
+	if err != nil {
+		if isGone(err) {
+			syncer.repoLogger(repo).Info("skipping issue that is gone", "issue", number)
+			return nil
 		}
+
+		return fmt.Errorf("failed to fetch issue: %s", err)
+	}
+
+	label := syncer.trackerLabelForIssue(repo, issue)
+
+	if *issue.State != "open" {
+		syncer.issueLogger(repo, issue).Info("skipping issue", "state", *issue.State)
+		return nil
+	}
+
+	issueStories, err := syncer.Backend.StoriesWithLabel(label)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stories for %s: %s", label, err)
+	}
+
+	issueStories, _ = issueStories.WithoutLabel(duplicateStoryLabel).Dedupe()
+
+	comments, err := syncer.Source.Comments(repo, *issue.Number)
+	if err != nil {
+		return fmt.Errorf("failed to fetch issue comments: %s", err)
+	}
+
+	syncer.issueLogger(repo, issue).Info("syncing issue from tracker")
+
+	return syncer.syncIssueWithStories(repo, issue, label, issueStories, comments)
+}
+
+// SyncRepoLabels ensures the stock labels exist on a single repository.
+func (syncer *Syncer) SyncRepoLabels(repo *Repository) error {
+	if !syncer.shouldSync(repo) {
+		return nil
+	}
+
+	return syncer.syncRepoStockLabels(repo)
+}
+
+func (syncer *Syncer) processRepoIssues(
+	repo *Repository,
+	issues []*github.Issue,
+	workers *pool,
+	storiesFor func(string) (StorySet, error),
+) error {
+	errs := workers.Each(len(issues), func(i int) error {
+		issue := issues[i]
+		label := syncer.trackerLabelForIssue(repo, issue)
+
+		return workers.Run(func() error {
+			issueStories, err := storiesFor(label)
+			if err != nil {
+				return fmt.Errorf("failed to fetch stories for issue %s: %s", label, err)
+			}
+
+			err = syncer.ensureStoryExistsForIssue(repo, issue, label, issueStories)
+			if err != nil {
+				return fmt.Errorf("failed to create story for issue %s: %s", label, err)
+			}
+
+			return nil
+		})
+	})
+
+	var multiErr *multierror.Error
+	for _, err := range errs {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	if multiErr.ErrorOrNil() == nil && syncer.State != nil {
+		syncer.recordRepoProgress(repo, issues)
 	}
 
 	return multiErr.ErrorOrNil()
 }
 
-func (syncer *Syncer) syncRepoStockLabels(repo *github.Repository) error {
+// recordRepoProgress remembers the latest update to the repo's issues, so
+// that the next incremental sync only lists issues updated since.
+func (syncer *Syncer) recordRepoProgress(repo *Repository, issues []*github.Issue) {
+	repoName := *repo.Owner.Login + "/" + *repo.Name
+
+	latest := syncer.State.RepositoryUpdatedAt(syncer.stateKey(), repoName)
+	for _, issue := range issues {
+		if issue.UpdatedAt.After(latest) {
+			latest = *issue.UpdatedAt
+		}
+	}
+
+	syncer.State.SetRepositoryUpdatedAt(syncer.stateKey(), repoName, latest)
+}
+
+func (syncer *Syncer) stateKey() string {
+	organization := syncer.OrganizationName
+	if host := syncer.Source.Host(); host != "" {
+		organization = host + "/" + organization
+	}
+
+	return organization + ":" + syncer.Backend.Project()
+}
+
+func (syncer *Syncer) storiesWithLabel(label string) StorySet {
+	syncer.allStoriesLock.RLock()
+	defer syncer.allStoriesLock.RUnlock()
+
+	return syncer.allStories.WithLabel(label)
+}
+
+func (syncer *Syncer) syncRepoStockLabels(repo *Repository) error {
 	logName := *repo.Owner.Login + "/" + *repo.Name
 
-	existingLabels, _, err := syncer.GithubClient.Issues.ListLabels(
-		context.TODO(),
-		*repo.Owner.Login,
-		*repo.Name,
-		&github.ListOptions{},
-	)
+	existingLabels, err := syncer.Source.Labels(repo)
 	if err != nil {
 		return fmt.Errorf("failed to list labels for %s: %s", logName, err)
 	}
 
 	missingLabels := map[string]string{}
-	for label, color := range storyStateLabels {
+	for label, color := range syncer.stateLabels().Colors() {
 		missingLabels[label] = color
 	}
 
+	for _, typeLabel := range syncer.storyTypeLabels() {
+		// respect original github colors
+		missingLabels[typeLabel.Label] = ""
+	}
+
 	for label, color := range issueOnlyLabels {
 		missingLabels[label] = color
 	}
@@ -187,37 +699,30 @@ func (syncer *Syncer) syncRepoStockLabels(repo *github.Repository) error {
 			continue
 		}
 
-		log.Printf("updating label '%s' in repo %s\n", *label.Name, logName)
+		syncer.repoLogger(repo).Info("updating label", "label", *label.Name, "color", color)
 
-		_, _, err := syncer.GithubClient.Issues.EditLabel(
-			context.TODO(),
-			*repo.Owner.Login,
-			*repo.Name,
-			*label.Name,
-			&github.Label{
-				Name:  label.Name,
-				Color: &color,
-			},
-		)
+		if syncer.Plan != nil {
+			syncer.Plan.Record(ActionUpdateRepoLabel, logName, *label.Name+" ("+color+")")
+			continue
+		}
+
+		err := syncer.Source.EditLabel(repo, *label.Name, color)
 		if err != nil {
 			return fmt.Errorf("failed to update label '%s' in %s: %s", *label.Name, logName, err)
 		}
 	}
 
 	for name, color := range missingLabels {
-		log.Printf("creating label '%s' with color '%s' in repo %s\n", name, color, logName)
+		syncer.repoLogger(repo).Info("creating label", "label", name, "color", color)
 
 		color = strings.TrimLeft(color, "#")
 
-		_, _, err := syncer.GithubClient.Issues.CreateLabel(
-			context.TODO(),
-			*repo.Owner.Login,
-			*repo.Name,
-			&github.Label{
-				Name:  &name,
-				Color: &color,
-			},
-		)
+		if syncer.Plan != nil {
+			syncer.Plan.Record(ActionCreateRepoLabel, logName, name+" ("+color+")")
+			continue
+		}
+
+		err := syncer.Source.CreateLabel(repo, name, color)
 		if err != nil {
 			return fmt.Errorf("failed to create label '%s' in %s: %s", name, logName, err)
 		}
@@ -227,48 +732,53 @@ func (syncer *Syncer) syncRepoStockLabels(repo *github.Repository) error {
 }
 
 func (syncer *Syncer) ensureStoryExistsForIssue(
-	repo *github.Repository,
+	repo *Repository,
 	issue *github.Issue,
 	label string,
+	issueStories StorySet,
 ) error {
-	log.Printf("syncing %s: %s\n", label, *issue.Title)
+	logger := syncer.issueLogger(repo, issue)
 
-	issueStories := syncer.allStories.WithLabel(label)
+	logger.Info("syncing issue", "title", *issue.Title)
 
-	issueStories, dupes := issueStories.Dedupe()
-	for _, dupe := range dupes {
-		log.Println("removing dupe:", dupe.ID)
-		err := syncer.ProjectClient.DeleteStory(dupe.ID)
-		if err != nil {
-			log.Println("failed to remove dupe:", dupe.ID)
-		}
+	issueStories, dupes := issueStories.WithoutLabel(duplicateStoryLabel).Dedupe()
+
+	syncer.removeDupes(logger, label, issueStories, dupes)
+
+	comments, err := syncer.Source.Comments(repo, *issue.Number)
+	if err != nil {
+		return fmt.Errorf("failed to fetch issue comments: %s", err)
 	}
 
 	if len(issueStories) == 0 {
 		// no stories for the issue yet; create an initial one
 
+		if issue.PullRequestLinks != nil {
+			logger.Debug("issue has pull request", "pull_request", pullRequestURL(issue.PullRequestLinks))
+		}
+
 		story := choreForNewIssue(label, issue)
 
-		createdStory, err := syncer.ProjectClient.CreateStory(story)
+		createdStory, err := syncer.createStory(story)
 		if err != nil {
 			return fmt.Errorf("failed to create story for %s: %s", label, err)
 		}
 
-		log.Println("created story for", label, "at", createdStory.URL)
+		logger.Info("created story", "story", createdStory.ID, "url", createdStory.URL)
 
 		issueStories = append(issueStories, createdStory)
 
-	} else if issueStories.AllAccepted() && issue.UpdatedAt.After(issueStories.LastAccepted()) {
-		// issue has been reopened
-
+	} else if reopened, err := syncer.wasReopened(repo, issue, issueStories, comments); err != nil {
+		return fmt.Errorf("failed to check whether %s was reopened: %s", label, err)
+	} else if reopened {
 		story := choreForReopenedIssue(label, issue)
 
-		createdStory, err := syncer.ProjectClient.CreateStory(story)
+		createdStory, err := syncer.createStory(story)
 		if err != nil {
 			return fmt.Errorf("failed to create story for %s: %s", label, err)
 		}
 
-		log.Println("created chore for reopening of", label, "at", createdStory.URL)
+		logger.Info("created chore for reopened issue", "story", createdStory.ID, "url", createdStory.URL)
 
 		issueStories = append(issueStories, createdStory)
 	}
@@ -276,7 +786,7 @@ func (syncer *Syncer) ensureStoryExistsForIssue(
 	if len(issueStories) == 1 && (issueStories.Untriaged() || issueStories.Unscheduled()) {
 		story := issueStories[0]
 
-		syncedStory, err := syncer.syncStoryFromIssue(story, issue)
+		syncedStory, err := syncer.syncStoryFromIssue(logger, story, issue)
 		if err != nil {
 			return fmt.Errorf("failed to sync story type for %d: %s", story.ID, err)
 		}
@@ -285,44 +795,99 @@ func (syncer *Syncer) ensureStoryExistsForIssue(
 	}
 
 	if issue.PullRequestLinks != nil && !issueStories.HasPR() {
-		if err := syncer.setHasPR(issueStories); err != nil {
+		if err := syncer.setHasPR(logger, issueStories); err != nil {
 			return fmt.Errorf("failed to set has-pr label for stories: %s", err)
 		}
 	} else if issue.PullRequestLinks == nil && issueStories.HasPR() {
-		if err := syncer.unsetHasPR(issueStories); err != nil {
+		if err := syncer.unsetHasPR(logger, issueStories); err != nil {
 			return fmt.Errorf("failed to remove has-pr label for stories: %s", err)
 		}
 	}
 
-	if err := syncer.ensureCommentWithStories(repo, issue, issueStories); err != nil {
+	return syncer.syncIssueWithStories(repo, issue, label, issueStories, comments)
+}
+
+// syncIssueWithStories reflects the state of the issue's stories onto the
+// issue itself, via its status comment and labels, closing it if everything
+// has been accepted. comments are the issue's comments, fetched once for all
+// of this.
+func (syncer *Syncer) syncIssueWithStories(
+	repo *Repository,
+	issue *github.Issue,
+	label string,
+	issueStories StorySet,
+	comments []*github.IssueComment,
+) error {
+	if err := syncer.ensureCommentWithStories(repo, issue, issueStories, comments); err != nil {
 		return fmt.Errorf("failed to upsert comment for stories: %s", err)
 	}
 
-	if err := syncer.syncIssueLabels(repo, issue, issueStories.IssueLabels()); err != nil {
-		return fmt.Errorf("failed to sync story labels: %s", err)
+	if syncer.MirrorComments {
+		if err := syncer.mirrorComments(repo, issue, issueStories, comments); err != nil {
+			return fmt.Errorf("failed to mirror comments: %s", err)
+		}
+	}
+
+	labels, err := issueStories.IssueLabels(syncer.storyTypeLabels(), syncer.stateLabels())
+	if err != nil {
+		return fmt.Errorf("failed to determine story labels: %s", err)
 	}
 
-	if issueStories.AllAccepted() {
-		log.Println("all stories for", label, "are accepted; closing!")
+	if err := syncer.syncIssueLabels(repo, issue, labels); err != nil {
+		return fmt.Errorf("failed to sync story labels: %s", err)
+	}
 
-		err := syncer.closeIssue(repo, issue, issueStories)
-		if err != nil {
-			return fmt.Errorf("failed to close issue: %s", err)
-		}
+	if err := syncer.maybeCloseIssue(repo, issue, issueStories, comments); err != nil {
+		return fmt.Errorf("failed to close issue: %s", err)
 	}
 
 	return nil
 }
 
-func (syncer *Syncer) setHasPR(stories StorySet) error {
+func (syncer *Syncer) createStory(story Story) (Story, error) {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionCreateStory, story.Labels[0].Name, fmt.Sprintf("%s '%s'", story.Type, story.Name))
+		return story, nil
+	}
+
+	created, err := syncer.Backend.CreateStory(story)
+	if err != nil {
+		return created, err
+	}
+
+	syncer.count(MetricStoriesCreated)
+
+	return created, nil
+}
+
+func (syncer *Syncer) setStoryState(story Story, state tracker.StoryState) (Story, error) {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionSetStoryState, fmt.Sprintf("#%d", story.ID), string(state))
+		story.State = state
+		return story, nil
+	}
+
+	return syncer.Backend.SetStoryState(story.ID, state)
+}
+
+func (syncer *Syncer) addStoryLabel(story Story, label string) error {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionAddStoryLabel, fmt.Sprintf("#%d", story.ID), label)
+		return nil
+	}
+
+	return syncer.Backend.AddStoryLabel(story.ID, label)
+}
+
+func (syncer *Syncer) setHasPR(logger *Logger, stories StorySet) error {
 	for _, story := range stories {
 		if (StorySet{story}).HasPR() {
 			continue
 		}
 
-		log.Printf("adding has-pr label to #%d\n", story.ID)
+		logger.Info("adding has-pr label", "story", story.ID)
 
-		_, err := syncer.ProjectClient.AddStoryLabel(story.ID, "has-pr")
+		err := syncer.addStoryLabel(story, "has-pr")
 		if err != nil {
 			return err
 		}
@@ -331,7 +896,7 @@ func (syncer *Syncer) setHasPR(stories StorySet) error {
 	return nil
 }
 
-func (syncer *Syncer) unsetHasPR(stories StorySet) error {
+func (syncer *Syncer) unsetHasPR(logger *Logger, stories StorySet) error {
 	for _, story := range stories {
 		if !(StorySet{story}).HasPR() {
 			continue
@@ -339,9 +904,14 @@ func (syncer *Syncer) unsetHasPR(stories StorySet) error {
 
 		for _, label := range story.Labels {
 			if label.Name == "has-pr" {
-				log.Printf("removing has-pr label from #%d\n", story.ID)
+				logger.Info("removing has-pr label", "story", story.ID)
+
+				if syncer.Plan != nil {
+					syncer.Plan.Record(ActionRemoveStoryLabel, fmt.Sprintf("#%d", story.ID), label.Name)
+					continue
+				}
 
-				err := syncer.ProjectClient.RemoveStoryLabel(story.ID, label.ID)
+				err := syncer.Backend.RemoveStoryLabel(story.ID, label)
 				if err != nil {
 					return err
 				}
@@ -353,178 +923,203 @@ func (syncer *Syncer) unsetHasPR(stories StorySet) error {
 }
 
 func (syncer *Syncer) ensureCommentWithStories(
-	repo *github.Repository,
+	repo *Repository,
 	issue *github.Issue,
-	issueStories []tracker.Story,
+	issueStories []Story,
+	comments []*github.IssueComment,
 ) error {
-	comments, err := syncer.allCommentsForIssue(repo, issue)
+	existingComment, err := syncer.statusComment(comments)
 	if err != nil {
-		return fmt.Errorf("failed to fetch issue comments: %s", err)
+		return err
 	}
 
-	currentUser, err := syncer.currentUser()
+	commentBody, err := syncer.renderComment(syncer.statusCommentTemplate(), repo, issue, issueStories)
 	if err != nil {
-		return fmt.Errorf("failed to get current user: %s", err)
+		return fmt.Errorf("error building comment body: %s", err)
 	}
 
-	var existingComment *github.IssueComment
-	for _, comment := range comments {
-		if *comment.User.ID == *currentUser.ID {
-			existingComment = comment
-			break
+	if syncer.Plan != nil {
+		target := syncer.trackerLabelForIssue(repo, issue)
+
+		if existingComment == nil {
+			syncer.Plan.Record(ActionCreateComment, target, "story status")
+		} else if *existingComment.Body != commentBody {
+			syncer.Plan.Record(ActionEditComment, target, *existingComment.HTMLURL)
 		}
-	}
 
-	buf := new(bytes.Buffer)
-	if err := storyStateCommentTemplate.Execute(buf, issueStories); err != nil {
-		return fmt.Errorf("error building comment body: %s", err)
+		return nil
 	}
 
-	commentBody := buf.String()
-
 	if existingComment == nil {
-		createdComment, _, err := syncer.GithubClient.Issues.CreateComment(
-			context.TODO(),
-			*repo.Owner.Login,
-			*repo.Name,
-			*issue.Number,
-			&github.IssueComment{Body: &commentBody},
-		)
+		createdComment, err := syncer.Source.CreateComment(repo, *issue.Number, commentBody)
 		if err != nil {
 			return fmt.Errorf("failed to create comment: %s", err)
 		}
 
-		log.Println("created comment:", *createdComment.HTMLURL)
+		syncer.count(MetricCommentsCreated)
+
+		syncer.issueLogger(repo, issue).Info("created comment", "url", *createdComment.HTMLURL)
 	} else if *existingComment.Body != commentBody {
 		existingComment.Body = &commentBody
 
-		updatedComment, _, err := syncer.GithubClient.Issues.EditComment(
-			context.TODO(),
-			*repo.Owner.Login,
-			*repo.Name,
-			*existingComment.ID,
-			&github.IssueComment{Body: &commentBody},
-		)
+		updatedComment, err := syncer.Source.EditComment(repo, *issue.Number, *existingComment.ID, commentBody)
 		if err != nil {
 			return fmt.Errorf("failed to update comment: %s", err)
 		}
 
-		log.Println("updated comment:", *updatedComment.HTMLURL)
+		syncer.count(MetricCommentsUpdated)
+
+		syncer.issueLogger(repo, issue).Info("updated comment", "url", *updatedComment.HTMLURL)
 	}
 
 	return nil
 }
 
-func (syncer *Syncer) syncIssueLabels(
-	repo *github.Repository,
-	issue *github.Issue,
-	labels []string,
-) error {
-	existingLabels := map[string]bool{}
-	for _, label := range issue.Labels {
-		existingLabels[*label.Name] = true
-	}
-
-	labelsToAdd := []string{}
-	for _, label := range labels {
-		if !existingLabels[label] {
-			labelsToAdd = append(labelsToAdd, label)
-		}
+// statusComment returns the comment listing the issue's stories from among its
+// comments, if it has been left yet.
+func (syncer *Syncer) statusComment(comments []*github.IssueComment) (*github.IssueComment, error) {
+	currentUser, err := syncer.currentUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current user: %s", err)
 	}
 
-	labelsToRemove := []string{}
-	for stockLabel, _ := range storyStateLabels {
-		if !existingLabels[stockLabel] {
+	for _, comment := range comments {
+		if *comment.User.ID != *currentUser.ID {
 			continue
 		}
 
-		stillHasLabel := false
-		for _, label := range labels {
-			if label == stockLabel {
-				stillHasLabel = true
-				break
-			}
+		if isClosedComment(*comment.Body) || isClosingComment(*comment.Body) {
+			continue
 		}
 
-		if !stillHasLabel {
-			labelsToRemove = append(labelsToRemove, stockLabel)
+		if _, _, mirrored := mirroredCommentSource(*comment.Body); !mirrored {
+			return comment, nil
 		}
 	}
 
+	return nil, nil
+}
+
+func (syncer *Syncer) syncIssueLabels(
+	repo *Repository,
+	issue *github.Issue,
+	labels []string,
+) error {
+	labelsToAdd, labelsToRemove := syncer.issueLabelChanges(issue, labels)
+
 	if len(labelsToRemove) == 0 && len(labelsToAdd) == 0 {
 		return nil
 	}
 
-	log.Println("setting issue labels:", strings.Join(labels, ", "))
+	syncer.issueLogger(repo, issue).Info("setting issue labels", "labels", strings.Join(labels, ","))
+
+	if syncer.Plan != nil {
+		target := syncer.trackerLabelForIssue(repo, issue)
+
+		for _, label := range labelsToRemove {
+			syncer.Plan.Record(ActionRemoveIssueLabel, target, label)
+		}
+
+		if len(labelsToAdd) > 0 {
+			syncer.Plan.Record(ActionAddIssueLabels, target, strings.Join(labelsToAdd, ", "))
+		}
+
+		return nil
+	}
 
 	for _, label := range labelsToRemove {
-		_, err := syncer.GithubClient.Issues.RemoveLabelForIssue(
-			context.TODO(),
-			*repo.Owner.Login,
-			*repo.Name,
-			*issue.Number,
-			label,
-		)
-		if err != nil && !strings.Contains(err.Error(), "404") {
+		err := syncer.Source.RemoveIssueLabel(repo, *issue.Number, label)
+		if err != nil && responseStatus(err) != http.StatusNotFound {
 			return fmt.Errorf("failed to remove label '%s': %s", label, err)
 		}
+
+		if err == nil {
+			syncer.count(MetricIssueLabelsRemoved)
+		}
 	}
 
-	_, _, err := syncer.GithubClient.Issues.AddLabelsToIssue(
-		context.TODO(),
-		*repo.Owner.Login,
-		*repo.Name,
-		*issue.Number,
-		labelsToAdd,
-	)
+	err := syncer.Source.AddIssueLabels(repo, *issue.Number, labelsToAdd)
 	if err != nil {
 		return fmt.Errorf("failed to add labels to issue: %s", err)
 	}
 
+	syncer.Metrics.Add(MetricIssueLabelsAdded, float64(len(labelsToAdd)), syncer.metricLabels()...)
+
 	return nil
 }
 
-func (syncer *Syncer) closeIssue(
-	repo *github.Repository,
-	issue *github.Issue,
-	stories StorySet,
-) error {
-	buf := new(bytes.Buffer)
-	if err := issueClosedCommentTemplate.Execute(buf, stories); err != nil {
-		return fmt.Errorf("error building comment body: %s", err)
+// issueLabelChanges returns the labels to add to and remove from the issue so
+// that it has the given labels. Existing type labels for a wanted type are
+// kept rather than swapped for another.
+func (syncer *Syncer) issueLabelChanges(issue *github.Issue, labels []string) ([]string, []string) {
+	typeLabels := syncer.storyTypeLabels()
+	stateLabels := syncer.stateLabels()
+
+	existingLabels := map[string]bool{}
+	existingTypes := map[tracker.StoryType]bool{}
+	for _, label := range issue.Labels {
+		existingLabels[*label.Name] = true
+
+		if storyType, found := typeLabels.TypeOf(*label.Name); found {
+			existingTypes[storyType] = true
+		}
 	}
 
-	closedMessage := buf.String()
+	labelsToAdd := []string{}
+	keepTypes := map[tracker.StoryType]bool{}
+	for _, label := range labels {
+		storyType, isTypeLabel := typeLabels.TypeOf(label)
+		if isTypeLabel {
+			keepTypes[storyType] = true
+		}
 
-	_, _, err := syncer.GithubClient.Issues.CreateComment(
-		context.TODO(),
-		*repo.Owner.Login,
-		*repo.Name,
-		*issue.Number,
-		&github.IssueComment{Body: &closedMessage},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to leave closed message: %s", err)
+		if existingLabels[label] {
+			continue
+		}
+
+		// any label for the type will do; don't pile on another
+		if isTypeLabel && existingTypes[storyType] {
+			continue
+		}
+
+		labelsToAdd = append(labelsToAdd, label)
 	}
 
-	state := "closed"
-	_, _, err = syncer.GithubClient.Issues.Edit(
-		context.TODO(),
-		*repo.Owner.Login,
-		*repo.Name,
-		*issue.Number,
-		&github.IssueRequest{State: &state},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to close issue: %s", err)
+	labelsToRemove := []string{}
+	for _, label := range issue.Labels {
+		isStockLabel := stateLabels.IsStateLabel(*label.Name)
+		storyType, isTypeLabel := typeLabels.TypeOf(*label.Name)
+
+		if isTypeLabel && keepTypes[storyType] {
+			continue
+		}
+
+		if !isStockLabel && !isTypeLabel {
+			continue
+		}
+
+		stillHasLabel := false
+		for _, wanted := range labels {
+			if wanted == *label.Name {
+				stillHasLabel = true
+				break
+			}
+		}
+
+		if !stillHasLabel {
+			labelsToRemove = append(labelsToRemove, *label.Name)
+		}
 	}
 
-	return err
+	return labelsToAdd, labelsToRemove
 }
 
 func (syncer *Syncer) currentUser() (*github.User, error) {
+	syncer.cachedUserLock.Lock()
+	defer syncer.cachedUserLock.Unlock()
+
 	if syncer.cachedUser == nil {
-		user, _, err := syncer.GithubClient.Users.Get(context.TODO(), "")
+		user, err := syncer.Source.CurrentUser()
 		if err != nil {
 			return nil, err
 		}
@@ -535,42 +1130,46 @@ func (syncer *Syncer) currentUser() (*github.User, error) {
 	return syncer.cachedUser, nil
 }
 
-func (syncer *Syncer) syncStoryFromIssue(story tracker.Story, issue *github.Issue) (tracker.Story, error) {
-	storyType := issueStoryType(issue)
+func (syncer *Syncer) syncStoryFromIssue(logger *Logger, story Story, issue *github.Issue) (Story, error) {
+	logger = logger.With("story", story.ID)
+
+	storyType := syncer.storyTypeLabels().StoryType(issue)
 
 	var err error
 
 	if story.State == tracker.StoryStateStarted && story.Type == tracker.StoryTypeChore && storyType != tracker.StoryTypeChore {
-		log.Println("moving story to icebox...")
+		logger.Info("moving story to icebox")
 
-		story, err = syncer.ProjectClient.UnscheduleStory(story.ID)
+		story, err = syncer.unscheduleStory(story)
 		if err != nil {
-			return tracker.Story{}, err
+			return Story{}, err
 		}
 	}
 
 	if story.Type != storyType {
-		log.Printf("updating story type to '%s'...\n", storyType)
-		story, err = syncer.ProjectClient.SetStoryType(story.ID, storyType)
+		logger.Info("updating story type", "type", storyType)
+		story, err = syncer.setStoryType(story, storyType)
 		if err != nil {
-			return tracker.Story{}, err
+			return Story{}, err
 		}
 	}
 
 	if story.Name != *issue.Title {
-		log.Println("syncing story name...")
-		story, err = syncer.ProjectClient.SetStoryName(story.ID, *issue.Title)
+		logger.Info("syncing story name")
+		story, err = syncer.setStoryName(story, *issue.Title)
 		if err != nil {
-			return tracker.Story{}, err
+			return Story{}, err
 		}
 	}
 
 nextIssueLabel:
 	for _, label := range issue.Labels {
-		for boringLabel := range storyStateLabels {
-			if *label.Name == boringLabel {
-				continue nextIssueLabel
-			}
+		if syncer.stateLabels().IsStateLabel(*label.Name) {
+			continue
+		}
+
+		if _, isTypeLabel := syncer.storyTypeLabels().TypeOf(*label.Name); isTypeLabel {
+			continue
 		}
 
 		for _, storyLabel := range story.Labels {
@@ -579,29 +1178,70 @@ nextIssueLabel:
 			}
 		}
 
-		log.Println("syncing issue label", *label.Name, "to story", story.ID)
+		logger.Debug("syncing issue label to story", "label", *label.Name)
 
-		_, err = syncer.ProjectClient.AddStoryLabel(story.ID, *label.Name)
+		err = syncer.addStoryLabel(story, *label.Name)
 		if err != nil {
-			log.Println("warning - failed to add label to story:", err)
+			logger.Warn("failed to add label to story", "label", *label.Name, "error", err)
 		}
 	}
 
 	return story, nil
 }
 
-func trackerLabelForIssue(repo *github.Repository, issue *github.Issue) string {
-	return fmt.Sprintf("%s/%s#%d", *repo.Owner.Login, *repo.Name, *issue.Number)
+func (syncer *Syncer) unscheduleStory(story Story) (Story, error) {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionUnscheduleStory, fmt.Sprintf("#%d", story.ID), "")
+		story.State = tracker.StoryStateUnscheduled
+		return story, nil
+	}
+
+	return syncer.Backend.UnscheduleStory(story.ID)
 }
 
-func choreForNewIssue(label string, issue *github.Issue) tracker.Story {
+func (syncer *Syncer) setStoryType(story Story, storyType tracker.StoryType) (Story, error) {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionSetStoryType, fmt.Sprintf("#%d", story.ID), string(storyType))
+		story.Type = storyType
+		return story, nil
+	}
+
+	return syncer.Backend.SetStoryType(story.ID, storyType)
+}
+
+func (syncer *Syncer) setStoryName(story Story, name string) (Story, error) {
+	if syncer.Plan != nil {
+		syncer.Plan.Record(ActionSetStoryName, fmt.Sprintf("#%d", story.ID), name)
+		story.Name = name
+		return story, nil
+	}
+
+	return syncer.Backend.SetStoryName(story.ID, name)
+}
+
+func (syncer *Syncer) trackerLabelForIssue(repo *Repository, issue *github.Issue) string {
+	return issueLabel(syncer.Source.Host(), *repo.Owner.Login, *repo.Name, *issue.Number)
+}
+
+// pullRequestURL returns the pull request's page, if known; older Gitea
+// versions and some GitHub payloads leave it out.
+func pullRequestURL(links *github.PullRequestLinks) string {
+	switch {
+	case links.HTMLURL != nil:
+		return *links.HTMLURL
+	case links.URL != nil:
+		return *links.URL
+	default:
+		return ""
+	}
+}
+
+func choreForNewIssue(label string, issue *github.Issue) Story {
 	labels := []tracker.Label{
 		{Name: label},
 	}
 
 	if issue.PullRequestLinks != nil {
-		prJSON, _ := json.Marshal(issue.PullRequestLinks)
-		log.Printf("  has pull request: %s\n", string(prJSON))
 		labels = append(labels, tracker.Label{Name: "has-pr"})
 	}
 
@@ -614,16 +1254,18 @@ func choreForNewIssue(label string, issue *github.Issue) tracker.Story {
 		issue.CreatedAt.Format("January 2"),
 	)
 
-	return tracker.Story{
-		Name:        *issue.Title,
-		Description: description,
-		Type:        "chore",
-		State:       "unscheduled",
-		Labels:      labels,
+	return Story{
+		Story: tracker.Story{
+			Name:        *issue.Title,
+			Description: description,
+			Type:        "chore",
+			State:       "unscheduled",
+			Labels:      labels,
+		},
 	}
 }
 
-func choreForReopenedIssue(label string, issue *github.Issue) tracker.Story {
+func choreForReopenedIssue(label string, issue *github.Issue) Story {
 	labels := []tracker.Label{
 		{Name: label},
 	}
@@ -637,27 +1279,17 @@ func choreForReopenedIssue(label string, issue *github.Issue) tracker.Story {
 		issue.UpdatedAt.Format("January 2"),
 	)
 
-	return tracker.Story{
-		Name:        "reopened: " + *issue.Title,
-		Description: description,
-		Type:        "chore",
-		State:       "unscheduled",
-		Labels:      labels,
+	return Story{
+		Story: tracker.Story{
+			Name:        "reopened: " + *issue.Title,
+			Description: description,
+			Type:        "chore",
+			State:       "unscheduled",
+			Labels:      labels,
+		},
 	}
 }
 
-func issueStoryType(issue *github.Issue) tracker.StoryType {
-	if issueHasLabel(issue, IssueLabelEnhancement) {
-		return tracker.StoryTypeFeature
-	}
-
-	if issueHasLabel(issue, IssueLabelBug) {
-		return tracker.StoryTypeBug
-	}
-
-	return tracker.StoryTypeChore
-}
-
 func issueHasLabel(issue *github.Issue, needle string) bool {
 	for _, label := range issue.Labels {
 		if *label.Name == needle {
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// TrackerDefaultURL is where the Tracker API is served unless
+// --tracker-api-url says otherwise.
+const TrackerDefaultURL = "https://www.pivotaltracker.com"
+
+// trackerAPI is a Tracker project's REST API. The vendored go-tracker client
+// can't be given an HTTP client or base URL, and doesn't decode everything
+// tracksuit needs, so requests are made directly; responses are decoded into
+// go-tracker's types where they fit.
+type trackerAPI struct {
+	restAPI
+}
+
+func newTrackerAPI(apiURL string, projectID int, token string, client *http.Client) trackerAPI {
+	return trackerAPI{
+		restAPI: restAPI{
+			Name:    "tracker",
+			BaseURL: fmt.Sprintf("%s/services/v5/projects/%d", strings.TrimSuffix(apiURL, "/"), projectID),
+			Header:  http.Header{"X-TrackerToken": {token}},
+			Client:  client,
+		},
+	}
+}
+
+// Stories returns a page of the stories matching the query.
+func (api trackerAPI) Stories(query tracker.StoriesQuery) ([]Story, error) {
+	var stories []Story
+	err := api.request("GET", "/stories", query.Query(), nil, &stories)
+	return stories, err
+}
+
+func (api trackerAPI) CreateStory(story Story) (Story, error) {
+	var created Story
+	err := api.request("POST", "/stories", nil, story, &created)
+	return created, err
+}
+
+func (api trackerAPI) DeleteStory(storyID int) error {
+	return api.request("DELETE", fmt.Sprintf("/stories/%d", storyID), nil, nil, nil)
+}
+
+// UpdateStory sets the fields given in the update, leaving the rest alone.
+func (api trackerAPI) UpdateStory(storyID int, update tracker.Story) (Story, error) {
+	var story Story
+	err := api.request("PUT", fmt.Sprintf("/stories/%d", storyID), nil, update, &story)
+	return story, err
+}
+
+// StoryComments returns the comments on the story, oldest first.
+func (api trackerAPI) StoryComments(storyID int) ([]StoryComment, error) {
+	var comments []StoryComment
+	err := api.request("GET", fmt.Sprintf("/stories/%d/comments", storyID), nil, nil, &comments)
+	return comments, err
+}
+
+func (api trackerAPI) CreateStoryComment(storyID int, text string) (StoryComment, error) {
+	var comment StoryComment
+	err := api.request("POST", fmt.Sprintf("/stories/%d/comments", storyID), nil, StoryComment{Text: text}, &comment)
+	return comment, err
+}
+
+// Activity returns a page of the project's activity, newest first.
+func (api trackerAPI) Activity(query tracker.ActivityQuery) ([]tracker.Activity, error) {
+	var activities []tracker.Activity
+	err := api.request("GET", "/activity", query.Query(), nil, &activities)
+	return activities, err
+}
+
+func (api trackerAPI) AddStoryLabel(storyID int, name string) (tracker.Label, error) {
+	var label tracker.Label
+	err := api.request("POST", fmt.Sprintf("/stories/%d/labels", storyID), nil, tracker.Label{Name: name}, &label)
+	return label, err
+}
+
+func (api trackerAPI) RemoveStoryLabel(storyID int, labelID int) error {
+	return api.request("DELETE", fmt.Sprintf("/stories/%d/labels/%d", storyID, labelID), nil, nil, nil)
+}
+
+// Labels returns the project's labels, with counts of the stories with them.
+func (api trackerAPI) Labels() ([]tracker.Label, error) {
+	var labels []tracker.Label
+	err := api.request("GET", "/labels", url.Values{"fields": {"id,project_id,name,counts"}}, nil, &labels)
+	return labels, err
+}
+
+func (api trackerAPI) DeleteLabel(labelID int) error {
+	return api.request("DELETE", fmt.Sprintf("/labels/%d", labelID), nil, nil, nil)
+}
+
+func (api trackerAPI) ProjectMemberships() ([]tracker.ProjectMembership, error) {
+	var memberships []tracker.ProjectMembership
+	err := api.request("GET", "/memberships", nil, nil, &memberships)
+	return memberships, err
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xoebus/go-tracker"
+)
+
+// storyIDBatchSize is the number of stories fetched at once by ID, keeping
+// the filter well within URL length limits.
+const storyIDBatchSize = 50
+
+// TrackerBackend syncs issues with a Pivotal Tracker project.
+type TrackerBackend struct {
+	ProjectID int
+	API       trackerAPI
+}
+
+func NewTrackerBackend(trackerURL string, projectID int, token string, client *http.Client) *TrackerBackend {
+	return &TrackerBackend{
+		ProjectID: projectID,
+		API:       newTrackerAPI(trackerURL, projectID, token, client),
+	}
+}
+
+func (backend *TrackerBackend) Project() string {
+	return strconv.Itoa(backend.ProjectID)
+}
+
+func (backend *TrackerBackend) ProjectURL() string {
+	return fmt.Sprintf("https://www.pivotaltracker.com/n/projects/%d", backend.ProjectID)
+}
+
+func (backend *TrackerBackend) Tool() string {
+	return "Pivotal Tracker"
+}
+
+func (backend *TrackerBackend) AllStories() (StorySet, error) {
+	return backend.fetchStories(tracker.StoriesQuery{})
+}
+
+func (backend *TrackerBackend) StoriesWithLabel(label string) (StorySet, error) {
+	return backend.fetchStories(tracker.StoriesQuery{Label: label})
+}
+
+func (backend *TrackerBackend) StoriesByID(ids []int) (StorySet, error) {
+	var stories StorySet
+
+	for start := 0; start < len(ids); start += storyIDBatchSize {
+		end := start + storyIDBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var idList []string
+		for _, id := range ids[start:end] {
+			idList = append(idList, strconv.Itoa(id))
+		}
+
+		batch, err := backend.fetchStories(tracker.StoriesQuery{
+			Filter: []string{"id:" + strings.Join(idList, ",")},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		stories = append(stories, batch...)
+	}
+
+	return stories, nil
+}
+
+func (backend *TrackerBackend) LatestVersion() (int, error) {
+	activities, err := backend.API.Activity(tracker.ActivityQuery{Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(activities) == 0 {
+		return 0, nil
+	}
+
+	return activities[0].ProjectVersion, nil
+}
+
+func (backend *TrackerBackend) ChangedSince(version int) ([]int, int, error) {
+	var allActivity []tracker.Activity
+
+	query := tracker.ActivityQuery{SinceVersion: version}
+
+	for {
+		activities, err := backend.API.Activity(query)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(activities) == 0 {
+			break
+		}
+
+		allActivity = append(allActivity, activities...)
+
+		query.Offset = len(allActivity)
+	}
+
+	latestVersion := version
+	changed := map[int]bool{}
+	var ids []int
+	for _, activity := range allActivity {
+		if activity.ProjectVersion > latestVersion {
+			latestVersion = activity.ProjectVersion
+		}
+
+		for _, id := range activityStoryIDs(activity) {
+			if !changed[id] {
+				changed[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, latestVersion, nil
+}
+
+func (backend *TrackerBackend) CreateStory(story Story) (Story, error) {
+	return backend.API.CreateStory(story)
+}
+
+func (backend *TrackerBackend) DeleteStory(id int) error {
+	return backend.API.DeleteStory(id)
+}
+
+func (backend *TrackerBackend) SetStoryType(id int, storyType tracker.StoryType) (Story, error) {
+	return backend.API.UpdateStory(id, tracker.Story{Type: storyType})
+}
+
+func (backend *TrackerBackend) SetStoryName(id int, name string) (Story, error) {
+	return backend.API.UpdateStory(id, tracker.Story{Name: name})
+}
+
+func (backend *TrackerBackend) UnscheduleStory(id int) (Story, error) {
+	return backend.API.UpdateStory(id, tracker.Story{State: tracker.StoryStateUnscheduled})
+}
+
+func (backend *TrackerBackend) SetStoryState(id int, state tracker.StoryState) (Story, error) {
+	return backend.API.UpdateStory(id, tracker.Story{State: state})
+}
+
+func (backend *TrackerBackend) DeliverStoryWithComment(id int, comment string) (Story, error) {
+	story, err := backend.API.UpdateStory(id, tracker.Story{State: tracker.StoryStateDelivered})
+	if err != nil {
+		return Story{}, err
+	}
+
+	if _, err := backend.API.CreateStoryComment(id, comment); err != nil {
+		return Story{}, err
+	}
+
+	return story, nil
+}
+
+func (backend *TrackerBackend) AddStoryLabel(id int, label string) error {
+	_, err := backend.API.AddStoryLabel(id, label)
+	return err
+}
+
+func (backend *TrackerBackend) RemoveStoryLabel(id int, label tracker.Label) error {
+	return backend.API.RemoveStoryLabel(id, label.ID)
+}
+
+func (backend *TrackerBackend) StoryComments(id int) ([]StoryComment, error) {
+	return backend.API.StoryComments(id)
+}
+
+func (backend *TrackerBackend) CreateStoryComment(id int, text string) (StoryComment, error) {
+	return backend.API.CreateStoryComment(id, text)
+}
+
+func (backend *TrackerBackend) Members() ([]tracker.Person, error) {
+	memberships, err := backend.API.ProjectMemberships()
+	if err != nil {
+		return nil, err
+	}
+
+	var people []tracker.Person
+	for _, membership := range memberships {
+		people = append(people, membership.Person)
+	}
+
+	return people, nil
+}
+
+func (backend *TrackerBackend) Labels() ([]tracker.Label, error) {
+	return backend.API.Labels()
+}
+
+func (backend *TrackerBackend) DeleteLabel(label tracker.Label) error {
+	return backend.API.DeleteLabel(label.ID)
+}
+
+func (backend *TrackerBackend) fetchStories(query tracker.StoriesQuery) (StorySet, error) {
+	var allStories StorySet
+
+	for {
+		stories, err := backend.API.Stories(query)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(stories) == 0 {
+			break
+		}
+
+		allStories = append(allStories, stories...)
+
+		query.Offset = len(allStories)
+	}
+
+	return allStories, nil
+}
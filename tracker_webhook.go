@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/xoebus/go-tracker"
+)
+
+// TrackerWebhookHandler receives Tracker activity webhooks and pushes story
+// changes back to the issues they are labelled for. Like GitHub deliveries,
+// activity is acknowledged right away and synced in the background by Queue.
+type TrackerWebhookHandler struct {
+	Syncers []*Syncer
+
+	// Token must be given as the 'token' query parameter, since Tracker does
+	// not sign its webhook deliveries. Without it, every delivery is rejected.
+	Token string
+
+	Queue *WorkQueue
+
+	Logger *Logger
+}
+
+func (handler *TrackerWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if handler.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(handler.Token)) != 1 {
+		handler.Logger.Warn("rejecting tracker webhook: invalid token")
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var activity tracker.Activity
+	if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
+		handler.Logger.Warn("rejecting tracker webhook", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	storyIDs := activityStoryIDs(activity)
+	if len(storyIDs) == 0 {
+		handler.Logger.Debug("ignoring tracker webhook", "kind", activity.Kind)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	projectID := activityProjectID(activity)
+
+	syncers := handler.projectSyncers(projectID)
+	if len(syncers) == 0 {
+		handler.Logger.Debug("ignoring tracker webhook for unsynced project", "project", projectID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	handler.Logger.Info("received activity", "kind", activity.Kind, "project", projectID, "message", activity.Message)
+
+	for _, id := range storyIDs {
+		id := id
+
+		handler.Queue.Enqueue(fmt.Sprintf("story:%d", id), func() error {
+			var multiErr *multierror.Error
+			for _, syncer := range syncers {
+				if err := syncer.SyncStoryChange(id); err != nil {
+					multiErr = multierror.Append(multiErr, err)
+				}
+			}
+
+			return multiErr.ErrorOrNil()
+		})
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// projectSyncers returns the syncers of the given Tracker project. Activity
+// says nothing about the stories of other projects or backends, whose IDs
+// could collide with the activity's.
+func (handler *TrackerWebhookHandler) projectSyncers(projectID int) []*Syncer {
+	var syncers []*Syncer
+	for _, syncer := range handler.Syncers {
+		backend, ok := syncer.Backend.(*TrackerBackend)
+		if ok && backend.ProjectID == projectID {
+			syncers = append(syncers, syncer)
+		}
+	}
+
+	return syncers
+}
+
+// activityProjectID returns the ID of the project the activity happened in,
+// or 0 if it doesn't say.
+func activityProjectID(activity tracker.Activity) int {
+	fields, ok := activity.Project.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	// encoding/json decodes all numbers into float64
+	id, _ := fields["id"].(float64)
+
+	return int(id)
+}
+
+// activityStoryIDs returns the IDs of the stories that an activity is
+// primarily about.
+func activityStoryIDs(activity tracker.Activity) []int {
+	var ids []int
+
+	for _, resource := range activity.PrimaryResources {
+		fields, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if fields["kind"] != "story" {
+			continue
+		}
+
+		// encoding/json decodes all numbers into float64
+		id, ok := fields["id"].(float64)
+		if !ok {
+			continue
+		}
+
+		ids = append(ids, int(id))
+	}
+
+	return ids
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/vito/tracksuit/fakes"
+	"github.com/xoebus/go-tracker"
+)
+
+const testTrackerWebhookToken = "some-token"
+
+type trackerWebhookFixture struct {
+	*syncFixture
+
+	Queue   *WorkQueue
+	Handler *TrackerWebhookHandler
+}
+
+func newTrackerWebhookFixture(t *testing.T, syncers ...*Syncer) *trackerWebhookFixture {
+	fixture := newSyncFixture(t)
+
+	queue := NewWorkQueue(&sync.Mutex{}, nil)
+	go queue.Run()
+
+	return &trackerWebhookFixture{
+		syncFixture: fixture,
+
+		Queue: queue,
+
+		Handler: &TrackerWebhookHandler{
+			Syncers: append([]*Syncer{fixture.Syncer}, syncers...),
+			Token:   testTrackerWebhookToken,
+			Queue:   queue,
+		},
+	}
+}
+
+// deliver posts activity about the stories of the project, and waits for the
+// stories to be synced.
+func (fixture *trackerWebhookFixture) deliver(t *testing.T, token string, projectID int, storyIDs ...int) int {
+	t.Helper()
+
+	var resources []interface{}
+	for _, id := range storyIDs {
+		resources = append(resources, map[string]interface{}{"kind": "story", "id": id})
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"kind":              "story_update_activity",
+		"message":           "someone started this story",
+		"project":           map[string]interface{}{"kind": "project", "id": projectID},
+		"primary_resources": resources,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	fixture.Handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/tracker?token="+token, bytes.NewReader(payload)))
+
+	fixture.Queue.Wait()
+
+	return recorder.Code
+}
+
+func TestTrackerWebhookSyncsIssuesOfChangedStories(t *testing.T) {
+	fixture := newTrackerWebhookFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	fixture.sync(t)
+
+	started := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(started.ID, tracker.StoryStateStarted)
+
+	untouched := fixture.stories(t, 2, 1)[0]
+	fixture.Tracker.SetStoryState(untouched.ID, tracker.StoryStateStarted)
+
+	if code := fixture.deliver(t, testTrackerWebhookToken, testProjectID, started.ID); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelInFlight)
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 2), IssueLabelUnscheduled)
+
+	fixture.Tracker.SetStoryState(started.ID, tracker.StoryStateAccepted)
+
+	if code := fixture.deliver(t, testTrackerWebhookToken, testProjectID, started.ID); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	if state := fixture.issueState(1); state != "closed" {
+		t.Fatalf("expected issue to be closed, got %s", state)
+	}
+
+	fixture.stories(t, 1, 1)
+}
+
+func TestTrackerWebhookOnlySyncsTheActivitysProject(t *testing.T) {
+	otherTracker := fakes.NewTracker(testProjectID + 1)
+	defer otherTracker.Close()
+
+	otherSyncer := &Syncer{
+		Backend:          NewTrackerBackend(otherTracker.URL, otherTracker.ProjectID, "some-token", nil),
+		OrganizationName: testOrganization,
+	}
+
+	fixture := newTrackerWebhookFixture(t, otherSyncer)
+	otherSyncer.Source = fixture.Syncer.Source
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something else broke")
+
+	// the same ID in another project, for another issue
+	otherStory := otherTracker.AddStory(tracker.Story{
+		Name:   "something else broke",
+		Labels: []tracker.Label{{Name: issueLabel("", testOrganization, testRepo, 2)}},
+		State:  tracker.StoryStateStarted,
+	})
+
+	if otherStory.ID != story.ID {
+		t.Fatalf("expected the fakes to number stories alike, got %d and %d", otherStory.ID, story.ID)
+	}
+
+	if code := fixture.deliver(t, testTrackerWebhookToken, testProjectID, story.ID); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 2))
+
+	if code := fixture.deliver(t, testTrackerWebhookToken, testProjectID+2, story.ID); code != http.StatusNoContent {
+		t.Fatalf("expected %d for an unsynced project, got %d", http.StatusNoContent, code)
+	}
+
+	if code := fixture.deliver(t, testTrackerWebhookToken, testProjectID+1, otherStory.ID); code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, code)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 2), IssueLabelEnhancement, IssueLabelInFlight)
+}
+
+func TestTrackerWebhookRejectsWrongToken(t *testing.T) {
+	fixture := newTrackerWebhookFixture(t)
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateStarted)
+
+	if code := fixture.deliver(t, "wrong-token", testProjectID, story.ID); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelUnscheduled)
+}
+
+func TestTrackerWebhookRejectsEverythingWithoutAToken(t *testing.T) {
+	fixture := newTrackerWebhookFixture(t)
+	fixture.Handler.Token = ""
+
+	fixture.GitHub.AddIssue(testOrganization, testRepo, "something broke")
+
+	fixture.sync(t)
+
+	story := fixture.stories(t, 1, 1)[0]
+	fixture.Tracker.SetStoryState(story.ID, tracker.StoryStateStarted)
+
+	if code := fixture.deliver(t, "", testProjectID, story.ID); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	assertLabels(t, fixture.GitHub.IssueLabels(testOrganization, testRepo, 1), IssueLabelUnscheduled)
+}
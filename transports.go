@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const defaultAbuseRetryAfter = time.Minute
+
+// GitHubRateLimitTransport waits out GitHub's rate limits rather than letting
+// requests fail partway through a sync, until Budget has been spent waiting.
+type GitHubRateLimitTransport struct {
+	Base http.RoundTripper
+
+	Budget time.Duration
+
+	Logger *Logger
+}
+
+func (transport *GitHubRateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := rewindableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	for {
+		attempt := cloneRequest(req, body)
+
+		resp, err := transport.Base.RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		var wait time.Duration
+		var reason string
+		switch resp.StatusCode {
+		case http.StatusForbidden:
+			payload, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			resp.Body = ioutil.NopCloser(bytes.NewReader(payload))
+
+			switch rateErr := github.CheckResponse(resp).(type) {
+			case *github.RateLimitError:
+				wait = time.Until(rateErr.Rate.Reset.Time)
+				reason = "github rate limit exceeded; waiting until reset"
+
+			case *github.AbuseRateLimitError:
+				wait = defaultAbuseRetryAfter
+				if rateErr.RetryAfter != nil {
+					wait = *rateErr.RetryAfter
+				}
+
+				reason = "github abuse rate limit triggered; waiting"
+
+			default:
+				resp.Body = ioutil.NopCloser(bytes.NewReader(payload))
+				return resp, nil
+			}
+
+			if time.Since(start)+wait > transport.Budget {
+				transport.Logger.Warn("github rate limit wait exceeds retry budget; giving up", "wait", wait)
+				resp.Body = ioutil.NopCloser(bytes.NewReader(payload))
+				return resp, nil
+			}
+
+		case http.StatusTooManyRequests:
+			// secondary rate limits are sometimes reported this way
+			wait = retryAfter(resp)
+			if wait == 0 {
+				wait = defaultAbuseRetryAfter
+			}
+
+			if time.Since(start)+wait > transport.Budget {
+				transport.Logger.Warn("github rate limit wait exceeds retry budget; giving up", "wait", wait)
+				return resp, nil
+			}
+
+			resp.Body.Close()
+
+			reason = "github secondary rate limit triggered; waiting"
+
+		default:
+			waitForRateReset(transport.Logger, resp, transport.Budget-time.Since(start))
+			return resp, nil
+		}
+
+		transport.Logger.Warn(reason, "wait", wait)
+
+		time.Sleep(wait)
+	}
+}
+
+// waitForRateReset blocks until the rate limit resets if the response used up
+// the last remaining request, so that the next request doesn't fail. It
+// doesn't wait longer than budget.
+func waitForRateReset(logger *Logger, resp *http.Response, budget time.Duration) {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	wait := time.Until(time.Unix(reset, 0))
+	if wait <= 0 {
+		return
+	}
+
+	if wait > budget {
+		logger.Warn("github rate limit exhausted; reset exceeds retry budget", "wait", wait)
+		return
+	}
+
+	logger.Warn("github rate limit exhausted; waiting until reset", "wait", wait)
+
+	time.Sleep(wait)
+}
+
+// RetryTransport retries requests that are rate limited with 429 responses,
+// and idempotent requests that fail with 5xx responses, backing off
+// exponentially until Budget has been spent.
+//
+// Other requests aren't retried on 5xx, as the server may have acted on them
+// before failing, e.g. creating a story that a retry would create again.
+// Requests can be marked idempotent with an Idempotency-Key or
+// X-Idempotency-Key header, as with http.Transport; a nil value marks them
+// without sending the header.
+type RetryTransport struct {
+	Base http.RoundTripper
+
+	Budget time.Duration
+
+	Logger *Logger
+}
+
+const (
+	initialRetryBackoff = time.Second
+	maxRetryBackoff     = time.Minute
+)
+
+func (transport *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := rewindableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	for retries := 0; ; retries++ {
+		resp, err := transport.Base.RoundTrip(cloneRequest(req, body))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && (resp.StatusCode < 500 || !isIdempotent(req)) {
+			return resp, nil
+		}
+
+		wait := retryAfter(resp)
+		if wait == 0 {
+			backoff := float64(initialRetryBackoff) * math.Pow(2, float64(retries))
+			wait = time.Duration(math.Min(backoff, float64(maxRetryBackoff)))
+		}
+
+		if time.Since(start)+wait > transport.Budget {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		transport.Logger.Warn(
+			"request failed; retrying",
+			"method", req.Method,
+			"path", req.URL.Path,
+			"status", resp.StatusCode,
+			"wait", wait,
+		)
+
+		time.Sleep(wait)
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+
+	return hasKey || hasXKey
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// rewindableBody buffers the request body, if any, so that it can be sent
+// again on retry.
+func rewindableBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	defer req.Body.Close()
+
+	return ioutil.ReadAll(req.Body)
+}
+
+func cloneRequest(req *http.Request, body []byte) *http.Request {
+	clone := new(http.Request)
+	*clone = *req
+
+	clone.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		clone.Header[k] = append([]string(nil), v...)
+	}
+
+	if body != nil {
+		clone.Body = ioutil.NopCloser(bytes.NewReader(body))
+		clone.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	return clone
+}
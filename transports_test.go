@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer responds with each of the statuses in turn, then 200s, counting
+// the requests it receives.
+type flakyServer struct {
+	*httptest.Server
+
+	requests int
+	lock     sync.Mutex
+}
+
+func newFlakyServer(t *testing.T, respond func(w http.ResponseWriter, attempt int)) *flakyServer {
+	server := &flakyServer{}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.lock.Lock()
+		server.requests++
+		attempt := server.requests
+		server.lock.Unlock()
+
+		respond(w, attempt)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (server *flakyServer) Requests() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.requests
+}
+
+func failFirst(status int, header http.Header) func(http.ResponseWriter, int) {
+	return func(w http.ResponseWriter, attempt int) {
+		if attempt == 1 {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+
+			w.WriteHeader(status)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func roundTrip(t *testing.T, transport http.RoundTripper, method string, url string, header http.Header) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestRetryTransportRetriesIdempotentRequestsOnServerErrors(t *testing.T) {
+	server := newFlakyServer(t, failFirst(http.StatusBadGateway, nil))
+
+	transport := &RetryTransport{Base: http.DefaultTransport, Budget: time.Minute}
+
+	if status := roundTrip(t, transport, "GET", server.URL, nil); status != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, status)
+	}
+
+	if requests := server.Requests(); requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestRetryTransportDoesNotRetryWritesOnServerErrors(t *testing.T) {
+	server := newFlakyServer(t, failFirst(http.StatusBadGateway, nil))
+
+	transport := &RetryTransport{Base: http.DefaultTransport, Budget: time.Minute}
+
+	if status := roundTrip(t, transport, "POST", server.URL, nil); status != http.StatusBadGateway {
+		t.Fatalf("expected %d, got %d", http.StatusBadGateway, status)
+	}
+
+	if requests := server.Requests(); requests != 1 {
+		t.Fatalf("expected 1 request, got %d", requests)
+	}
+}
+
+func TestRetryTransportRetriesWritesMarkedIdempotent(t *testing.T) {
+	server := newFlakyServer(t, failFirst(http.StatusBadGateway, nil))
+
+	transport := &RetryTransport{Base: http.DefaultTransport, Budget: time.Minute}
+
+	if status := roundTrip(t, transport, "POST", server.URL, http.Header{"X-Idempotency-Key": nil}); status != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, status)
+	}
+}
+
+func TestRetryTransportRetriesRateLimitedWrites(t *testing.T) {
+	server := newFlakyServer(t, failFirst(http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}}))
+
+	transport := &RetryTransport{Base: http.DefaultTransport, Budget: time.Minute}
+
+	if status := roundTrip(t, transport, "POST", server.URL, nil); status != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, status)
+	}
+
+	if requests := server.Requests(); requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestGitHubRateLimitTransportWaitsOutSecondaryRateLimits(t *testing.T) {
+	server := newFlakyServer(t, failFirst(http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}}))
+
+	transport := &GitHubRateLimitTransport{Base: http.DefaultTransport, Budget: time.Minute}
+
+	if status := roundTrip(t, transport, "POST", server.URL, nil); status != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, status)
+	}
+
+	if requests := server.Requests(); requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestGitHubRateLimitTransportGivesUpPastItsBudget(t *testing.T) {
+	server := newFlakyServer(t, func(w http.ResponseWriter, attempt int) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"API rate limit exceeded for some-user."}`)
+	})
+
+	transport := &GitHubRateLimitTransport{Base: http.DefaultTransport, Budget: time.Minute}
+
+	done := make(chan int)
+	go func() {
+		done <- roundTrip(t, transport, "GET", server.URL, nil)
+	}()
+
+	select {
+	case status := <-done:
+		if status != http.StatusForbidden {
+			t.Fatalf("expected %d, got %d", http.StatusForbidden, status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the transport to give up")
+	}
+
+	if requests := server.Requests(); requests != 1 {
+		t.Fatalf("expected 1 request, got %d", requests)
+	}
+}
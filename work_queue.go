@@ -0,0 +1,102 @@
+package main
+
+import "sync"
+
+// WorkQueue runs webhook work in the background, one piece at a time, so that
+// deliveries are acknowledged right away even while a full sync is running.
+//
+// Work is keyed by what it syncs, e.g. an issue or a repository. Work queued
+// for a key that is already waiting to run is dropped, as the waiting work
+// will see the same changes.
+type WorkQueue struct {
+	// Lock is held while work runs, so that it takes turns with full syncs.
+	Lock *sync.Mutex
+
+	Logger *Logger
+
+	pending map[string]func() error
+	order   []string
+	lock    sync.Mutex
+
+	wake chan struct{}
+	busy sync.WaitGroup
+}
+
+func NewWorkQueue(lock *sync.Mutex, logger *Logger) *WorkQueue {
+	return &WorkQueue{
+		Lock:   lock,
+		Logger: logger,
+
+		pending: map[string]func() error{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues the work unless work for the same key is already waiting,
+// returning whether it was queued.
+func (queue *WorkQueue) Enqueue(key string, work func() error) bool {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if _, found := queue.pending[key]; found {
+		queue.Logger.Debug("work already queued", "key", key)
+		return false
+	}
+
+	queue.busy.Add(1)
+
+	queue.pending[key] = work
+	queue.order = append(queue.order, key)
+
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Run runs queued work in the order it was queued, forever. Failures are
+// logged, as the delivery that queued the work has long been acknowledged.
+func (queue *WorkQueue) Run() {
+	for range queue.wake {
+		for {
+			key, work, found := queue.next()
+			if !found {
+				break
+			}
+
+			queue.Lock.Lock()
+			err := work()
+			queue.Lock.Unlock()
+
+			if err != nil {
+				queue.Logger.Error("syncing failed", err, "key", key)
+			}
+
+			queue.busy.Done()
+		}
+	}
+}
+
+// Wait blocks until all queued work has run.
+func (queue *WorkQueue) Wait() {
+	queue.busy.Wait()
+}
+
+func (queue *WorkQueue) next() (string, func() error, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if len(queue.order) == 0 {
+		return "", nil, false
+	}
+
+	key := queue.order[0]
+	queue.order = queue.order[1:]
+
+	work := queue.pending[key]
+	delete(queue.pending, key)
+
+	return key, work, true
+}